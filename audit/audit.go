@@ -0,0 +1,261 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package audit compares the pins held by a pinning service with the CIDs
+expected to be pinned, such as the ones recorded by a journal, to find the
+pins lost to account changes, plan downgrades or incidents of the service.
+
+The pins are listed once if the service supports listing, which also
+reveals the pins that are not expected. Otherwise, the status of every
+expected CID is queried. Missing and failed pins can be pinned again by
+CID.
+*/
+package audit // import "github.com/wabarc/ipfs-pinner/audit"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/wabarc/ipfs-pinner/batch"
+	"github.com/wabarc/ipfs-pinner/capability"
+	"github.com/wabarc/ipfs-pinner/journal"
+	"github.com/wabarc/ipfs-pinner/pinning"
+
+	pinner "github.com/wabarc/ipfs-pinner"
+)
+
+// States of a finding.
+const (
+	// Pinned is an expected CID pinned by the service.
+	Pinned = "pinned"
+	// Pending is an expected CID queued or being pinned by the service.
+	Pending = "pending"
+	// Missing is an expected CID the service does not hold.
+	Missing = "missing"
+	// Failed is an expected CID the service failed to pin.
+	Failed = "failed"
+	// Extra is a CID pinned by the service but not expected.
+	Extra = "extra"
+	// Unknown is an expected CID whose status could not be queried.
+	Unknown = "unknown"
+)
+
+// Finding is the state of a CID on a pinning service.
+type Finding struct {
+	Cid    string `json:"cid"`
+	Pinner string `json:"pinner"`
+	State  string `json:"state"`
+	// Name is the name of the pin, if listed by the service.
+	Name string `json:"name,omitempty"`
+	// Repinned reports whether a missing or failed CID was pinned again.
+	Repinned bool `json:"repinned,omitempty"`
+	// Error is why the status could not be queried, or the CID could not
+	// be pinned again.
+	Error string `json:"error,omitempty"`
+}
+
+// Problem reports whether the finding calls for attention: a missing or
+// failed pin which was not pinned again, or an unknown status.
+func (f Finding) Problem() bool {
+	switch f.State {
+	case Missing, Failed:
+		return !f.Repinned
+	case Unknown:
+		return true
+	}
+	return false
+}
+
+// Auditor audits the pins of the pinner of Config.
+type Auditor struct {
+	Config *pinner.Config
+	// Repin pins the missing and failed CIDs again, by CID.
+	Repin bool
+}
+
+// Audit returns the findings of the expected CIDs, in their order, followed
+// by the extra pins if the pinner lists its pins. CIDs are compared by
+// multihash, so that a CIDv0 matches its CIDv1.
+func (a *Auditor) Audit(expected []string) ([]Finding, error) {
+	cfg := a.Config
+	caps, err := cfg.Capabilities()
+	if err != nil {
+		return nil, err
+	}
+	if !caps.List && !caps.Status {
+		return nil, fmt.Errorf("%s: audit: %w", cfg.Pinner, capability.ErrUnsupported)
+	}
+
+	var (
+		findings []Finding
+		seen     = make(map[string]bool)
+	)
+	for _, c := range expected {
+		k, err := key(c)
+		if err != nil {
+			return nil, err
+		}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		findings = append(findings, Finding{Cid: c, Pinner: cfg.Pinner})
+	}
+
+	if caps.List {
+		pins, err := cfg.List()
+		if err != nil {
+			return nil, err
+		}
+		listed := make(map[string]pinning.Pin, len(pins))
+		for _, p := range pins {
+			k, err := key(p.Cid)
+			if err != nil {
+				continue
+			}
+			// A failed attempt does not hide a successful one.
+			if prev, ok := listed[k]; ok && prev.Status == pinning.Pinned {
+				continue
+			}
+			listed[k] = p
+		}
+		for i := range findings {
+			k, _ := key(findings[i].Cid)
+			p, ok := listed[k]
+			if !ok {
+				findings[i].State = Missing
+				continue
+			}
+			findings[i].State, findings[i].Name = state(p.Status), p.Name
+		}
+
+		var extra []Finding
+		for k, p := range listed {
+			if !seen[k] {
+				extra = append(extra, Finding{Cid: p.Cid, Pinner: cfg.Pinner, State: Extra, Name: p.Name})
+			}
+		}
+		sort.Slice(extra, func(i, j int) bool { return extra[i].Cid < extra[j].Cid })
+		findings = append(findings, extra...)
+	} else {
+		for i := range findings {
+			pinned, err := cfg.Pinned(findings[i].Cid)
+			switch {
+			case err != nil:
+				findings[i].State, findings[i].Error = Unknown, err.Error()
+			case pinned:
+				findings[i].State = Pinned
+			default:
+				findings[i].State = Missing
+			}
+		}
+	}
+
+	if a.Repin {
+		a.repin(findings, caps.PinHash)
+	}
+	return findings, nil
+}
+
+// repin pins the missing and failed CIDs of findings again.
+func (a *Auditor) repin(findings []Finding, supported bool) {
+	for i := range findings {
+		f := &findings[i]
+		if f.State != Missing && f.State != Failed {
+			continue
+		}
+		if !supported {
+			f.Error = fmt.Sprintf("%s: pin hash: %v", a.Config.Pinner, capability.ErrUnsupported)
+			continue
+		}
+		if _, err := a.Config.PinHash(f.Cid); err != nil {
+			f.Error = err.Error()
+			continue
+		}
+		f.Repinned = true
+	}
+}
+
+// state returns the state of an expected CID listed with status s.
+func state(s pinning.Status) string {
+	switch s {
+	case pinning.Queued, pinning.Pinning:
+		return Pending
+	case pinning.Failed:
+		return Failed
+	}
+	return Pinned
+}
+
+// key returns the multihash of c, comparing CIDs of any version.
+func key(c string) (string, error) {
+	id, err := cid.Decode(c)
+	if err != nil {
+		return "", fmt.Errorf("invalid cid %s: %w", c, err)
+	}
+	return string(id.Hash()), nil
+}
+
+// FromJournal returns the CIDs recorded by a journal, by pinner. If
+// account is not nil, it returns the account of a pinner, see
+// pinner.Config.Account, and the entries of other accounts are left out.
+func FromJournal(j *journal.Journal, account func(pinner string) string) map[string][]string {
+	entries := j.Entries()
+	sort.Slice(entries, func(i, k int) bool { return entries[i].Time.Before(entries[k].Time) })
+
+	accounts := make(map[string]string)
+	expected := make(map[string][]string)
+	for _, e := range entries {
+		if account != nil {
+			a, ok := accounts[e.Pinner]
+			if !ok {
+				a = account(e.Pinner)
+				accounts[e.Pinner] = a
+			}
+			if e.Account != a {
+				continue
+			}
+		}
+		expected[e.Pinner] = append(expected[e.Pinner], e.Cid)
+	}
+	return expected
+}
+
+// ReadExpected reads the expected CIDs of a file, by pinner. A line holds
+// a CID, optionally preceded by its pinner and a space, otherwise the CID
+// is expected on defaultPinner. Blank lines and lines starting with # are
+// skipped.
+func ReadExpected(r io.Reader, defaultPinner string) (map[string][]string, error) {
+	lines, err := batch.ReadManifest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	expected := make(map[string][]string)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		var p, c string
+		switch len(fields) {
+		case 1:
+			p, c = defaultPinner, fields[0]
+		case 2:
+			p, c = strings.ToLower(fields[0]), fields[1]
+		default:
+			return nil, fmt.Errorf("invalid line %q", line)
+		}
+		if _, err := key(c); err != nil {
+			return nil, err
+		}
+		if p == "" {
+			return nil, errors.New("no pinner for " + c)
+		}
+		expected[p] = append(expected[p], c)
+	}
+	return expected, nil
+}
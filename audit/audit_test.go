@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/wabarc/helper"
+	"github.com/wabarc/ipfs-pinner/journal"
+
+	pinner "github.com/wabarc/ipfs-pinner"
+)
+
+const (
+	pinned  = "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"
+	missing = "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"
+	extra   = "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"
+)
+
+func TestAudit(t *testing.T) {
+	var repinned []string
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v0/pin/ls":
+			_, _ = w.Write([]byte(`{"Keys":{"` + pinned + `":{"Type":"recursive"},"` + extra + `":{"Type":"recursive"}}}`))
+		case "/api/v0/pin/add":
+			hash := r.URL.Query().Get("arg")
+			repinned = append(repinned, hash)
+			_, _ = w.Write([]byte(`{"Pins":["` + hash + `"]}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	defer server.Close()
+
+	// The CIDv1 of a listed CIDv0 is pinned.
+	v1 := cid.NewCidV1(cid.DagProtobuf, cid.MustParse(pinned).Hash()).String()
+	cfg := &pinner.Config{Pinner: pinner.Infura}
+	cfg.WithClient(httpClient)
+	a := &Auditor{Config: cfg}
+	findings, err := a.Audit([]string{v1, missing, pinned})
+	if err != nil {
+		t.Fatalf("Unexpected audit: %v", err)
+	}
+	expected := []Finding{
+		{Cid: v1, Pinner: pinner.Infura, State: Pinned},
+		{Cid: missing, Pinner: pinner.Infura, State: Missing},
+		{Cid: extra, Pinner: pinner.Infura, State: Extra},
+	}
+	if !reflect.DeepEqual(findings, expected) {
+		t.Fatalf("Unexpected findings %+v", findings)
+	}
+	if !findings[1].Problem() || findings[0].Problem() || findings[2].Problem() {
+		t.Errorf("Unexpected problems of %+v", findings)
+	}
+	if len(repinned) != 0 {
+		t.Errorf("Unexpected repin %v", repinned)
+	}
+
+	a.Repin = true
+	findings, err = a.Audit([]string{pinned, missing})
+	if err != nil {
+		t.Fatalf("Unexpected audit: %v", err)
+	}
+	if !findings[1].Repinned || findings[1].Problem() || !reflect.DeepEqual(repinned, []string{missing}) {
+		t.Errorf("Unexpected repin %+v of %v", findings[1], repinned)
+	}
+
+	// Pinners without pin by hash cannot repin.
+	findings = []Finding{{Cid: missing, State: Missing}}
+	a.repin(findings, false)
+	if findings[0].Repinned || findings[0].Error == "" || !findings[0].Problem() {
+		t.Errorf("Unexpected repin without pin by hash %+v", findings[0])
+	}
+
+	if _, err := a.Audit([]string{"invalid"}); err == nil {
+		t.Error("Unexpected audit of an invalid cid")
+	}
+}
+
+func TestAuditUnpinned(t *testing.T) {
+	var repinned []string
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v0/add":
+			_, _ = w.Write([]byte(`{"Hash":"` + missing + `"}`))
+		case "/api/v0/pin/rm":
+			_, _ = w.Write([]byte(`{"Pins":["` + missing + `"]}`))
+		case "/api/v0/pin/ls":
+			_, _ = w.Write([]byte(`{"Keys":{}}`))
+		case "/api/v0/pin/add":
+			repinned = append(repinned, r.URL.Query().Get("arg"))
+			_, _ = w.Write([]byte(`{"Pins":["` + missing + `"]}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	defer server.Close()
+
+	j, err := journal.Open(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	path := filepath.Join(t.TempDir(), "content")
+	if err := os.WriteFile(path, []byte("content"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Content unpinned on purpose is not expected anymore.
+	cfg := &pinner.Config{Pinner: pinner.Infura, Journal: j}
+	cfg.WithClient(httpClient)
+	if _, err := cfg.Pin(path); err != nil {
+		t.Fatalf("Unexpected pin: %v", err)
+	}
+	if err := cfg.Unpin(missing); err != nil {
+		t.Fatalf("Unexpected unpin: %v", err)
+	}
+	a := &Auditor{Config: cfg, Repin: true}
+	findings, err := a.Audit(FromJournal(j, nil)[pinner.Infura])
+	if err != nil {
+		t.Fatalf("Unexpected audit: %v", err)
+	}
+	if len(findings) != 0 || len(repinned) != 0 {
+		t.Errorf("Unexpected findings %+v repinning %v", findings, repinned)
+	}
+}
+
+func TestExpected(t *testing.T) {
+	j, err := journal.Open(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	_ = j.Put(journal.Entry{Digest: "a", Cid: pinned, Pinner: pinner.Infura})
+	_ = j.Put(journal.Entry{Digest: "b", Cid: missing, Pinner: pinner.Pinata})
+	_ = j.Put(journal.Entry{Digest: "c", Cid: missing, Pinner: pinner.Infura, Account: "other"})
+	got := FromJournal(j, func(string) string { return "" })
+	if !reflect.DeepEqual(got, map[string][]string{pinner.Infura: {pinned}, pinner.Pinata: {missing}}) {
+		t.Errorf("Unexpected cids of the journal %v", got)
+	}
+	if got := FromJournal(j, nil); len(got[pinner.Infura]) != 2 {
+		t.Errorf("Unexpected cids of the journal of any account %v", got)
+	}
+
+	got, err = ReadExpected(strings.NewReader("# cids\n"+pinned+"\n\nPinata "+missing+"\n"), pinner.Infura)
+	if err != nil || !reflect.DeepEqual(got, map[string][]string{pinner.Infura: {pinned}, pinner.Pinata: {missing}}) {
+		t.Errorf("Unexpected cids of the file %v: %v", got, err)
+	}
+	for _, file := range []string{"invalid\n", "pinata " + pinned + " extra\n"} {
+		if _, err := ReadExpected(strings.NewReader(file), pinner.Infura); err == nil {
+			t.Errorf("Unexpected file %q read without error", file)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package batch pins many items, recording the outcome of each one in a
+checkpoint file as it finishes, so that an interrupted batch resumes where
+it stopped.
+*/
+package batch // import "github.com/wabarc/ipfs-pinner/batch"
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxAttempts is the number of times an item is tried by default.
+const DefaultMaxAttempts = 3
+
+// ErrStopped is returned by Run when it stops at the first failed item.
+var ErrStopped = errors.New("stopped at the first failure")
+
+// Result is the outcome of an item.
+type Result struct {
+	Item string
+	Cid  string
+	Err  error
+	// Attempts is the number of times the item has been tried, including
+	// the ones of previous runs.
+	Attempts int
+	// Skipped reports whether the item was completed by a previous run, or
+	// has no attempt left.
+	Skipped bool
+	// Duration is the time spent on the attempts of the item in this run.
+	Duration time.Duration
+}
+
+// Batch pins items with Pin.
+type Batch struct {
+	// Pin pins an item and returns its CID.
+	Pin func(item string) (string, error)
+	// Checkpoint, if set, records the outcome of every attempt. Items it
+	// holds as done are skipped.
+	Checkpoint *Checkpoint
+	// MaxAttempts is the number of times a failing item is tried, across
+	// runs sharing the checkpoint. Zero means DefaultMaxAttempts.
+	MaxAttempts int
+	// Jobs is the number of items pinned at once. Zero pins one at a
+	// time. Pin must be safe for concurrent use if it is more than one.
+	Jobs int
+	// FailFast stops the batch once an item has failed with no attempt
+	// left. The items being pinned are still reported, the ones not
+	// started are not.
+	FailFast bool
+}
+
+// Run pins the items in order, then tries the failed ones again while
+// they have attempts left. Duplicate items are pinned once. It calls fn,
+// if not nil, with the final result of every item once it and the items
+// before it are known, so results come in the order of the items whatever
+// the number of jobs, and returns the number of items that failed.
+func (b *Batch) Run(items []string, fn func(Result)) (failed int, err error) {
+	max := b.MaxAttempts
+	if max <= 0 {
+		max = DefaultMaxAttempts
+	}
+	report := func(r Result) error {
+		if r.Err != nil {
+			failed++
+		}
+		if fn != nil {
+			fn(r)
+		}
+		if r.Err != nil && b.FailFast {
+			return ErrStopped
+		}
+		return nil
+	}
+
+	attempts := make(map[string]int, len(items))
+	durations := make(map[string]time.Duration)
+	var pending []string
+	for _, item := range items {
+		if _, ok := attempts[item]; ok {
+			continue
+		}
+		attempts[item] = 0
+		if b.Checkpoint == nil {
+			pending = append(pending, item)
+			continue
+		}
+		state, ok := b.Checkpoint.State(item)
+		attempts[item] = state.Attempts
+		switch {
+		case ok && state.Done:
+			_ = report(Result{Item: item, Cid: state.Cid, Attempts: state.Attempts, Skipped: true})
+		case state.Attempts >= max:
+			err := fmt.Errorf("no attempt left: %s", state.Error)
+			if err := report(Result{Item: item, Err: err, Attempts: state.Attempts, Skipped: true}); err != nil {
+				return failed, err
+			}
+		default:
+			pending = append(pending, item)
+		}
+	}
+
+	for len(pending) > 0 {
+		var retry []string
+		err := b.pin(pending, func(r Result) error {
+			durations[r.Item] += r.Duration
+			attempts[r.Item]++
+			r.Attempts = attempts[r.Item]
+			r.Duration = durations[r.Item]
+			if b.Checkpoint != nil {
+				if err := b.Checkpoint.Record(r); err != nil {
+					return err
+				}
+			}
+			if r.Err != nil && r.Attempts < max {
+				retry = append(retry, r.Item)
+				return nil
+			}
+			return report(r)
+		})
+		if err != nil {
+			return failed, err
+		}
+		pending = retry
+	}
+
+	return failed, nil
+}
+
+// pin tries every item once with up to Jobs workers, and calls fn with
+// the result of each attempt in the order of the items. It stops handing
+// out items once fn returns an error, and returns that error after the
+// attempts in flight are done. If the error is ErrStopped, fn is still
+// called with the results of these attempts.
+func (b *Batch) pin(items []string, fn func(Result) error) error {
+	jobs := b.Jobs
+	if jobs < 1 {
+		jobs = 1
+	}
+	if jobs > len(items) {
+		jobs = len(items)
+	}
+
+	results := make([]chan Result, len(items))
+	for i := range results {
+		results[i] = make(chan Result, 1)
+	}
+	// An item is handed out once less than jobs items are pinned or
+	// waiting to be reported, so that none starts after a failure
+	// stopping the batch is reported.
+	slots := make(chan struct{}, jobs)
+	next := make(chan int)
+	stop := make(chan struct{})
+	go func() {
+		defer close(next)
+		for i := range items {
+			select {
+			case slots <- struct{}{}:
+			case <-stop:
+				return
+			}
+			select {
+			case next <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				select {
+				case <-stop:
+					// Handed out while stopping.
+					continue
+				default:
+				}
+				r := Result{Item: items[i]}
+				start := time.Now()
+				r.Cid, r.Err = b.Pin(items[i])
+				r.Duration = time.Since(start)
+				results[i] <- r
+			}
+		}()
+	}
+	defer wg.Wait()
+
+	for i := range items {
+		err := fn(<-results[i])
+		if err == nil {
+			<-slots
+			continue
+		}
+		close(stop)
+		if err == ErrStopped {
+			wg.Wait()
+			for _, rc := range results[i+1:] {
+				select {
+				case r := <-rc:
+					if err := fn(r); err != nil && err != ErrStopped {
+						return err
+					}
+				default:
+				}
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// ReadManifest reads the items of a manifest, one per line. Blank lines
+// and lines starting with # are skipped.
+func ReadManifest(r io.Reader) ([]string, error) {
+	var items []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 4096), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		items = append(items, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read manifest failed: %w", err)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,177 @@
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReadManifest(t *testing.T) {
+	manifest := "a.txt\n\n# comment\n  b dir/ \nQmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a\n"
+	items, err := ReadManifest(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatalf("Unexpected read manifest: %v", err)
+	}
+	expected := []string{"a.txt", "b dir/", "Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a"}
+	if !reflect.DeepEqual(items, expected) {
+		t.Errorf("Unexpected items, got %q instead of %q", items, expected)
+	}
+}
+
+// fakePinner fails the items of failing, and counts the calls.
+type fakePinner struct {
+	failing map[string]bool
+	calls   map[string]int
+}
+
+func (p *fakePinner) pin(item string) (string, error) {
+	p.calls[item]++
+	if p.failing[item] {
+		return "", errors.New("rate limited")
+	}
+	return "cid-" + item, nil
+}
+
+func TestRunResumes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	items := []string{"a", "b", "c", "a"}
+	p := &fakePinner{failing: map[string]bool{"b": true}, calls: map[string]int{}}
+
+	run := func() map[string]Result {
+		cp, err := OpenCheckpoint(path)
+		if err != nil {
+			t.Fatalf("Unexpected open checkpoint: %v", err)
+		}
+		defer cp.Close()
+
+		results := make(map[string]Result)
+		b := &Batch{Pin: p.pin, Checkpoint: cp, MaxAttempts: 3}
+		if _, err := b.Run(items, func(r Result) { results[r.Item] = r }); err != nil {
+			t.Fatalf("Unexpected run: %v", err)
+		}
+		return results
+	}
+
+	// The failing item is tried until it has no attempt left.
+	results := run()
+	if len(results) != 3 || results["a"].Cid != "cid-a" || results["b"].Err == nil || results["b"].Attempts != 3 {
+		t.Errorf("Unexpected results %+v", results)
+	}
+	if !reflect.DeepEqual(p.calls, map[string]int{"a": 1, "b": 3, "c": 1}) {
+		t.Errorf("Unexpected calls %v", p.calls)
+	}
+
+	// A second run skips the completed items and the exhausted ones.
+	p.calls = map[string]int{}
+	results = run()
+	if len(p.calls) != 0 {
+		t.Errorf("Unexpected calls %v", p.calls)
+	}
+	if r := results["a"]; !r.Skipped || r.Cid != "cid-a" {
+		t.Errorf("Unexpected result %+v", r)
+	}
+	if r := results["b"]; !r.Skipped || r.Err == nil {
+		t.Errorf("Unexpected result %+v", r)
+	}
+}
+
+func TestRunRetriesAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint")
+	p := &fakePinner{failing: map[string]bool{"b": true}, calls: map[string]int{}}
+
+	cp, err := OpenCheckpoint(path)
+	if err != nil {
+		t.Fatalf("Unexpected open checkpoint: %v", err)
+	}
+	failed, err := (&Batch{Pin: p.pin, Checkpoint: cp, MaxAttempts: 1}).Run([]string{"a", "b"}, nil)
+	cp.Close()
+	if err != nil || failed != 1 {
+		t.Fatalf("Unexpected run, %d failed: %v", failed, err)
+	}
+
+	// With a larger limit, the failed item is tried again, and succeeds.
+	p.failing["b"] = false
+	cp, err = OpenCheckpoint(path)
+	if err != nil {
+		t.Fatalf("Unexpected open checkpoint: %v", err)
+	}
+	defer cp.Close()
+	failed, err = (&Batch{Pin: p.pin, Checkpoint: cp, MaxAttempts: 2}).Run([]string{"a", "b"}, nil)
+	if err != nil || failed != 0 {
+		t.Fatalf("Unexpected run, %d failed: %v", failed, err)
+	}
+	if !reflect.DeepEqual(p.calls, map[string]int{"a": 1, "b": 2}) {
+		t.Errorf("Unexpected calls %v", p.calls)
+	}
+	if s, _ := cp.State("b"); !s.Done || s.Cid != "cid-b" || s.Attempts != 2 {
+		t.Errorf("Unexpected state %+v", s)
+	}
+}
+
+func TestRunJobs(t *testing.T) {
+	var items []string
+	for i := 0; i < 20; i++ {
+		items = append(items, fmt.Sprintf("item-%02d", i))
+	}
+
+	var mu sync.Mutex
+	var running, peak int
+	pin := func(item string) (string, error) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		// Later items finish first.
+		var n int
+		fmt.Sscanf(item, "item-%d", &n)
+		time.Sleep(time.Duration(len(items)-n) * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return "cid-" + item, nil
+	}
+
+	var got []string
+	b := &Batch{Pin: pin, Jobs: 4}
+	if _, err := b.Run(items, func(r Result) { got = append(got, r.Item) }); err != nil {
+		t.Fatalf("Unexpected run: %v", err)
+	}
+	if !reflect.DeepEqual(got, items) {
+		t.Errorf("Unexpected order of results %v", got)
+	}
+	if peak < 2 || peak > 4 {
+		t.Errorf("Unexpected %d items pinned at once", peak)
+	}
+}
+
+func TestRunFailFast(t *testing.T) {
+	items := []string{"a", "b", "c", "d"}
+	p := &fakePinner{failing: map[string]bool{"b": true}, calls: map[string]int{}}
+
+	var got []string
+	b := &Batch{Pin: p.pin, MaxAttempts: 2, FailFast: true}
+	failed, err := b.Run(items, func(r Result) { got = append(got, r.Item) })
+	if !errors.Is(err, ErrStopped) || failed != 1 {
+		t.Fatalf("Unexpected run, %d failed: %v", failed, err)
+	}
+	// The failing item is retried before the batch stops.
+	if !reflect.DeepEqual(got, []string{"a", "c", "d", "b"}) {
+		t.Errorf("Unexpected results %v", got)
+	}
+
+	got = nil
+	b.MaxAttempts = 1
+	if _, err := b.Run(items, func(r Result) { got = append(got, r.Item) }); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Unexpected run: %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("Unexpected results %v", got)
+	}
+}
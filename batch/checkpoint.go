@@ -0,0 +1,95 @@
+package batch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// State is the state of an item recorded in a checkpoint.
+type State struct {
+	Item     string    `json:"item"`
+	Done     bool      `json:"done"`
+	Cid      string    `json:"cid,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Attempts int       `json:"attempts"`
+	Time     time.Time `json:"time"`
+}
+
+// Checkpoint is a file recording the state of the items of a batch, one
+// JSON line per attempt, the last line of an item being its state. It is
+// safe for concurrent use.
+type Checkpoint struct {
+	mu     sync.Mutex
+	file   *os.File
+	states map[string]State
+}
+
+// OpenCheckpoint opens the checkpoint at path, creating it if it does not
+// exist.
+func OpenCheckpoint(path string) (*Checkpoint, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open checkpoint failed: %w", err)
+	}
+
+	c := &Checkpoint{file: f, states: make(map[string]State)}
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 4096), 1<<20)
+	for sc.Scan() {
+		var s State
+		// A line left incomplete by an interrupted write is skipped.
+		if err := json.Unmarshal(sc.Bytes(), &s); err != nil {
+			continue
+		}
+		c.states[s.Item] = s
+	}
+	if err := sc.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read checkpoint failed: %w", err)
+	}
+
+	return c, nil
+}
+
+// State returns the recorded state of item.
+func (c *Checkpoint) State(item string) (State, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.states[item]
+	return s, ok
+}
+
+// Record records the result of an attempt, and flushes it to disk.
+func (c *Checkpoint) Record(r Result) error {
+	s := State{Item: r.Item, Done: r.Err == nil, Cid: r.Cid, Attempts: r.Attempts, Time: time.Now().UTC()}
+	if r.Err != nil {
+		s.Error = r.Err.Error()
+	}
+	buf, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.file.Write(append(buf, '\n')); err != nil {
+		return fmt.Errorf("write checkpoint failed: %w", err)
+	}
+	if err := c.file.Sync(); err != nil {
+		return fmt.Errorf("write checkpoint failed: %w", err)
+	}
+	c.states[s.Item] = s
+
+	return nil
+}
+
+// Close closes the checkpoint file.
+func (c *Checkpoint) Close() error {
+	return c.file.Close()
+}
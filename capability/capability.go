@@ -0,0 +1,92 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package capability describes the features and the limits of the pinning
+services, so that unsupported requests are refused before any bytes are
+sent.
+*/
+package capability // import "github.com/wabarc/ipfs-pinner/capability"
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrUnsupported is returned for requests a pinning service does not
+	// support.
+	ErrUnsupported = errors.New("unsupported by the pinner")
+
+	// ErrTooLarge is returned for uploads exceeding a size limit of a
+	// pinning service.
+	ErrTooLarge = errors.New("exceeds the size limit of the pinner")
+)
+
+// The upload API shared by NFT.Storage and Web3.Storage takes up to
+// 100 MiB per request and 31 GiB per DAG, uploads are not split.
+const (
+	DotStorageRequestSize = 100 << 20
+	DotStorageTotalSize   = 31 << 30
+)
+
+// Capabilities describes what a pinning service supports through this
+// module. A zero size limit means there is no known limit.
+type Capabilities struct {
+	// PinHash reports whether content already on IPFS can be pinned by
+	// its CID.
+	PinHash bool
+	// Directory reports whether directories can be uploaded.
+	Directory bool
+	// CAR reports whether DAGs built locally are uploaded as CAR files.
+	CAR bool
+	// Metadata reports whether the UnixFS mode and mtime are kept.
+	Metadata bool
+	// Unpin reports whether pins can be removed.
+	Unpin bool
+	// Status reports whether the service tells if it holds a pin.
+	Status bool
+	// List reports whether the pins of the account can be listed.
+	List bool
+	// Names reports whether pins by CID carry a name and key-value
+	// metadata.
+	Names bool
+
+	// MaxRequestSize is the maximum size of the content of a request,
+	// in bytes.
+	MaxRequestSize int64
+	// MaxTotalSize is the maximum size of a pinned DAG, in bytes.
+	MaxTotalSize int64
+}
+
+// Request describes an upload, to be checked against Capabilities.
+type Request struct {
+	// Size is the size of the content, in bytes, or -1 if unknown.
+	Size int64
+
+	Directory bool
+	Metadata  bool
+}
+
+// Check returns an error wrapping ErrUnsupported or ErrTooLarge if the
+// request cannot succeed with the pinning service.
+func (c Capabilities) Check(req Request) error {
+	switch {
+	case req.Directory && !c.Directory:
+		return fmt.Errorf("directory: %w", ErrUnsupported)
+	case req.Metadata && !c.Metadata:
+		return fmt.Errorf("mode and mtime metadata: %w", ErrUnsupported)
+	}
+	if req.Size < 0 {
+		return nil
+	}
+	if c.MaxRequestSize > 0 && req.Size > c.MaxRequestSize {
+		return fmt.Errorf("%d bytes, more than %d bytes per request: %w", req.Size, c.MaxRequestSize, ErrTooLarge)
+	}
+	if c.MaxTotalSize > 0 && req.Size > c.MaxTotalSize {
+		return fmt.Errorf("%d bytes, more than %d bytes in total: %w", req.Size, c.MaxTotalSize, ErrTooLarge)
+	}
+
+	return nil
+}
@@ -0,0 +1,34 @@
+package capability
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	caps := Capabilities{Directory: true, MaxRequestSize: 100, MaxTotalSize: 1000}
+	tests := []struct {
+		name     string
+		caps     Capabilities
+		req      Request
+		expected error
+	}{
+		{"file", caps, Request{Size: 10}, nil},
+		{"unknown size", caps, Request{Size: -1}, nil},
+		{"directory", caps, Request{Size: 10, Directory: true}, nil},
+		{"metadata", caps, Request{Size: 10, Metadata: true}, ErrUnsupported},
+		{"directory unsupported", Capabilities{}, Request{Directory: true}, ErrUnsupported},
+		{"request too large", caps, Request{Size: 101}, ErrTooLarge},
+		{"total too large", Capabilities{MaxTotalSize: 1000}, Request{Size: 1001}, ErrTooLarge},
+		{"no limit", Capabilities{}, Request{Size: 1 << 40}, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.caps.Check(test.req)
+			if !errors.Is(err, test.expected) || (test.expected == nil && err != nil) {
+				t.Errorf("Unexpected error, got %v instead of %v", err, test.expected)
+			}
+		})
+	}
+}
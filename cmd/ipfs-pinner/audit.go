@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/wabarc/ipfs-pinner/audit"
+	"github.com/wabarc/ipfs-pinner/journal"
+)
+
+var auditCmd = &command{
+	name:    "audit",
+	summary: "Check that the pinners still hold the expected pins, and report missing, failed and extra ones.",
+	run:     runAudit,
+}
+
+func runAudit(fs *flag.FlagSet, args []string) error {
+	var (
+		pf pinnerFlags
+		of outputFlags
+
+		journalPath  string
+		expectedPath string
+		repin        bool
+	)
+	pf.register(fs)
+	of.register(fs)
+	fs.StringVar(&journalPath, "journal", "", "Journal file whose pins are expected, by pinner.")
+	fs.StringVar(&expectedPath, "expected", "", "File listing the expected CIDs, one per line optionally preceded by the pinner, - reads stdin.")
+	fs.BoolVar(&repin, "repin", false, "Pin the missing and failed CIDs again, by CID.")
+	_ = fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v: %w", fs.Args(), errUsage)
+	}
+	if journalPath == "" && expectedPath == "" {
+		return fmt.Errorf("-journal or -expected is required: %w", errUsage)
+	}
+	out, err := of.printer()
+	if err != nil {
+		return err
+	}
+	s, err := pf.resolve()
+	if err != nil {
+		return err
+	}
+
+	expected := make(map[string][]string)
+	if journalPath != "" {
+		j, err := journal.Open(journalPath)
+		if err != nil {
+			return err
+		}
+		// Pins of other accounts sharing the journal are not expected.
+		account := func(p string) string {
+			handler, err := pf.configFor(p)
+			if err != nil {
+				// The audit of the pinner reports the error.
+				return ""
+			}
+			return handler.Account()
+		}
+		for p, cids := range audit.FromJournal(j, account) {
+			expected[p] = append(expected[p], cids...)
+		}
+		j.Close()
+	}
+	if expectedPath != "" {
+		f := os.Stdin
+		if expectedPath != stdin {
+			if f, err = os.Open(expectedPath); err != nil {
+				return err
+			}
+			defer f.Close()
+		}
+		m, err := audit.ReadExpected(f, s.provider.value)
+		if err != nil {
+			return err
+		}
+		for p, cids := range m {
+			expected[p] = append(expected[p], cids...)
+		}
+	}
+
+	// An explicit pinner audits its pins only, including the extra pins if
+	// none is expected.
+	var providers []string
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "t" {
+			providers = []string{s.provider.value}
+		}
+	})
+	if providers == nil {
+		for p := range expected {
+			providers = append(providers, p)
+		}
+		sort.Strings(providers)
+	}
+
+	for _, p := range providers {
+		start := time.Now()
+		findings, err := auditPinner(&pf, p, expected[p], repin)
+		if err != nil {
+			r := newRecord(p, err, time.Since(start))
+			r.Provider = p
+			if err := out.result(r); err != nil {
+				return err
+			}
+			continue
+		}
+		d := time.Since(start) / time.Duration(len(findings)+1)
+		for _, f := range findings {
+			if err := out.result(findingRecord(f, d)); err != nil {
+				return err
+			}
+		}
+	}
+
+	var provider string
+	if len(providers) == 1 {
+		provider = providers[0]
+	}
+	if err := out.finish(provider, true); err != nil {
+		return err
+	}
+	return out.err()
+}
+
+// auditPinner audits the expected CIDs of a pinner.
+func auditPinner(pf *pinnerFlags, provider string, expected []string, repin bool) ([]audit.Finding, error) {
+	handler, err := pf.configFor(provider)
+	if err != nil {
+		return nil, err
+	}
+	a := &audit.Auditor{Config: handler, Repin: repin}
+	return a.Audit(expected)
+}
+
+// findingRecord returns the record of a finding, failed if it is a
+// problem. d is the share of the finding in the duration of the audit.
+func findingRecord(f audit.Finding, d time.Duration) record {
+	r := record{Type: "result", Path: f.Cid, Cid: f.Cid, Provider: f.Pinner, Status: f.State, Duration: d.Seconds()}
+	r.text = f.Cid + "  " + f.State
+	if f.Repinned {
+		r.Action = "repin"
+		r.text += ", repinned"
+	}
+	if f.Problem() {
+		r.ErrorKind = f.State
+		r.Error = f.State + " on " + f.Pinner
+		if f.Error != "" {
+			r.Error += ": " + f.Error
+		}
+	}
+	return r
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/wabarc/ipfs-pinner/file"
+	"github.com/wabarc/ipfs-pinner/gateway"
+	"github.com/wabarc/ipfs-pinner/unixfs"
+
+	pinner "github.com/wabarc/ipfs-pinner"
+)
+
+var cidCmd = &command{
+	name:    "cid",
+	args:    "<path>...",
+	summary: "Compute the CIDs of files or directories locally, without pinning.",
+	run:     runCid,
+}
+
+var verifyCmd = &command{
+	name:    "verify",
+	args:    "<cid> [path]",
+	summary: "Check that the pinner holds a CID, that a local path has the same CID, and that gateways serve it.",
+	run:     runVerify,
+}
+
+// gatewayFlags are the flags of the gateways checking that content is
+// retrievable.
+type gatewayFlags struct {
+	gateways patterns
+	format   string
+	timeout  time.Duration
+}
+
+func (gf *gatewayFlags) register(fs *flag.FlagSet) {
+	fs.Var(&gf.gateways, "gateway", "Trustless gateway checking that content is retrievable, such as https://ipfs.io, repeatable.")
+	fs.StringVar(&gf.format, "gateway-format", gateway.FormatCAR, "Response fetched from gateways, car checks the whole DAG, raw the root block only.")
+	fs.DurationVar(&gf.timeout, "gateway-timeout", gateway.DefaultTimeout, "Time given to gateways to serve content, retried with backoff.")
+}
+
+// verifier returns the verifier of the gateways, from the flags or the
+// comma-separated list of the environment, or nil if there is none.
+func (gf *gatewayFlags) verifier() (*gateway.Verifier, error) {
+	gateways := []string(gf.gateways)
+	if len(gateways) == 0 && os.Getenv(env("GATEWAYS")) != "" {
+		gateways = strings.Split(os.Getenv(env("GATEWAYS")), ",")
+	}
+	if gf.format != gateway.FormatCAR && gf.format != gateway.FormatRaw {
+		return nil, fmt.Errorf("invalid gateway format %s: %w", gf.format, errUsage)
+	}
+	if len(gateways) == 0 {
+		return nil, nil
+	}
+	for _, gw := range gateways {
+		if u, err := url.Parse(gw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid gateway %s: %w", gw, errUsage)
+		}
+	}
+	return &gateway.Verifier{Gateways: gateways, Format: gf.format, Timeout: gf.timeout}, nil
+}
+
+// sum returns the CID a pinner computes for the path, with CIDv0 unless
+// version is 1, and the size of its entries.
+func sum(path string, version int, opts []file.Option) (cid.Cid, int64, error) {
+	node, err := file.NewSerialFile(path, opts...)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	nd, err := node.Files()
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	defer nd.Close()
+
+	var uopts []unixfs.Option
+	if version == 0 {
+		uopts = append(uopts, unixfs.CidV0())
+	}
+	c, err := unixfs.Sum(nd, uopts...)
+	return c, node.Usage().Bytes, err
+}
+
+func runCid(fs *flag.FlagSet, args []string) error {
+	var (
+		ff      fileFlags
+		of      outputFlags
+		version int
+	)
+	ff.register(fs)
+	of.register(fs)
+	fs.IntVar(&version, "cid-version", 0, "CID version, 0 as Infura and Pinata, or 1 as NFT.Storage and Web3.Storage.")
+	_ = fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("file path is missing: %w", errUsage)
+	}
+	if version != 0 && version != 1 {
+		return fmt.Errorf("invalid cid version %d: %w", version, errUsage)
+	}
+	out, err := of.printer()
+	if err != nil {
+		return err
+	}
+	opts, err := ff.options()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range fs.Args() {
+		start := time.Now()
+		c, n, err := sum(path, version, opts)
+		r := newRecord(path, err, time.Since(start))
+		if err == nil {
+			r.Cid, r.Size = c.String(), n
+			r.text = r.Cid + "  " + path
+		}
+		if err := out.result(r); err != nil {
+			return err
+		}
+	}
+	if err := out.finish("", false); err != nil {
+		return err
+	}
+	return out.err()
+}
+
+func runVerify(fs *flag.FlagSet, args []string) error {
+	var (
+		pf      pinnerFlags
+		ff      fileFlags
+		gf      gatewayFlags
+		of      outputFlags
+		offline bool
+	)
+	pf.register(fs)
+	ff.register(fs)
+	gf.register(fs)
+	of.register(fs)
+	fs.BoolVar(&offline, "offline", false, "Do not ask the pinner whether it holds the CID.")
+	_ = fs.Parse(args)
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return fmt.Errorf("expected a cid and an optional path: %w", errUsage)
+	}
+	c, err := cid.Parse(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid cid %s: %w", fs.Arg(0), errUsage)
+	}
+	v, err := gf.verifier()
+	if err != nil {
+		return err
+	}
+	if offline && fs.NArg() == 1 && v == nil {
+		return fmt.Errorf("nothing to verify offline without a path or a gateway: %w", errUsage)
+	}
+	out, err := of.printer()
+	if err != nil {
+		return err
+	}
+	var (
+		handler  *pinner.Config
+		provider string
+	)
+	if !offline {
+		if handler, err = pf.config(); err != nil {
+			return err
+		}
+		provider = handler.Pinner
+	}
+	opts, err := ff.options()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	err = verify(c, fs.Arg(1), opts, handler)
+	var res gateway.Result
+	if err == nil && v != nil {
+		res, err = v.Verify(context.Background(), c)
+	}
+	r := newRecord(c.String(), err, time.Since(start))
+	r.Cid, r.Provider, r.Gateway = c.String(), provider, res.Gateway
+	if err == nil {
+		r.Status = "verified"
+		r.text = c.String() + "  verified"
+		if v != nil {
+			r.Status = "retrievable"
+			r.text = fmt.Sprintf("%s  retrievable from %s, %d blocks", c, res.Gateway, res.Blocks)
+		}
+	}
+	if err := out.result(r); err != nil {
+		return err
+	}
+	if err := out.finish(provider, false); err != nil {
+		return err
+	}
+	return out.err()
+}
+
+// verify checks that path, if not empty, has the CID c, and that the
+// pinner of handler holds c, unless handler is nil.
+func verify(c cid.Cid, path string, opts []file.Option, handler *pinner.Config) error {
+	if path != "" {
+		local, _, err := sum(path, int(c.Version()), opts)
+		if err != nil {
+			return err
+		}
+		if !local.Equals(c) {
+			return fmt.Errorf("%s has cid %s, not %s", path, local, c)
+		}
+	}
+	if handler == nil {
+		return nil
+	}
+
+	pinned, err := handler.Pinned(c.String())
+	if err != nil {
+		return err
+	}
+	if !pinned {
+		return errors.New(c.String() + " is not pinned by " + handler.Pinner)
+	}
+	return nil
+}
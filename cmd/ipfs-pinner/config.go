@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/wabarc/ipfs-pinner/version"
+)
+
+var configCmd = &command{
+	name:    "config",
+	summary: "Print the pinner settings in effect, where they come from, and the capabilities.",
+	run:     runConfig,
+}
+
+var versionCmd = &command{
+	name:    "version",
+	summary: "Print the version of ipfs-pinner.",
+	run:     runVersion,
+}
+
+func runConfig(fs *flag.FlagSet, args []string) error {
+	var pf pinnerFlags
+	pf.register(fs)
+	_ = fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v: %w", fs.Args(), errUsage)
+	}
+
+	s, err := pf.resolve()
+	if err != nil {
+		return err
+	}
+	handler, err := s.config()
+	if err != nil {
+		return err
+	}
+	caps, err := handler.Capabilities()
+	if err != nil {
+		return err
+	}
+
+	var supported []string
+	for _, c := range []struct {
+		name string
+		ok   bool
+	}{
+		{"pin-hash", caps.PinHash},
+		{"directory", caps.Directory},
+		{"car", caps.CAR},
+		{"metadata", caps.Metadata},
+		{"unpin", caps.Unpin},
+		{"status", caps.Status},
+		{"list", caps.List},
+		{"names", caps.Names},
+	} {
+		if c.ok {
+			supported = append(supported, c.name)
+		}
+	}
+
+	if s.path != "" {
+		fmt.Fprintf(os.Stdout, "config: %s\n", s.path)
+	}
+	if s.profile != nil {
+		fmt.Fprintf(os.Stdout, "profile: %s\n", s.profile.Name)
+	}
+	show := func(name, value string, from setting) {
+		fmt.Fprintf(os.Stdout, "%s: %s (%s)\n", name, value, from.source)
+	}
+	show("pinner", s.provider.value, s.provider)
+	show("apikey", mask(s.apikey.value), s.apikey)
+	show("secret", mask(s.secret.value), s.secret)
+	if s.endpoint.value != "" {
+		show("endpoint", s.endpoint.value, s.endpoint)
+	}
+	show("http retries", s.retries.value, s.retries)
+	show("rate limit", s.limits.value, s.limits)
+	fmt.Fprintf(os.Stdout, "capabilities: %s\n", strings.Join(supported, ", "))
+	if caps.MaxRequestSize > 0 {
+		fmt.Fprintf(os.Stdout, "max request size: %d\n", caps.MaxRequestSize)
+	}
+	if caps.MaxTotalSize > 0 {
+		fmt.Fprintf(os.Stdout, "max total size: %d\n", caps.MaxTotalSize)
+	}
+	return nil
+}
+
+// mask hides all but the first characters of a credential.
+func mask(s string) string {
+	switch {
+	case s == "":
+		return "(unset)"
+	case len(s) <= 8:
+		return strings.Repeat("*", len(s))
+	}
+	return s[:4] + strings.Repeat("*", len(s)-4)
+}
+
+func runVersion(fs *flag.FlagSet, args []string) error {
+	_ = fs.Parse(args)
+
+	fmt.Fprintf(os.Stdout, "ipfs-pinner %s\n", version.Version)
+	fmt.Fprintf(os.Stdout, "commit: %s\n", version.Commit)
+	fmt.Fprintf(os.Stdout, "build date: %s\n", version.BuildDate)
+	fmt.Fprintf(os.Stdout, "go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	return nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/wabarc/ipfs-pinner/crypt"
+)
+
+var decryptCmd = &command{
+	name:    "decrypt",
+	args:    "<cid|path|->",
+	summary: "Decrypt content pinned with -encrypt-to or -passphrase, fetched by CID through gateways or a Kubo node, or read locally.",
+	run:     runDecrypt,
+}
+
+// cryptFlags are the flags of the keys content is encrypted to, or
+// decrypted with.
+type cryptFlags struct {
+	keys       patterns
+	passphrase bool
+}
+
+// passphrase returns the passphrase of the environment.
+func passphrase() (*crypt.Passphrase, error) {
+	secret := os.Getenv(env("PASSPHRASE"))
+	if secret == "" {
+		return nil, fmt.Errorf("%s is not set: %w", env("PASSPHRASE"), errUsage)
+	}
+	return &crypt.Passphrase{Secret: secret}, nil
+}
+
+func (cf *cryptFlags) registerRecipients(fs *flag.FlagSet) {
+	fs.Var(&cf.keys, "encrypt-to", "Encrypt content to the age1... public key before pinning it, repeatable.")
+	fs.BoolVar(&cf.passphrase, "passphrase", false, "Encrypt content with the passphrase of "+env("PASSPHRASE")+" before pinning it.")
+}
+
+// recipients returns the recipients of the flags, or nil if content is not
+// encrypted.
+func (cf *cryptFlags) recipients() ([]crypt.Recipient, error) {
+	if cf.passphrase {
+		if len(cf.keys) > 0 {
+			return nil, fmt.Errorf("-passphrase cannot be combined with -encrypt-to: %w", errUsage)
+		}
+		p, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		return []crypt.Recipient{p}, nil
+	}
+	var recipients []crypt.Recipient
+	for _, key := range cf.keys {
+		r, err := crypt.ParseRecipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", err, errUsage)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, nil
+}
+
+func (cf *cryptFlags) registerIdentities(fs *flag.FlagSet) {
+	fs.Var(&cf.keys, "identity", "File of AGE-SECRET-KEY-1... private keys, as written by age-keygen, repeatable.")
+	fs.BoolVar(&cf.passphrase, "passphrase", false, "Decrypt content with the passphrase of "+env("PASSPHRASE")+".")
+}
+
+// identities returns the identities of the flags.
+func (cf *cryptFlags) identities() ([]crypt.Identity, error) {
+	var ids []crypt.Identity
+	if cf.passphrase {
+		p, err := passphrase()
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, p)
+	}
+	for _, name := range cf.keys {
+		b, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := crypt.ParseIdentities(string(b))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		ids = append(ids, parsed...)
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("identity is missing: %w", errUsage)
+	}
+	return ids, nil
+}
+
+func runDecrypt(fs *flag.FlagSet, args []string) error {
+	var (
+		cf     cryptFlags
+		sf     sourceFlags
+		output string
+	)
+	cf.registerIdentities(fs)
+	sf.register(fs)
+	fs.StringVar(&output, "o", "", "File the content is written to, stdout if empty.")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("a cid or a path is expected: %w", errUsage)
+	}
+	src := fs.Arg(0)
+	ids, err := cf.identities()
+	if err != nil {
+		return err
+	}
+
+	var r io.Reader
+	switch {
+	case isCid(src):
+		handler, err := sf.config()
+		if err != nil {
+			return err
+		}
+		handler.Identities = ids
+		rc, err := handler.Fetch(context.Background(), src)
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		r = rc
+	default:
+		in := os.Stdin
+		if src != stdin {
+			if in, err = os.Open(src); err != nil {
+				return err
+			}
+			defer in.Close()
+		}
+		if r, err = crypt.Decrypt(in, ids...); err != nil {
+			return err
+		}
+	}
+
+	if output == "" {
+		_, err = io.Copy(os.Stdout, r)
+		return err
+	}
+	// Content failing authentication is not left behind.
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(output)
+		return err
+	}
+	return nil
+}
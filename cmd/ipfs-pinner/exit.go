@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Exit codes of the CLI.
+const (
+	exitOK = 0
+	// exitFailure is returned when the command failed, or every item did.
+	exitFailure = 1
+	exitUsage   = 2
+	// exitPartial is returned when some items failed and others did not.
+	exitPartial     = 3
+	exitAuth        = 4
+	exitRateLimited = 5
+)
+
+// errFailed is wrapped by the errors of commands whose items failed, the
+// errors of the items are written with their records.
+var errFailed = errors.New("failed")
+
+// failedError reports the items of a command that failed.
+type failedError struct {
+	failed, total int
+	// kinds counts the failed items by kind of error.
+	kinds map[string]int
+}
+
+func (e *failedError) Error() string {
+	return fmt.Sprintf("%d of %d items %v", e.failed, e.total, errFailed)
+}
+
+func (e *failedError) Unwrap() error {
+	return errFailed
+}
+
+// exitCode returns the exit code of a command returning err. Failed
+// authentication and rate limiting take precedence over the number of
+// failed items, as they call for another action than running again.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var fe *failedError
+	if errors.As(err, &fe) {
+		switch {
+		case fe.kinds["auth"] > 0:
+			return exitAuth
+		case fe.kinds["rate_limited"] > 0:
+			return exitRateLimited
+		case fe.failed < fe.total:
+			return exitPartial
+		}
+		return exitFailure
+	}
+	switch errorKind(err) {
+	case "usage":
+		return exitUsage
+	case "auth":
+		return exitAuth
+	case "rate_limited":
+		return exitRateLimited
+	}
+	return exitFailure
+}
+
+// formatKinds formats the number of failed items by kind, such as
+// "auth: 1, server: 2".
+func formatKinds(kinds map[string]int) string {
+	names := make([]string, 0, len(kinds))
+	for kind := range kinds {
+		names = append(names, kind)
+	}
+	sort.Strings(names)
+	for i, kind := range names {
+		names[i] = fmt.Sprintf("%s: %d", kind, kinds[kind])
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	pinner "github.com/wabarc/ipfs-pinner"
+	httpretry "github.com/wabarc/ipfs-pinner/http"
+)
+
+func TestExitCode(t *testing.T) {
+	failed := func(failed, total int, kinds ...string) error {
+		e := &failedError{failed: failed, total: total, kinds: map[string]int{}}
+		for _, kind := range kinds {
+			e.kinds[kind]++
+		}
+		return e
+	}
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{nil, exitOK},
+		{failed(1, 3, "server"), exitPartial},
+		{failed(2, 2, "server", "network"), exitFailure},
+		{failed(2, 3, "rate_limited", "server"), exitRateLimited},
+		{failed(2, 3, "rate_limited", "auth"), exitAuth},
+		{fmt.Errorf("invalid jobs 0: %w", errUsage), exitUsage},
+		{fmt.Errorf("%w: nope", pinner.ErrPinner), exitUsage},
+		{fmt.Errorf("pinata: %w", &httpretry.StatusError{StatusCode: http.StatusForbidden}), exitAuth},
+		{errors.New("unexpected"), exitFailure},
+	}
+	for _, test := range tests {
+		if code := exitCode(test.err); code != test.code {
+			t.Errorf("Unexpected exit code of %v, got %d instead of %d", test.err, code, test.code)
+		}
+	}
+	if err := failed(1, 3); !errors.Is(err, errFailed) || err.Error() != "1 of 3 items failed" {
+		t.Errorf("Unexpected failed error %v", err)
+	}
+}
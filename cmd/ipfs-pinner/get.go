@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/wabarc/ipfs-pinner/gateway"
+
+	pinner "github.com/wabarc/ipfs-pinner"
+)
+
+var getCmd = &command{
+	name:    "get",
+	args:    "<cid>",
+	summary: "Download a file or directory by CID through gateways or a Kubo node, verifying every block.",
+	run:     runGet,
+}
+
+// sourceFlags are the flags of the gateways or the Kubo node content is
+// retrieved from.
+type sourceFlags struct {
+	gatewayFlags
+
+	kubo string
+}
+
+func (sf *sourceFlags) register(fs *flag.FlagSet) {
+	sf.gatewayFlags.register(fs)
+	fs.StringVar(&sf.kubo, "kubo", "", "Kubo RPC API content is retrieved from instead of gateways, such as http://127.0.0.1:5001.")
+}
+
+// config returns a configuration retrieving content from the Kubo node of
+// the flags or the environment, else from the gateways.
+func (sf *sourceFlags) config() (*pinner.Config, error) {
+	endpoint := sf.kubo
+	if endpoint == "" {
+		endpoint = os.Getenv(env("KUBO"))
+	}
+	cfg := &pinner.Config{}
+	if endpoint != "" {
+		if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid kubo endpoint %s: %w", endpoint, errUsage)
+		}
+		cfg.Kubo = &gateway.Kubo{Endpoint: endpoint}
+		return cfg, nil
+	}
+
+	v, err := sf.verifier()
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, fmt.Errorf("a gateway or a kubo endpoint is needed: %w", errUsage)
+	}
+	cfg.Verifier = v
+	return cfg, nil
+}
+
+func runGet(fs *flag.FlagSet, args []string) error {
+	var (
+		sf     sourceFlags
+		of     outputFlags
+		output string
+	)
+	sf.register(fs)
+	of.register(fs)
+	fs.StringVar(&output, "o", "", "Path the file or directory is written to, the CID if empty.")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("a cid is expected: %w", errUsage)
+	}
+	c, err := cid.Parse(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid cid %s: %w", fs.Arg(0), errUsage)
+	}
+	if output == "" {
+		output = c.String()
+	}
+	handler, err := sf.config()
+	if err != nil {
+		return err
+	}
+	out, err := of.printer()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	ct, err := handler.Get(context.Background(), c.String())
+	if err == nil {
+		err = ct.Extract(output)
+		ct.Close()
+	}
+	r := newRecord(output, err, time.Since(start))
+	r.Cid = c.String()
+	if err == nil {
+		r.Gateway, r.Size = ct.Result.Gateway, ct.Result.Size
+		r.text = c.String() + "  " + output
+	}
+	if err := out.result(r); err != nil {
+		return err
+	}
+	if err := out.finish("", false); err != nil {
+		return err
+	}
+	return out.err()
+}
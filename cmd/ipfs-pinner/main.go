@@ -1,122 +1,133 @@
 package main
 
 import (
-	"bytes"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"strings"
 
 	"github.com/ipfs/go-cid"
-
-	pinner "github.com/wabarc/ipfs-pinner"
 )
 
-type pin struct {
-	path  string
-	isCid bool
+// command is a subcommand of the CLI.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(fs *flag.FlagSet, args []string) error
 }
 
-func main() {
-	var (
-		target string
-		apikey string
-		secret string
-	)
-
-	flag.Usage = func() {
-		usage := `A CLI tool for pin files or directory to IPFS.
-
-Usage:
-
-  ipfs-pinner [flags] [path]...
-
-Flags:
-`
-		fmt.Fprintln(os.Stdout, usage)
-		flag.PrintDefaults()
-		fmt.Fprintln(os.Stdout, "")
-	}
+// errUsage is returned by commands called with invalid arguments, the
+// usage of the command is printed instead of the error.
+var errUsage = errors.New("invalid arguments")
+
+var commands = []*command{
+	pinCmd,
+	pinHashCmd,
+	unpinCmd,
+	lsCmd,
+	statusCmd,
+	cidCmd,
+	verifyCmd,
+	auditCmd,
+	migrateCmd,
+	getCmd,
+	decryptCmd,
+	watchCmd,
+	serveCmd,
+	configCmd,
+	versionCmd,
+}
 
-	flag.StringVar(&target, "t", "infura", "IPFS pinner, supports pinners: infura, pinata, nftstorage, web3storage.")
-	flag.StringVar(&apikey, "u", "", "Pinner apikey or username.")
-	flag.StringVar(&secret, "p", "", "Pinner sceret or password.")
-	flag.Parse()
-
-	files := flag.Args()
-	target = strings.ToLower(target)
-	switch target {
-	case pinner.Pinata:
-		if apikey == "" {
-			apikey = os.Getenv("IPFS_PINNER_PINATA_API_KEY")
-		}
-		if secret == "" {
-			secret = os.Getenv("IPFS_PINNER_PINATA_SECRET_API_KEY")
-		}
-	case pinner.NFTStorage, pinner.Web3Storage:
-		if apikey == "" {
-			fmt.Println(target + " requires an apikey.")
-			os.Exit(1)
+func main() {
+	args := os.Args[1:]
+	if len(args) > 0 {
+		switch args[0] {
+		case "help", "-h", "-help", "--help":
+			if len(args) > 1 {
+				if cmd := lookup(args[1]); cmd != nil {
+					run(cmd, []string{"-h"})
+				}
+			}
+			usage(os.Stdout)
+			os.Exit(exitOK)
 		}
-	case pinner.Infura:
-		// Permit request without authorization
-	default:
-		flag.Usage()
-		os.Exit(0)
 	}
-	if len(files) < 1 {
-		flag.Usage()
+	if len(args) == 0 {
+		usage(os.Stdout)
 		fmt.Println("file path is missing.")
-		os.Exit(1)
+		os.Exit(exitUsage)
 	}
 
-	pins := []pin{}
-	for _, p := range files {
-		pins = append(pins, pin{
-			path:  p,
-			isCid: isCid(p),
-		})
+	// `ipfs-pinner [flags] [path]...` is an alias of the pin command.
+	if cmd := lookup(args[0]); cmd != nil {
+		run(cmd, args[1:])
 	}
+	run(pinCmd, args)
+}
 
-	mustExist(pins)
+func lookup(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
 
-	handler := pinner.Config{
-		Pinner: target,
-		Apikey: apikey,
-		Secret: secret,
+func run(cmd *command, args []string) {
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "%s\n\nUsage:\n\n  ipfs-pinner %s [flags] %s\n\nFlags:\n\n", cmd.summary, cmd.name, cmd.args)
+		fs.PrintDefaults()
+		fmt.Fprintln(fs.Output(), "")
 	}
-	var cid string
-	var err error
-	for _, p := range pins {
-		if p.isCid {
-			cid, err = handler.PinHash(p.path)
-		} else {
-			cid, err = handler.Pin(p.path)
-		}
+	err := cmd.run(fs, args)
+	switch {
+	case errors.Is(err, errUsage):
+		fs.Usage()
+		fmt.Fprintf(os.Stderr, "ipfs-pinner %s: %v\n", cmd.name, err)
+	case errors.Is(err, errFailed):
+		// The failed items are written with the summary.
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "ipfs-pinner %s: %v\n", cmd.name, err)
+	}
+	os.Exit(exitCode(err))
+}
 
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "ipfs-pinner: %v\n", err)
-		} else {
-			fmt.Fprintf(os.Stdout, "%s  %s\n", cid, p.path)
-		}
+func usage(w io.Writer) {
+	fmt.Fprint(w, `A CLI tool for pin files or directory to IPFS.
+
+Usage:
+
+  ipfs-pinner <command> [flags] [args]...
+  ipfs-pinner [flags] [path]...
+
+Commands:
+
+`)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
 	}
+	fmt.Fprint(w, `
+Without a command, the arguments are given to the pin command. Run
+'ipfs-pinner help <command>' for the flags of a command.
+
+`)
 }
 
-func mustExist(path []pin) {
-	b := &bytes.Buffer{}
-	for _, p := range path {
-		if p.isCid {
-			continue
-		}
-		_, err := os.Stat(p.path)
-		if _, ok := err.(*os.PathError); ok {
-			fmt.Fprintln(b, err)
-		}
+// cids parses the arguments as CIDs.
+func cids(args []string) ([]string, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("cid is missing: %w", errUsage)
 	}
-	if b.Len() > 0 {
-		fmt.Println(b.String())
-		os.Exit(1)
+	for _, arg := range args {
+		if !isCid(arg) {
+			return nil, fmt.Errorf("invalid cid %s: %w", arg, errUsage)
+		}
 	}
+	return args, nil
 }
 
 func isCid(s string) bool {
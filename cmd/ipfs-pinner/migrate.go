@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/wabarc/ipfs-pinner/batch"
+	"github.com/wabarc/ipfs-pinner/journal"
+	"github.com/wabarc/ipfs-pinner/migrate"
+	"github.com/wabarc/ipfs-pinner/pinning"
+)
+
+var migrateCmd = &command{
+	name:    "migrate",
+	summary: "Move the pins of a pinner to another one, by CID or through gateways.",
+	run:     runMigrate,
+}
+
+func runMigrate(fs *flag.FlagSet, args []string) error {
+	var (
+		pf pinnerFlags
+		gf gatewayFlags
+		of outputFlags
+
+		from, to    string
+		checkpoint  string
+		journalPath string
+		retries     int
+		jobs        int
+		failFast    bool
+		unpinSource bool
+	)
+	pf.register(fs)
+	gf.register(fs)
+	of.register(fs)
+	fs.StringVar(&from, "from", "", "Pinner whose pins are migrated, with the credentials of its environment variables or profile.")
+	fs.StringVar(&to, "to", "", "Pinner the pins are migrated to, -u, -p and -endpoint apply to it.")
+	fs.StringVar(&checkpoint, "checkpoint", "", "File recording migrated pins, completed pins are skipped on restart.")
+	fs.IntVar(&retries, "retries", batch.DefaultMaxAttempts-1, "Times a failed pin is tried again, across restarts sharing the checkpoint.")
+	fs.IntVar(&jobs, "jobs", 1, "Number of pins migrated at once.")
+	fs.IntVar(&jobs, "j", 1, "Shorthand for -jobs.")
+	fs.BoolVar(&failFast, "fail-fast", false, "Stop at the first pin failing with no attempt left.")
+	fs.BoolVar(&unpinSource, "unpin-source", false, "Unpin from the source once the destination holds the content and gateways serve it.")
+	fs.StringVar(&journalPath, "journal", "", "Journal file whose entries of the pins unpinned from the source are removed.")
+	_ = fs.Parse(args)
+
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v: %w", fs.Args(), errUsage)
+	}
+	if from == "" || to == "" {
+		return fmt.Errorf("-from and -to are required: %w", errUsage)
+	}
+	if from == to {
+		return fmt.Errorf("cannot migrate %s to itself: %w", from, errUsage)
+	}
+	if jobs < 1 {
+		return fmt.Errorf("invalid jobs %d: %w", jobs, errUsage)
+	}
+	out, err := of.printer()
+	if err != nil {
+		return err
+	}
+	// The destination is the selected pinner, so that the credential
+	// flags apply to it.
+	_ = fs.Set("t", to)
+	src, err := pf.configFor(from)
+	if err != nil {
+		return err
+	}
+	dst, err := pf.config()
+	if err != nil {
+		return err
+	}
+	m := &migrate.Migrator{From: src, To: dst, UnpinSource: unpinSource}
+	if m.Gateway, err = gf.verifier(); err != nil {
+		return err
+	}
+	if unpinSource && m.Gateway == nil {
+		return fmt.Errorf("-unpin-source requires a gateway to verify the destination: %w", errUsage)
+	}
+	if journalPath != "" {
+		j, err := journal.Open(journalPath)
+		if err != nil {
+			return err
+		}
+		defer j.Close()
+		src.Journal = j
+	}
+
+	pins, err := m.Pins()
+	if err != nil {
+		return err
+	}
+	byCid := make(map[string]pinning.Pin, len(pins))
+	items := make([]string, 0, len(pins))
+	for _, p := range pins {
+		byCid[p.Cid] = p
+		items = append(items, p.Cid)
+	}
+
+	b := &batch.Batch{
+		Pin: func(item string) (string, error) {
+			return m.Migrate(context.Background(), byCid[item])
+		},
+		MaxAttempts: retries + 1,
+		Jobs:        jobs,
+		FailFast:    failFast,
+	}
+	if checkpoint != "" {
+		cp, err := batch.OpenCheckpoint(checkpoint)
+		if err != nil {
+			return err
+		}
+		defer cp.Close()
+		b.Checkpoint = cp
+	}
+
+	var reportErr error
+	_, runErr := b.Run(items, func(res batch.Result) {
+		r := newRecord(res.Item, res.Err, res.Duration)
+		r.Cid, r.Provider, r.Skipped = res.Cid, dst.Pinner, res.Skipped
+		r.text = res.Item + "  " + dst.Pinner
+		if name := byCid[res.Item].Name; name != "" {
+			r.text += "  " + name
+		}
+		if unpinSource && res.Err == nil && !res.Skipped {
+			r.Action = "unpin"
+		}
+		if err := out.result(r); err != nil && reportErr == nil {
+			reportErr = err
+		}
+	})
+	if errors.Is(runErr, batch.ErrStopped) {
+		fmt.Fprintf(os.Stderr, "ipfs-pinner: %v\n", runErr)
+		runErr = nil
+	}
+	if reportErr != nil {
+		return reportErr
+	}
+	if err := out.finish(dst.Pinner, true); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return runErr
+	}
+	return out.err()
+}
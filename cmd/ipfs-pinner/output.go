@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/wabarc/ipfs-pinner/capability"
+	"github.com/wabarc/ipfs-pinner/gateway"
+	"github.com/wabarc/ipfs-pinner/migrate"
+	"github.com/wabarc/ipfs-pinner/pkg/pinata"
+
+	pinner "github.com/wabarc/ipfs-pinner"
+	httpretry "github.com/wabarc/ipfs-pinner/http"
+)
+
+// Output formats.
+const (
+	formatText     = "text"
+	formatJSON     = "json"
+	formatNDJSON   = "ndjson"
+	formatTemplate = "template"
+)
+
+// record is the outcome of an item given to a command.
+type record struct {
+	Type      string  `json:"type"`
+	Path      string  `json:"path"`
+	Cid       string  `json:"cid,omitempty"`
+	Key       string  `json:"key,omitempty"`
+	Provider  string  `json:"provider,omitempty"`
+	Size      int64   `json:"size,omitempty"`
+	Status    string  `json:"status,omitempty"`
+	Gateway   string  `json:"gateway,omitempty"`
+	Skipped   bool    `json:"skipped,omitempty"`
+	Time      string  `json:"time,omitempty"`
+	Action    string  `json:"action,omitempty"`
+	Duration  float64 `json:"duration"`
+	Error     string  `json:"error,omitempty"`
+	ErrorKind string  `json:"error_kind,omitempty"`
+
+	// text is the line printed in the text format, the error is printed
+	// instead if any.
+	text string
+}
+
+// summary is the last record of a run.
+type summary struct {
+	Type      string  `json:"type"`
+	Provider  string  `json:"provider,omitempty"`
+	Total     int     `json:"total"`
+	Succeeded int     `json:"succeeded"`
+	Failed    int     `json:"failed"`
+	Skipped   int     `json:"skipped"`
+	Duration  float64 `json:"duration"`
+}
+
+// newRecord returns the record of an item, classifying err.
+func newRecord(path string, err error, d time.Duration) record {
+	r := record{Type: "result", Path: path, Duration: d.Seconds()}
+	if err != nil {
+		r.Error = err.Error()
+		r.ErrorKind = errorKind(err)
+	}
+	return r
+}
+
+// errorKind classifies an error for scripts.
+func errorKind(err error) string {
+	var (
+		se *httpretry.StatusError
+		ue *url.Error
+		ne net.Error
+	)
+	switch {
+	case errors.Is(err, errUsage), errors.Is(err, pinner.ErrPinner):
+		return "usage"
+	case errors.Is(err, capability.ErrUnsupported):
+		return "unsupported"
+	case errors.Is(err, capability.ErrTooLarge):
+		return "too_large"
+	case errors.Is(err, os.ErrNotExist):
+		return "not_found"
+	case errors.Is(err, gateway.ErrUnretrievable):
+		return "unretrievable"
+	case errors.Is(err, migrate.ErrNotVerified):
+		return "unverified"
+	case errors.Is(err, pinata.ErrPinJobFailed):
+		return "pin_failed"
+	case errors.As(err, &se):
+		switch {
+		case se.StatusCode == http.StatusUnauthorized, se.StatusCode == http.StatusForbidden:
+			return "auth"
+		case se.StatusCode == http.StatusTooManyRequests:
+			return "rate_limited"
+		case se.StatusCode >= http.StatusInternalServerError:
+			return "server"
+		}
+		return "request"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &ue), errors.As(err, &ne):
+		return "network"
+	}
+	return "other"
+}
+
+// outputFlags are the flags selecting the output format.
+type outputFlags struct {
+	format   string
+	template string
+}
+
+func (of *outputFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&of.format, "output", formatText, "Output format, one of: text, json, ndjson, template.")
+	fs.StringVar(&of.template, "template", "", "Go template applied to every record with -output template, such as '{{.Cid}} {{.Path}}'.")
+}
+
+// printer returns a printer writing records in the selected format.
+func (of *outputFlags) printer() (*printer, error) {
+	p := &printer{format: of.format, w: os.Stdout, start: time.Now()}
+	switch of.format {
+	case formatText, formatJSON, formatNDJSON:
+		if of.template != "" {
+			return nil, fmt.Errorf("-template requires -output template: %w", errUsage)
+		}
+	case formatTemplate:
+		if of.template == "" {
+			return nil, fmt.Errorf("-output template requires -template: %w", errUsage)
+		}
+		tmpl, err := template.New("output").Parse(of.template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %v: %w", err, errUsage)
+		}
+		p.tmpl = tmpl
+	default:
+		return nil, fmt.Errorf("invalid output format %s: %w", of.format, errUsage)
+	}
+	return p, nil
+}
+
+// printer writes records, as soon as they are known except with the json
+// format, which writes a single document once done.
+type printer struct {
+	format string
+	tmpl   *template.Template
+	w      io.Writer
+	start  time.Time
+
+	// listing reports whether the emitted values are a listing, written
+	// without summary.
+	listing bool
+	items   []interface{}
+	summary summary
+	// kinds counts the failed items by kind of error.
+	kinds map[string]int
+}
+
+// result writes the record of an item and counts it in the summary.
+func (p *printer) result(r record) error {
+	p.summary.Total++
+	switch {
+	case r.Error != "":
+		p.summary.Failed++
+		if p.kinds == nil {
+			p.kinds = make(map[string]int)
+		}
+		p.kinds[r.ErrorKind]++
+	case r.Skipped:
+		p.summary.Skipped++
+	default:
+		p.summary.Succeeded++
+	}
+
+	if p.format == formatText {
+		switch {
+		case r.Error != "":
+			fmt.Fprintf(os.Stderr, "ipfs-pinner: %s: %s\n", r.Path, r.Error)
+		case r.Skipped:
+		default:
+			fmt.Fprintln(p.w, r.text)
+		}
+		return nil
+	}
+	return p.emit(r)
+}
+
+// emit writes v, a record or any value of a listing.
+func (p *printer) emit(v interface{}) error {
+	switch p.format {
+	case formatJSON:
+		p.items = append(p.items, v)
+		return nil
+	case formatNDJSON:
+		return json.NewEncoder(p.w).Encode(v)
+	case formatTemplate:
+		var b strings.Builder
+		if err := p.tmpl.Execute(&b, v); err != nil {
+			return err
+		}
+		s := b.String()
+		if !strings.HasSuffix(s, "\n") {
+			s += "\n"
+		}
+		_, err := io.WriteString(p.w, s)
+		return err
+	}
+	return nil
+}
+
+// finish writes the summary of the results, unless listing, and the
+// document of the json format. With the text format, the summary is only
+// written to stderr if verbose is set or items failed.
+func (p *printer) finish(provider string, verbose bool) error {
+	p.summary.Type = "summary"
+	p.summary.Provider = provider
+	p.summary.Duration = time.Since(p.start).Seconds()
+
+	switch p.format {
+	case formatText:
+		if verbose || p.summary.Failed > 0 {
+			fmt.Fprintf(os.Stderr, "ipfs-pinner: %d items, %d succeeded, %d already done, %d failed", p.summary.Total, p.summary.Succeeded, p.summary.Skipped, p.summary.Failed)
+			if p.summary.Failed > 0 {
+				fmt.Fprintf(os.Stderr, " (%s)", formatKinds(p.kinds))
+			}
+			fmt.Fprintln(os.Stderr)
+		}
+		return nil
+	case formatJSON:
+		enc := json.NewEncoder(p.w)
+		enc.SetIndent("", "  ")
+		items := p.items
+		if items == nil {
+			items = []interface{}{}
+		}
+		if p.listing {
+			return enc.Encode(items)
+		}
+		return enc.Encode(struct {
+			Results []interface{} `json:"results"`
+			Summary summary       `json:"summary"`
+		}{items, p.summary})
+	case formatNDJSON:
+		if p.listing {
+			return nil
+		}
+		return json.NewEncoder(p.w).Encode(p.summary)
+	}
+	return nil
+}
+
+// err returns a *failedError if any result failed.
+func (p *printer) err() error {
+	if p.summary.Failed > 0 {
+		return &failedError{failed: p.summary.Failed, total: p.summary.Total, kinds: p.kinds}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/wabarc/ipfs-pinner/capability"
+	"github.com/wabarc/ipfs-pinner/pkg/pinata"
+
+	httpretry "github.com/wabarc/ipfs-pinner/http"
+)
+
+func TestErrorKind(t *testing.T) {
+	status := func(code int) error {
+		return &httpretry.StatusError{StatusCode: code, Status: http.StatusText(code)}
+	}
+	tests := []struct {
+		err  error
+		kind string
+	}{
+		{fmt.Errorf("pinata: %w", status(http.StatusUnauthorized)), "auth"},
+		{fmt.Errorf("pinata: %w", status(http.StatusTooManyRequests)), "rate_limited"},
+		{status(http.StatusBadGateway), "server"},
+		{status(http.StatusBadRequest), "request"},
+		{fmt.Errorf("nftstorage: %w", capability.ErrTooLarge), "too_large"},
+		{fmt.Errorf("lookup path failed: %w", os.ErrNotExist), "not_found"},
+		{fmt.Errorf("pinata: %w: expired", pinata.ErrPinJobFailed), "pin_failed"},
+		{fmt.Errorf("cluster: not pinned: %w", context.DeadlineExceeded), "timeout"},
+		{errors.New("unexpected"), "other"},
+	}
+	for _, test := range tests {
+		if kind := errorKind(test.err); kind != test.kind {
+			t.Errorf("Unexpected kind of %v, got %s instead of %s", test.err, kind, test.kind)
+		}
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	results := []record{
+		{Type: "result", Path: "a.txt", Cid: "QmTBpqbvJLZaq3hTMUhxX5hyJaSCeWe6Q5FRctQbsD6EsE", Size: 1},
+		newRecord("b.txt", fmt.Errorf("pinata: %w", capability.ErrUnsupported), time.Second),
+	}
+
+	for _, format := range []string{formatJSON, formatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			of := outputFlags{format: format}
+			p, err := of.printer()
+			if err != nil {
+				t.Fatalf("Unexpected printer: %v", err)
+			}
+			var buf bytes.Buffer
+			p.w = &buf
+			for _, r := range results {
+				if err := p.result(r); err != nil {
+					t.Fatalf("Unexpected write record: %v", err)
+				}
+			}
+			if err := p.finish("pinata", false); err != nil {
+				t.Fatalf("Unexpected finish: %v", err)
+			}
+			if !errors.Is(p.err(), errFailed) {
+				t.Errorf("Unexpected error of a failed run: %v", p.err())
+			}
+
+			var got struct {
+				Results []record
+				Summary summary
+			}
+			if format == formatJSON {
+				if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+					t.Fatalf("Unexpected json document: %v", err)
+				}
+			} else {
+				sc := bufio.NewScanner(&buf)
+				for sc.Scan() {
+					var r record
+					if err := json.Unmarshal(sc.Bytes(), &struct{ Type *string }{&r.Type}); err != nil {
+						t.Fatalf("Unexpected json line %s: %v", sc.Text(), err)
+					}
+					if r.Type == "summary" {
+						_ = json.Unmarshal(sc.Bytes(), &got.Summary)
+						continue
+					}
+					_ = json.Unmarshal(sc.Bytes(), &r)
+					got.Results = append(got.Results, r)
+				}
+			}
+			if len(got.Results) != 2 || got.Results[1].ErrorKind != "unsupported" || got.Results[1].Duration != 1 {
+				t.Errorf("Unexpected results: %+v", got.Results)
+			}
+			if s := got.Summary; s.Total != 2 || s.Succeeded != 1 || s.Failed != 1 || s.Provider != "pinata" {
+				t.Errorf("Unexpected summary: %+v", s)
+			}
+		})
+	}
+}
+
+func TestPrinterTemplate(t *testing.T) {
+	if _, err := (&outputFlags{format: formatTemplate}).printer(); !errors.Is(err, errUsage) {
+		t.Errorf("Unexpected template format without template: %v", err)
+	}
+
+	of := outputFlags{format: formatTemplate, template: "{{.Path}}={{.Cid}}"}
+	p, err := of.printer()
+	if err != nil {
+		t.Fatalf("Unexpected printer: %v", err)
+	}
+	var buf bytes.Buffer
+	p.w = &buf
+	_ = p.result(record{Path: "a.txt", Cid: "QmTBpqbvJLZaq3hTMUhxX5hyJaSCeWe6Q5FRctQbsD6EsE"})
+	if got := buf.String(); got != "a.txt=QmTBpqbvJLZaq3hTMUhxX5hyJaSCeWe6Q5FRctQbsD6EsE\n" {
+		t.Errorf("Unexpected template output %q", got)
+	}
+}
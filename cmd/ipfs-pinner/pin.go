@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wabarc/ipfs-pinner/batch"
+	"github.com/wabarc/ipfs-pinner/file"
+	"github.com/wabarc/ipfs-pinner/journal"
+)
+
+var pinCmd = &command{
+	name:    "pin",
+	args:    "[path]...",
+	summary: "Pin files or directories to IPFS, CIDs are pinned by hash and - pins stdin.",
+	run:     runPin,
+}
+
+// stdin is the path naming the standard input.
+const stdin = "-"
+
+// patterns collects the values of a repeatable flag.
+type patterns []string
+
+func (p *patterns) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patterns) Set(v string) error {
+	*p = append(*p, v)
+	return nil
+}
+
+// fileFlags are the flags selecting the entries taken from a directory,
+// shared by the commands reading files.
+type fileFlags struct {
+	hidden bool
+	links  string
+	pmode  bool
+	pmtime bool
+
+	include patterns
+	exclude patterns
+}
+
+func (ff *fileFlags) register(fs *flag.FlagSet) {
+	fs.BoolVar(&ff.hidden, "hidden", false, "Include files whose name starts with a dot.")
+	fs.Var(&ff.include, "include", "Pin only files matching the gitignore style pattern, repeatable.")
+	fs.Var(&ff.exclude, "exclude", "Skip entries matching the gitignore style pattern, repeatable.")
+	fs.StringVar(&ff.links, "symlinks", "follow", "Symlinks in directories, one of: follow, skip, preserve.")
+	fs.BoolVar(&ff.pmode, "preserve-mode", false, "Keep the permissions of files and directories as UnixFS metadata.")
+	fs.BoolVar(&ff.pmtime, "preserve-mtime", false, "Keep the modification time of files and directories as UnixFS metadata.")
+}
+
+func (ff *fileFlags) options() ([]file.Option, error) {
+	mode, err := file.ParseSymlinkMode(ff.links)
+	if err != nil {
+		return nil, err
+	}
+
+	// Rules in .gitignore and .ipfsignore files are always honored.
+	opts := []file.Option{file.IgnoreFiles(file.DefaultIgnoreFiles...), file.Symlinks(mode), file.Warn(warn)}
+	if !ff.hidden {
+		opts = append(opts, file.SkipHidden())
+	}
+	if len(ff.include) > 0 {
+		opts = append(opts, file.Include(ff.include...))
+	}
+	if len(ff.exclude) > 0 {
+		opts = append(opts, file.Exclude(ff.exclude...))
+	}
+	if ff.pmode {
+		opts = append(opts, file.PreserveMode())
+	}
+	if ff.pmtime {
+		opts = append(opts, file.PreserveMtime())
+	}
+	return opts, nil
+}
+
+// warn reports an entry skipped from a directory.
+func warn(err error) {
+	fmt.Fprintf(os.Stderr, "ipfs-pinner: warning: %v\n", err)
+}
+
+func runPin(fs *flag.FlagSet, args []string) error {
+	var (
+		pf pinnerFlags
+		ff fileFlags
+		gf gatewayFlags
+		cf cryptFlags
+		of outputFlags
+
+		journalPath string
+		journalTTL  time.Duration
+
+		manifest   string
+		checkpoint string
+		retries    int
+		jobs       int
+		failFast   bool
+
+		name        string
+		contentType string
+	)
+	pf.register(fs)
+	ff.register(fs)
+	gf.register(fs)
+	cf.registerRecipients(fs)
+	of.register(fs)
+	fs.StringVar(&journalPath, "journal", "", "Journal file recording pins, content already pinned to the account of the pinner is skipped.")
+	fs.DurationVar(&journalTTL, "journal-ttl", 0, "Age after which a journal entry is verified with the pinner, 0 trusts entries forever.")
+	fs.StringVar(&manifest, "manifest", "", "File listing paths or CIDs to pin, one per line, - reads stdin.")
+	fs.StringVar(&checkpoint, "checkpoint", "", "File recording finished items, completed items are skipped on restart.")
+	fs.IntVar(&retries, "retries", batch.DefaultMaxAttempts-1, "Times a failed item is tried again, across restarts sharing the checkpoint.")
+	fs.IntVar(&jobs, "jobs", 1, "Number of items pinned at once, within the rate limit of the pinner.")
+	fs.IntVar(&jobs, "j", 1, "Shorthand for -jobs.")
+	fs.BoolVar(&failFast, "fail-fast", false, "Stop at the first item failing with no attempt left.")
+	fs.StringVar(&name, "name", "", "Filename of the content read from stdin, random if empty.")
+	fs.StringVar(&contentType, "content-type", "", "Media type of the content read from stdin, detected if empty.")
+	_ = fs.Parse(args)
+
+	files := fs.Args()
+	if len(files) < 1 && manifest == "" {
+		return fmt.Errorf("file path is missing: %w", errUsage)
+	}
+	if jobs < 1 {
+		return fmt.Errorf("invalid jobs %d: %w", jobs, errUsage)
+	}
+	out, err := of.printer()
+	if err != nil {
+		return err
+	}
+	handler, err := pf.config()
+	if err != nil {
+		return err
+	}
+	if err := mustExist(files); err != nil {
+		return err
+	}
+	if manifest == stdin && contains(files, stdin) {
+		return fmt.Errorf("stdin cannot be both the manifest and pinned: %w", errUsage)
+	}
+	if handler.FileOptions, err = ff.options(); err != nil {
+		return err
+	}
+	if handler.Verifier, err = gf.verifier(); err != nil {
+		return err
+	}
+	if handler.Recipients, err = cf.recipients(); err != nil {
+		return err
+	}
+	handler.JournalTTL = journalTTL
+	if journalPath != "" {
+		j, err := journal.Open(journalPath)
+		if err != nil {
+			return err
+		}
+		defer j.Close()
+		handler.Journal = j
+	}
+
+	// Stdin can be read only once, so that it is neither pinned twice nor
+	// retried with what is left of it.
+	var (
+		mu        sync.Mutex
+		stdinRead bool
+		// sizes holds the size of the items walked to be pinned, so that
+		// they are reported without being walked again.
+		sizes = make(map[string]int64)
+	)
+	pinItem := func(item string) (string, error) {
+		switch {
+		case isCid(item) && len(handler.Recipients) > 0:
+			return "", fmt.Errorf("%s is pinned by hash and cannot be encrypted: %w", item, errUsage)
+		case isCid(item):
+			return handler.PinHash(item)
+		case item == stdin:
+			mu.Lock()
+			read := stdinRead
+			stdinRead = true
+			mu.Unlock()
+			if read {
+				return "", errors.New("stdin already read")
+			}
+			return handler.Pin(&file.NamedReader{Reader: os.Stdin, Name: name, ContentType: contentType})
+		}
+		node, err := file.NewSerialFile(item, handler.FileOptions...)
+		if err != nil {
+			return "", err
+		}
+		mu.Lock()
+		sizes[item] = node.Usage().Bytes
+		mu.Unlock()
+		return handler.Pin(node)
+	}
+	// report writes the record of an item, its size is only computed for
+	// the formats showing it.
+	report := func(item, cid string, err error, skipped bool, d time.Duration) error {
+		r := newRecord(item, err, d)
+		r.Cid, r.Provider, r.Skipped = cid, handler.Pinner, skipped
+		r.text = cid + "  " + item
+		if err == nil {
+			r.Key = handler.KeyRef()
+		}
+		// Items skipped by the checkpoint are not verified again.
+		if err == nil && handler.Verifier != nil && !skipped {
+			r.Status = "retrievable"
+		}
+		if out.format != formatText && !isCid(item) && item != stdin {
+			mu.Lock()
+			s, ok := sizes[item]
+			mu.Unlock()
+			if !ok {
+				s = size(item, handler.FileOptions)
+			}
+			r.Size = s
+		}
+		return out.result(r)
+	}
+
+	// Items are pinned by the jobs and reported in their order. Without
+	// manifest or checkpoint, every item is tried once and no summary is
+	// written in text.
+	b := &batch.Batch{Pin: pinItem, MaxAttempts: 1, Jobs: jobs, FailFast: failFast}
+	verbose := manifest != "" || checkpoint != ""
+	if verbose {
+		b.MaxAttempts = retries + 1
+	}
+
+	// In batch mode, paths of the manifest missing on disk only fail
+	// their own item.
+	items := files
+	if manifest != "" {
+		m, err := readManifest(manifest)
+		if err != nil {
+			return err
+		}
+		items = append(items, m...)
+	}
+	if checkpoint != "" {
+		cp, err := batch.OpenCheckpoint(checkpoint)
+		if err != nil {
+			return err
+		}
+		defer cp.Close()
+		b.Checkpoint = cp
+	}
+	var reportErr error
+	_, runErr := b.Run(items, func(r batch.Result) {
+		if err := report(r.Item, r.Cid, r.Err, r.Skipped, r.Duration); err != nil && reportErr == nil {
+			reportErr = err
+		}
+	})
+	if errors.Is(runErr, batch.ErrStopped) {
+		fmt.Fprintf(os.Stderr, "ipfs-pinner: %v\n", runErr)
+		runErr = nil
+	}
+	if reportErr != nil {
+		return reportErr
+	}
+	if err := out.finish(handler.Pinner, verbose || len(items) > 1); err != nil {
+		return err
+	}
+	if runErr != nil {
+		return runErr
+	}
+	return out.err()
+}
+
+// size returns the size of the entries of path selected by opts, or 0 if
+// it cannot be read. It is only used for items which were not walked to
+// be pinned, such as those skipped by the checkpoint.
+func size(path string, opts []file.Option) int64 {
+	u, err := file.DiskUsage(path, opts...)
+	if err != nil {
+		return 0
+	}
+	return u.Bytes
+}
+
+func readManifest(name string) ([]string, error) {
+	if name == stdin {
+		return batch.ReadManifest(os.Stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return batch.ReadManifest(f)
+}
+
+// mustExist returns an error listing the paths missing on disk, CIDs
+// and stdin are skipped.
+func mustExist(paths []string) error {
+	b := &bytes.Buffer{}
+	for _, p := range paths {
+		if isCid(p) || p == stdin {
+			continue
+		}
+		_, err := os.Stat(p)
+		if _, ok := err.(*os.PathError); ok {
+			fmt.Fprintln(b, err)
+		}
+	}
+	if b.Len() > 0 {
+		return errors.New(strings.TrimSpace(b.String()))
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
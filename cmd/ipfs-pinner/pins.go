@@ -0,0 +1,204 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wabarc/ipfs-pinner/batch"
+	"github.com/wabarc/ipfs-pinner/journal"
+	"github.com/wabarc/ipfs-pinner/pinning"
+
+	pinner "github.com/wabarc/ipfs-pinner"
+)
+
+var pinHashCmd = &command{
+	name:    "pin-hash",
+	args:    "<cid>...",
+	summary: "Pin content already on IPFS by its CID.",
+	run:     runPinHash,
+}
+
+var unpinCmd = &command{
+	name:    "unpin",
+	args:    "<cid>...",
+	summary: "Remove pins from the pinner.",
+	run:     runUnpin,
+}
+
+var statusCmd = &command{
+	name:    "status",
+	args:    "<cid>...",
+	summary: "Tell whether the pinner holds pins of CIDs.",
+	run:     runStatus,
+}
+
+var lsCmd = &command{
+	name:    "ls",
+	summary: "List the pins held by the pinner.",
+	run:     runLs,
+}
+
+// eachCid calls fn for every CID given to a command and writes the
+// records it returns.
+func eachCid(fs *flag.FlagSet, args []string, fn func(handler *pinner.Config, cid string) (record, error)) error {
+	var (
+		pf pinnerFlags
+		of outputFlags
+
+		failFast bool
+	)
+	pf.register(fs)
+	of.register(fs)
+	fs.BoolVar(&failFast, "fail-fast", false, "Stop at the first CID failing.")
+	_ = fs.Parse(args)
+
+	hashes, err := cids(fs.Args())
+	if err != nil {
+		return err
+	}
+	out, err := of.printer()
+	if err != nil {
+		return err
+	}
+	handler, err := pf.config()
+	if err != nil {
+		return err
+	}
+
+	for _, cid := range hashes {
+		start := time.Now()
+		r, err := fn(handler, cid)
+		rec := newRecord(cid, err, time.Since(start))
+		rec.Cid, rec.Provider, rec.Status, rec.text = r.Cid, handler.Pinner, r.Status, r.text
+		if err := out.result(rec); err != nil {
+			return err
+		}
+		if err != nil && failFast {
+			fmt.Fprintf(os.Stderr, "ipfs-pinner: %v\n", batch.ErrStopped)
+			break
+		}
+	}
+	if err := out.finish(handler.Pinner, false); err != nil {
+		return err
+	}
+	return out.err()
+}
+
+func runPinHash(fs *flag.FlagSet, args []string) error {
+	var wait time.Duration
+	fs.DurationVar(&wait, "wait", 0, "Time given to the pinner to find the content and pin it, 0 returns once the pin is queued.")
+	return eachCid(fs, args, func(handler *pinner.Config, cid string) (record, error) {
+		handler.PinWait = wait
+		cid, status, err := handler.PinHashStatus(cid, "", nil)
+		if err != nil {
+			return record{}, err
+		}
+		// A pin still queued or in progress may fail later.
+		r := record{Cid: cid, Status: string(status), text: cid}
+		if status != pinning.Pinned {
+			r.text += "  " + string(status)
+		}
+		return r, nil
+	})
+}
+
+func runUnpin(fs *flag.FlagSet, args []string) error {
+	var (
+		journalPath string
+		j           *journal.Journal
+	)
+	fs.StringVar(&journalPath, "journal", "", "Journal file whose entries of the unpinned CIDs are removed.")
+	defer func() {
+		if j != nil {
+			j.Close()
+		}
+	}()
+	return eachCid(fs, args, func(handler *pinner.Config, cid string) (record, error) {
+		// The journal is opened once the flags are parsed, on the first CID.
+		if journalPath != "" && j == nil {
+			var err error
+			if j, err = journal.Open(journalPath); err != nil {
+				return record{}, err
+			}
+			handler.Journal = j
+		}
+		if err := handler.Unpin(cid); err != nil {
+			return record{}, err
+		}
+		return record{Cid: cid, Status: "unpinned", text: cid}, nil
+	})
+}
+
+func runStatus(fs *flag.FlagSet, args []string) error {
+	return eachCid(fs, args, func(handler *pinner.Config, cid string) (record, error) {
+		pinned, err := handler.Pinned(cid)
+		if err != nil {
+			return record{}, err
+		}
+		status := "pinned"
+		if !pinned {
+			status = "not pinned"
+		}
+		return record{Cid: cid, Status: status, text: cid + "  " + status}, nil
+	})
+}
+
+func runLs(fs *flag.FlagSet, args []string) error {
+	var (
+		pf    pinnerFlags
+		of    outputFlags
+		quiet bool
+	)
+	pf.register(fs)
+	of.register(fs)
+	fs.BoolVar(&quiet, "q", false, "Print only the CIDs.")
+	_ = fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v: %w", fs.Args(), errUsage)
+	}
+
+	out, err := of.printer()
+	if err != nil {
+		return err
+	}
+	out.listing = true
+	handler, err := pf.config()
+	if err != nil {
+		return err
+	}
+	pins, err := handler.List()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case out.format != formatText:
+		for _, pin := range pins {
+			if err := out.emit(pin); err != nil {
+				return err
+			}
+		}
+		return out.finish(handler.Pinner, false)
+	case quiet:
+		for _, pin := range pins {
+			fmt.Fprintln(os.Stdout, pin.Cid)
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CID\tSTATUS\tSIZE\tCREATED\tNAME")
+	for _, pin := range pins {
+		size, created := "-", "-"
+		if pin.Size > 0 {
+			size = fmt.Sprint(pin.Size)
+		}
+		if !pin.Created.IsZero() {
+			created = pin.Created.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", pin.Cid, pin.Status, size, created, pin.Name)
+	}
+	return w.Flush()
+}
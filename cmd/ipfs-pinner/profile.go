@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wabarc/ipfs-pinner/config"
+
+	pinner "github.com/wabarc/ipfs-pinner"
+	httpretry "github.com/wabarc/ipfs-pinner/http"
+)
+
+// pinnerFlags are the flags selecting the pinning service and its
+// settings, shared by the commands talking to it. A setting is taken from
+// its flag, else from the environment, else from the profile.
+type pinnerFlags struct {
+	fs *flag.FlagSet
+
+	target      string
+	apikey      string
+	secret      string
+	endpoint    string
+	httpRetries int
+	rateLimit   float64
+
+	configPath string
+	profile    string
+}
+
+func (pf *pinnerFlags) register(fs *flag.FlagSet) {
+	pf.fs = fs
+	fs.StringVar(&pf.target, "t", pinner.Infura, "IPFS pinner, supports pinners: infura, pinata, nftstorage, web3storage, cluster.")
+	fs.StringVar(&pf.apikey, "u", "", "Pinner apikey or username.")
+	fs.StringVar(&pf.secret, "p", "", "Pinner sceret or password.")
+	fs.StringVar(&pf.endpoint, "endpoint", "", "Base URL replacing the API of the pinner, such as a Kubo RPC API for infura.")
+	fs.IntVar(&pf.httpRetries, "http-retries", httpretry.DefaultRetries, "Times a failed request to the pinner is retried.")
+	fs.Float64Var(&pf.rateLimit, "rate-limit", 0, "Maximum number of requests per second to the pinner, 0 is unlimited.")
+	fs.StringVar(&pf.configPath, "config", "", "Configuration file, defaults to $XDG_CONFIG_HOME/ipfs-pinner/config.toml.")
+	fs.StringVar(&pf.profile, "profile", "", "Profile of the configuration file to use.")
+}
+
+// setting is the value of a setting and where it comes from.
+type setting struct {
+	value  string
+	source string
+}
+
+// settings are the pinner settings in effect.
+type settings struct {
+	path    string
+	profile *config.Profile
+
+	provider, apikey, secret  setting
+	endpoint, retries, limits setting
+}
+
+// env names the environment variables of the settings.
+func env(name string) string {
+	return "IPFS_PINNER_" + name
+}
+
+// credentialsEnv returns the environment variables of the apikey and the
+// secret of a provider.
+func credentialsEnv(provider string) (apikey, secret string) {
+	p := strings.ToUpper(provider)
+	return env(p + "_API_KEY"), env(p + "_SECRET_API_KEY")
+}
+
+// profileOf loads the profile selected by the flags or the environment,
+// or the default profile of the configuration file. It returns nil
+// without error if there is none.
+func (pf *pinnerFlags) profileOf() (string, *config.Profile, error) {
+	path, explicit := pf.configPath, true
+	if path == "" {
+		path = os.Getenv(env("CONFIG"))
+	}
+	if path == "" {
+		path, explicit = config.DefaultPath(), false
+	}
+	name := pf.profile
+	if name == "" {
+		name = os.Getenv(env("PROFILE"))
+	}
+
+	file, err := config.Load(path)
+	switch {
+	case err == nil:
+	case !explicit && errors.Is(err, os.ErrNotExist):
+		if name != "" {
+			return "", nil, fmt.Errorf("profile %s selected without configuration file", name)
+		}
+		return "", nil, nil
+	default:
+		return "", nil, err
+	}
+	p, err := file.Lookup(name)
+	return path, p, err
+}
+
+// resolve returns the settings in effect.
+func (pf *pinnerFlags) resolve() (*settings, error) {
+	return pf.resolveFor("")
+}
+
+// resolveFor returns the settings in effect for provider, or for the
+// selected provider if empty. The credential and endpoint flags only apply
+// to the selected provider.
+func (pf *pinnerFlags) resolveFor(provider string) (*settings, error) {
+	set := make(map[string]bool)
+	if pf.fs != nil {
+		pf.fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	}
+	path, profile, err := pf.profileOf()
+	if err != nil {
+		return nil, err
+	}
+	s := &settings{path: path, profile: profile}
+
+	// pick takes the flag if set, else the environment, else the profile.
+	pick := func(flagName, flagValue, envName, profileValue, def string) setting {
+		switch {
+		case set[flagName]:
+			return setting{flagValue, "flag -" + flagName}
+		case envName != "" && os.Getenv(envName) != "":
+			return setting{os.Getenv(envName), "env " + envName}
+		case profileValue != "":
+			return setting{profileValue, "profile " + profile.Name}
+		}
+		return setting{def, "default"}
+	}
+
+	var p config.Profile
+	if profile != nil {
+		p = *profile
+	}
+	s.provider = pick("t", pf.target, env("PROVIDER"), p.Provider, pinner.Infura)
+	s.provider.value = strings.ToLower(s.provider.value)
+	if provider != "" && provider != s.provider.value {
+		s.provider = setting{provider, "argument"}
+		delete(set, "u")
+		delete(set, "p")
+		delete(set, "endpoint")
+	}
+	// The other settings of a profile made for another provider are
+	// ignored.
+	if p.Provider != "" && p.Provider != s.provider.value {
+		p = config.Profile{Name: p.Name}
+	}
+
+	apikeyEnv, secretEnv := credentialsEnv(s.provider.value)
+	s.apikey = pick("u", pf.apikey, apikeyEnv, p.Apikey, "")
+	s.secret = pick("p", pf.secret, secretEnv, p.Secret, "")
+	s.endpoint = pick("endpoint", pf.endpoint, env("ENDPOINT"), p.Endpoint, "")
+	var retries, limit string
+	if p.Retries != nil {
+		retries = strconv.Itoa(*p.Retries)
+	}
+	if p.RateLimit > 0 {
+		limit = strconv.FormatFloat(p.RateLimit, 'f', -1, 64)
+	}
+	s.retries = pick("http-retries", strconv.Itoa(pf.httpRetries), env("HTTP_RETRIES"), retries, strconv.Itoa(httpretry.DefaultRetries))
+	s.limits = pick("rate-limit", strconv.FormatFloat(pf.rateLimit, 'f', -1, 64), env("RATE_LIMIT"), limit, "0")
+
+	return s, nil
+}
+
+// config returns the configuration of the selected pinner.
+func (pf *pinnerFlags) config() (*pinner.Config, error) {
+	s, err := pf.resolve()
+	if err != nil {
+		return nil, err
+	}
+	return s.config()
+}
+
+// configFor returns the configuration of provider, see resolveFor.
+func (pf *pinnerFlags) configFor(provider string) (*pinner.Config, error) {
+	s, err := pf.resolveFor(provider)
+	if err != nil {
+		return nil, err
+	}
+	return s.config()
+}
+
+func (s *settings) config() (*pinner.Config, error) {
+	target := s.provider.value
+	switch target {
+	case pinner.NFTStorage, pinner.Web3Storage:
+		if s.apikey.value == "" {
+			return nil, fmt.Errorf("%s requires an apikey", target)
+		}
+	case pinner.Infura, pinner.Pinata, pinner.Cluster:
+		// Permit request without authorization
+	default:
+		return nil, fmt.Errorf("%w: %s", pinner.ErrPinner, target)
+	}
+
+	retries, err := strconv.Atoi(s.retries.value)
+	if err != nil || retries < 0 {
+		return nil, fmt.Errorf("invalid http retries %s from %s", s.retries.value, s.retries.source)
+	}
+	limit, err := strconv.ParseFloat(s.limits.value, 64)
+	if err != nil || limit < 0 {
+		return nil, fmt.Errorf("invalid rate limit %s from %s", s.limits.value, s.limits.source)
+	}
+
+	// The client is shared by all the requests of the command, so that
+	// the rate limit holds for all of them.
+	client := httpretry.WithRateLimit(&http.Client{}, limit)
+	if s.endpoint.value != "" {
+		if client, err = httpretry.WithEndpoint(client, s.endpoint.value); err != nil {
+			return nil, fmt.Errorf("%v from %s", err, s.endpoint.source)
+		}
+	}
+	client = httpretry.WithRetries(client, retries)
+
+	cfg := &pinner.Config{Pinner: target, Apikey: s.apikey.value, Secret: s.secret.value}
+	return cfg.WithClient(client), nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/wabarc/ipfs-pinner/journal"
+	"github.com/wabarc/ipfs-pinner/psa"
+	"github.com/wabarc/ipfs-pinner/server"
+)
+
+var serveCmd = &command{
+	name:    "serve",
+	summary: "Serve pinning as a REST API and the Pinning Services API, until interrupted.",
+	run:     runServe,
+}
+
+func runServe(fs *flag.FlagSet, args []string) error {
+	var (
+		pf pinnerFlags
+
+		addr     string
+		maxSize  int64
+		shutdown time.Duration
+		quiet    bool
+
+		storePath   string
+		journalPath string
+		delegates   patterns
+		jobs        int
+	)
+	pf.register(fs)
+	fs.StringVar(&addr, "listen", "127.0.0.1:8080", "Address the API listens on.")
+	fs.Int64Var(&maxSize, "max-size", 0, "Maximum size of an upload in bytes, 0 is unlimited.")
+	fs.DurationVar(&shutdown, "shutdown-timeout", 30*time.Second, "Time given to the requests in flight to finish on shutdown.")
+	fs.BoolVar(&quiet, "quiet", false, "Do not log the requests.")
+	fs.StringVar(&storePath, "psa-store", "", "File tracking the pin requests of the Pinning Services API, served on /pins if set.")
+	fs.Var(&delegates, "delegate", "Multiaddr of an IPFS node of the pinner given to Pinning Services API clients, repeatable.")
+	fs.IntVar(&jobs, "psa-jobs", psa.DefaultJobs, "Number of Pinning Services API requests pinned at once.")
+	fs.StringVar(&journalPath, "journal", "", "Journal file whose entries of the CIDs unpinned through the APIs are removed.")
+	_ = fs.Parse(args)
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %v: %w", fs.Args(), errUsage)
+	}
+
+	handler, err := pf.config()
+	if err != nil {
+		return err
+	}
+	if journalPath != "" {
+		j, err := journal.Open(journalPath)
+		if err != nil {
+			return err
+		}
+		defer j.Close()
+		handler.Journal = j
+	}
+	// The token is only read from the environment, so that it is not
+	// shown in the process list.
+	s := &server.Server{Config: handler, Token: os.Getenv(env("TOKEN")), MaxBodySize: maxSize}
+	logger := log.New(os.Stderr, "ipfs-pinner: ", log.LstdFlags)
+	if !quiet {
+		s.Logf = logger.Printf
+	}
+	if s.Token == "" {
+		logger.Printf("%s is not set, requests are not authenticated", env("TOKEN"))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", s)
+	if storePath != "" {
+		store, err := psa.Open(storePath)
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		ps := &psa.Server{Config: handler, Store: store, Token: s.Token, Delegates: delegates, Jobs: jobs, Logf: logger.Printf}
+		// Requests being pinned are stopped before the store is closed, the
+		// ones left pinning are resumed on the next start.
+		defer ps.Shutdown()
+		ps.Resume()
+		mux.Handle("/pins", ps)
+		mux.Handle("/pins/", ps)
+	}
+
+	srv := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second, ErrorLog: logger}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	done := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		logger.Printf("shutting down")
+		sctx, cancel := context.WithTimeout(context.Background(), shutdown)
+		defer cancel()
+		done <- srv.Shutdown(sctx)
+	}()
+
+	logger.Printf("serving %s on %s", handler.Pinner, addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-done
+}
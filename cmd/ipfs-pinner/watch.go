@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/wabarc/ipfs-pinner/file"
+	"github.com/wabarc/ipfs-pinner/journal"
+	"github.com/wabarc/ipfs-pinner/watch"
+)
+
+var watchCmd = &command{
+	name:    "watch",
+	args:    "<dir>",
+	summary: "Pin the files of a directory once they stop changing, until interrupted.",
+	run:     runWatch,
+}
+
+func runWatch(fs *flag.FlagSet, args []string) error {
+	var (
+		pf pinnerFlags
+		w  watch.Watcher
+
+		format      string
+		logPath     string
+		moveTo      string
+		remove      bool
+		journalPath string
+	)
+	pf.register(fs)
+	fs.StringVar(&w.Match, "match", "", "Pin only files whose name matches the pattern, such as '*.warc.gz'.")
+	fs.DurationVar(&w.Quiet, "quiet", watch.DefaultQuiet, "Time a file must stay unchanged before it is pinned.")
+	fs.DurationVar(&w.Interval, "interval", watch.DefaultInterval, "Time between two scans of the directory when it is polled.")
+	fs.DurationVar(&w.RetryDelay, "retry-delay", watch.DefaultRetryDelay, "Time after which a file that failed to pin is tried again.")
+	fs.BoolVar(&w.Poll, "poll", false, "Poll the directory instead of using inotify, such as on network file systems.")
+	fs.StringVar(&format, "output", formatText, "Log format, one of: text, ndjson.")
+	fs.StringVar(&logPath, "log", "", "File the results are appended to, stdout if empty.")
+	fs.StringVar(&moveTo, "move-to", "", "Directory pinned files are moved to.")
+	fs.BoolVar(&remove, "delete", false, "Delete pinned files.")
+	fs.StringVar(&journalPath, "journal", "", "Journal file recording pins, content already pinned to the account of the pinner is skipped.")
+	_ = fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("a single directory is required: %w", errUsage)
+	}
+	w.Dir = fs.Arg(0)
+	switch {
+	case format != formatText && format != formatNDJSON:
+		return fmt.Errorf("invalid log format %s: %w", format, errUsage)
+	case moveTo != "" && remove:
+		return fmt.Errorf("-move-to and -delete are exclusive: %w", errUsage)
+	case w.Match != "":
+		if _, err := filepath.Match(w.Match, ""); err != nil {
+			return fmt.Errorf("invalid pattern %s: %w", w.Match, errUsage)
+		}
+	}
+	if moveTo != "" {
+		if info, err := os.Stat(moveTo); err != nil {
+			return err
+		} else if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", moveTo)
+		}
+	}
+
+	handler, err := pf.config()
+	if err != nil {
+		return err
+	}
+	if journalPath != "" {
+		j, err := journal.Open(journalPath)
+		if err != nil {
+			return err
+		}
+		defer j.Close()
+		handler.Journal = j
+	}
+	var out io.Writer = os.Stdout
+	if logPath != "" {
+		f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	logRecord := func(r record) error {
+		if format == formatNDJSON {
+			return json.NewEncoder(out).Encode(r)
+		}
+		line := r.Time + "  " + r.text
+		if r.Error != "" {
+			line = fmt.Sprintf("%s  %s: %s", r.Time, r.Path, r.Error)
+		}
+		_, err := fmt.Fprintln(out, line)
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	return w.Run(ctx, func(path string) error {
+		start := time.Now()
+		var cid string
+		node, err := file.NewSerialFile(path, handler.FileOptions...)
+		if err == nil {
+			cid, err = handler.Pin(node)
+		}
+		r := newRecord(path, err, time.Since(start))
+		r.Cid, r.Provider, r.Time = cid, handler.Pinner, time.Now().UTC().Format(time.RFC3339)
+		r.text = cid + "  " + path
+		if err == nil {
+			r.Size = node.Usage().Bytes
+			// The file is pinned, a failure to move or delete it is
+			// logged without pinning it again.
+			switch {
+			case moveTo != "":
+				r.Action = "move"
+				dst := filepath.Join(moveTo, filepath.Base(path))
+				if err := os.Rename(path, dst); err != nil {
+					r.Error, r.ErrorKind = "pinned, but not moved: "+err.Error(), errorKind(err)
+				} else {
+					r.text += " -> " + dst
+				}
+			case remove:
+				r.Action = "delete"
+				if err := os.Remove(path); err != nil {
+					r.Error, r.ErrorKind = "pinned, but not deleted: "+err.Error(), errorKind(err)
+				} else {
+					r.text += " (deleted)"
+				}
+			}
+		}
+		if err := logRecord(r); err != nil {
+			fmt.Fprintf(os.Stderr, "ipfs-pinner: write log failed: %v\n", err)
+		}
+		return err
+	})
+}
@@ -0,0 +1,157 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package config reads the configuration file of the ipfs-pinner command,
+which holds named profiles of pinner settings. The file is written in
+TOML:
+
+	# Profile used when none is selected
+	profile = "pinata"
+
+	[profiles.pinata]
+	provider = "pinata"
+	apikey = "..."
+	secret = "..."
+	retries = 3
+	rate_limit = 2.5
+
+	[profiles.local]
+	provider = "infura"
+	endpoint = "http://127.0.0.1:5001"
+*/
+package config // import "github.com/wabarc/ipfs-pinner/config"
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Profile is a named set of pinner settings. Empty fields are unset.
+type Profile struct {
+	Name string `toml:"-"`
+
+	Provider string `toml:"provider"`
+	// Endpoint replaces the base URL of the API of the provider, such as
+	// a Kubo RPC API speaking the Infura protocol.
+	Endpoint string `toml:"endpoint"`
+	Apikey   string `toml:"apikey"`
+	Secret   string `toml:"secret"`
+
+	// Retries is the number of times a failed request is retried, nil if
+	// unset.
+	Retries *int `toml:"retries"`
+	// RateLimit is the maximum number of requests per second, zero if
+	// unset.
+	RateLimit float64 `toml:"rate_limit"`
+}
+
+// File is a configuration file.
+type File struct {
+	Path string `toml:"-"`
+	// Profile is the name of the profile used when none is selected.
+	Profile  string              `toml:"profile"`
+	Profiles map[string]*Profile `toml:"profiles"`
+}
+
+// DefaultPath returns the path of the configuration file in the XDG
+// configuration directory, $XDG_CONFIG_HOME/ipfs-pinner/config.toml or
+// ~/.config/ipfs-pinner/config.toml.
+func DefaultPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "ipfs-pinner", "config.toml")
+}
+
+// Load reads the configuration file at path. Unknown keys are rejected,
+// so that a misspelled setting is not silently ignored.
+func Load(path string) (*File, error) {
+	file, err := decode(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	file.Path = path
+
+	return file, nil
+}
+
+// Lookup returns the profile of the given name, or the default profile if
+// name is empty. It returns nil without error if name is empty and there
+// is no default profile.
+func (f *File) Lookup(name string) (*Profile, error) {
+	if name == "" {
+		name = f.Profile
+	}
+	if name == "" {
+		return nil, nil
+	}
+	p, ok := f.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %s not found in %s", name, f.Path)
+	}
+	return p, nil
+}
+
+// Names returns the names of the profiles, sorted.
+func (f *File) Names() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func decode(path string) (*File, error) {
+	file := &File{}
+	md, err := toml.DecodeFile(path, file)
+	if err != nil {
+		return nil, err
+	}
+	if typ := md.Type("profiles"); typ != "" && typ != "Hash" {
+		return nil, fmt.Errorf("profiles must be a table")
+	}
+	if keys := md.Undecoded(); len(keys) > 0 {
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			names[i] = k.String()
+		}
+		return nil, fmt.Errorf("unknown key %s", strings.Join(names, ", "))
+	}
+
+	if file.Profiles == nil {
+		file.Profiles = make(map[string]*Profile)
+	}
+	for name, p := range file.Profiles {
+		if p == nil {
+			p = &Profile{}
+			file.Profiles[name] = p
+		}
+		p.Name = name
+		switch {
+		case p.Retries != nil && *p.Retries < 0:
+			return nil, fmt.Errorf("profiles.%s: invalid retries %d", name, *p.Retries)
+		case p.RateLimit < 0:
+			return nil, fmt.Errorf("profiles.%s: invalid rate_limit %v", name, p.RateLimit)
+		}
+	}
+	if file.Profile != "" {
+		if _, ok := file.Profiles[file.Profile]; !ok {
+			return nil, fmt.Errorf("default profile %s not found", file.Profile)
+		}
+	}
+
+	return file, nil
+}
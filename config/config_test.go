@@ -0,0 +1,118 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const sample = `# ipfs-pinner
+profile = "pinata" # default
+
+[profiles.pinata]
+provider = "pinata"
+apikey = "key"
+secret = 'se"cret'
+retries = 3
+rate_limit = 2.5
+
+[profiles."local node"]
+provider = "infura"
+endpoint = "http://127.0.0.1:5001"
+rate_limit = 10
+`
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	file, err := Load(writeConfig(t, sample))
+	if err != nil {
+		t.Fatalf("Unexpected load: %v", err)
+	}
+	if got := file.Names(); !reflect.DeepEqual(got, []string{"local node", "pinata"}) {
+		t.Errorf("Unexpected profiles: %v", got)
+	}
+
+	p, err := file.Lookup("")
+	if err != nil {
+		t.Fatalf("Unexpected lookup of the default profile: %v", err)
+	}
+	if p.Name != "pinata" || p.Apikey != "key" || p.Secret != `se"cret` || p.Retries == nil || *p.Retries != 3 || p.RateLimit != 2.5 {
+		t.Errorf("Unexpected default profile: %+v", p)
+	}
+
+	p, err = file.Lookup("local node")
+	if err != nil {
+		t.Fatalf("Unexpected lookup: %v", err)
+	}
+	if p.Provider != "infura" || p.Endpoint != "http://127.0.0.1:5001" || p.Retries != nil || p.RateLimit != 10 {
+		t.Errorf("Unexpected profile: %+v", p)
+	}
+
+	if _, err := file.Lookup("missing"); err == nil {
+		t.Error("Unexpected lookup of a missing profile")
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown key":      "[profiles.a]\nprovder = \"pinata\"\n",
+		"dotted key":       "[profiles.a]\nprovider.name = \"pinata\"\n",
+		"array":            "[profiles.a]\nprovider = [\"pinata\"]\n",
+		"negative retries": "[profiles.a]\nretries = -1\n",
+		"string retries":   "[profiles.a]\nretries = \"3\"\n",
+		"missing default":  "profile = \"b\"\n[profiles.a]\n",
+		"duplicate key":    "[profiles.a]\napikey = \"a\"\napikey = \"b\"\n",
+		"duplicate table":  "[profiles.a]\n[profiles.a]\n",
+		"unterminated":     "[profiles.a]\napikey = \"a\n",
+		"trailing garbage": "[profiles.a]\napikey = \"a\" b\n",
+		"invalid escape":   "[profiles.a]\napikey = \"\\q\"\n",
+		"unclosed table":   "[profiles.a\n",
+		"array of tables":  "[[profiles]]\n",
+		"negative rate":    "[profiles.a]\nrate_limit = -1.5\n",
+		"unknown top key":  "profiles = {}\nproxy = \"socks5://\"\n",
+	}
+	for name, content := range tests {
+		if _, err := Load(writeConfig(t, content)); err == nil {
+			t.Errorf("%s: unexpected load of %q", name, content)
+		} else if !strings.Contains(err.Error(), "config.toml") {
+			t.Errorf("%s: unexpected error without path: %v", name, err)
+		}
+	}
+}
+
+func TestLoadSyntax(t *testing.T) {
+	// Inline tables, dotted keys and multi-line strings are valid TOML.
+	file, err := Load(writeConfig(t, `profile = "b"
+profiles.a = { provider = "pinata", retries = 1 }
+
+[profiles.b]
+provider = "nftstorage"
+apikey = """
+key"""
+`))
+	if err != nil {
+		t.Fatalf("Unexpected load: %v", err)
+	}
+	if p := file.Profiles["a"]; p == nil || p.Name != "a" || p.Provider != "pinata" || p.Retries == nil || *p.Retries != 1 {
+		t.Errorf("Unexpected profile: %+v", p)
+	}
+	if p, _ := file.Lookup(""); p == nil || p.Name != "b" || p.Apikey != "key" {
+		t.Errorf("Unexpected default profile: %+v", p)
+	}
+}
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if got := DefaultPath(); got != filepath.Join("/xdg", "ipfs-pinner", "config.toml") {
+		t.Errorf("Unexpected default path %s", got)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package crypt encrypts content before it is pinned, so that it is not
+readable by anyone fetching it from IPFS, and decrypts it once fetched.
+
+Content is encrypted with filippo.io/age, in the age format,
+https://age-encryption.org/v1, to X25519 recipients, age1... public keys,
+or to a passphrase. The payload is encrypted in chunks, so that content of
+any size is streamed and any alteration or truncation is detected when
+decrypting. Keys generated by age-keygen can be used, and the content
+decrypted with age.
+*/
+package crypt // import "github.com/wabarc/ipfs-pinner/crypt"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/age"
+)
+
+const (
+	// DefaultWorkFactor is the base-2 logarithm of the scrypt cost used to
+	// encrypt with a passphrase, about a second on a recent computer.
+	DefaultWorkFactor = 18
+	// MaxWorkFactor is the highest scrypt cost accepted when decrypting.
+	MaxWorkFactor = 22
+)
+
+var (
+	// ErrIncorrectIdentity is returned by Identity.Unwrap for stanzas not
+	// made for the identity.
+	ErrIncorrectIdentity = age.ErrIncorrectIdentity
+
+	// ErrNoIdentity is returned by Decrypt if no identity unwraps the file
+	// key.
+	ErrNoIdentity = errors.New("no identity matched any of the recipients")
+)
+
+// Recipient wraps the file key of encrypted content.
+type Recipient interface {
+	age.Recipient
+	// String returns the reference of the key of the recipient, which
+	// does not reveal the key.
+	String() string
+}
+
+// Identity unwraps the file key of content encrypted to its recipient.
+type Identity = age.Identity
+
+// X25519Recipient is the public key of an X25519 identity, encoded as
+// age1...
+type X25519Recipient = age.X25519Recipient
+
+// X25519Identity is an X25519 private key, encoded as
+// AGE-SECRET-KEY-1...
+type X25519Identity = age.X25519Identity
+
+// GenerateIdentity returns a new random identity.
+func GenerateIdentity() (*X25519Identity, error) {
+	return age.GenerateX25519Identity()
+}
+
+// ParseRecipient parses an age1... public key.
+func ParseRecipient(s string) (*X25519Recipient, error) {
+	return age.ParseX25519Recipient(s)
+}
+
+// ParseIdentity parses an AGE-SECRET-KEY-1... private key.
+func ParseIdentity(s string) (*X25519Identity, error) {
+	return age.ParseX25519Identity(s)
+}
+
+// ParseIdentities parses the identities of a file as written by
+// age-keygen, a key per line, skipping blank lines and comments.
+func ParseIdentities(content string) ([]Identity, error) {
+	return age.ParseIdentities(strings.NewReader(content))
+}
+
+// Passphrase encrypts and decrypts content with a passphrase, whose key is
+// derived with scrypt. It cannot be combined with other recipients.
+type Passphrase struct {
+	Secret string
+	// WorkFactor is the base-2 logarithm of the scrypt cost when
+	// encrypting, DefaultWorkFactor if zero.
+	WorkFactor int
+}
+
+// Wrap wraps the file key with a key derived from the passphrase.
+func (p *Passphrase) Wrap(fileKey []byte) ([]*age.Stanza, error) {
+	logN := p.WorkFactor
+	if logN <= 0 {
+		logN = DefaultWorkFactor
+	}
+	if logN > MaxWorkFactor {
+		return nil, fmt.Errorf("work factor %d above %d", logN, MaxWorkFactor)
+	}
+	r, err := age.NewScryptRecipient(p.Secret)
+	if err != nil {
+		return nil, err
+	}
+	r.SetWorkFactor(logN)
+	return r.Wrap(fileKey)
+}
+
+// Unwrap unwraps the file key of a scrypt stanza, of a work factor up to
+// MaxWorkFactor.
+func (p *Passphrase) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
+	id, err := age.NewScryptIdentity(p.Secret)
+	if err != nil {
+		return nil, err
+	}
+	id.SetMaxWorkFactor(MaxWorkFactor)
+	return id.Unwrap(stanzas)
+}
+
+// String returns "passphrase", the key being secret.
+func (p *Passphrase) String() string {
+	return "passphrase"
+}
+
+// KeyRef returns the reference of the keys decrypting content encrypted to
+// recipients, their public keys or the kind of secret.
+func KeyRef(recipients []Recipient) string {
+	refs := make([]string, 0, len(recipients))
+	for _, r := range recipients {
+		refs = append(refs, r.String())
+	}
+	return strings.Join(refs, ",")
+}
+
+// Encrypt returns a writer encrypting the content written to it to the
+// recipients, into dst. The content is only complete once the writer is
+// closed, which does not close dst.
+func Encrypt(dst io.Writer, recipients ...Recipient) (io.WriteCloser, error) {
+	if err := checkRecipients(recipients); err != nil {
+		return nil, err
+	}
+	rs := make([]age.Recipient, 0, len(recipients))
+	for _, r := range recipients {
+		rs = append(rs, r)
+	}
+	return age.Encrypt(dst, rs...)
+}
+
+// EncryptReader returns a reader of the content of src encrypted to the
+// recipients, encrypted as it is read. An error reading src is returned by
+// the reader instead of truncated content.
+func EncryptReader(src io.Reader, recipients ...Recipient) (io.ReadCloser, error) {
+	if err := checkRecipients(recipients); err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := Encrypt(pw, recipients...)
+		if err == nil {
+			_, err = io.Copy(w, src)
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// checkRecipients checks that content can be encrypted to recipients.
+func checkRecipients(recipients []Recipient) error {
+	if len(recipients) == 0 {
+		return errors.New("no recipient to encrypt to")
+	}
+	for _, r := range recipients {
+		if _, ok := r.(*Passphrase); ok && len(recipients) > 1 {
+			return errors.New("a passphrase cannot be combined with other recipients")
+		}
+	}
+	return nil
+}
+
+// Decrypt returns a reader of the content of src decrypted with the first
+// identity unwrapping its file key. The header is checked before Decrypt
+// returns, the payload as it is read: the reader returns an error for
+// altered or truncated content.
+func Decrypt(src io.Reader, identities ...Identity) (io.Reader, error) {
+	if len(identities) == 0 {
+		return nil, errors.New("no identity to decrypt with")
+	}
+	r, err := age.Decrypt(src, identities...)
+	var noMatch *age.NoIdentityMatchError
+	if errors.As(err, &noMatch) {
+		return nil, ErrNoIdentity
+	}
+	return r, err
+}
@@ -0,0 +1,188 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+const (
+	intro = "age-encryption.org/v1\n"
+	// chunkSize is the size of the chunks of the payload.
+	chunkSize = 64 << 10
+)
+
+func TestKeys(t *testing.T) {
+	id, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(id.String(), "AGE-SECRET-KEY-1") || !strings.HasPrefix(id.Recipient().String(), "age1") {
+		t.Fatalf("Unexpected keys %s %s", id, id.Recipient())
+	}
+	parsed, err := ParseIdentity(id.String())
+	if err != nil || parsed.Recipient().String() != id.Recipient().String() {
+		t.Errorf("Unexpected parsed identity: %v", err)
+	}
+	ids, err := ParseIdentities("# created: today\n# public key: " + id.Recipient().String() + "\n" + id.String() + "\n")
+	if err != nil || len(ids) != 1 {
+		t.Errorf("Unexpected identities %v: %v", ids, err)
+	}
+	for _, s := range []string{"", "# no key\n", "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p\n"} {
+		if _, err := ParseIdentities(s); err == nil {
+			t.Errorf("Unexpected identities of %q", s)
+		}
+	}
+	if _, err := ParseRecipient(id.String()); err == nil {
+		t.Error("Unexpected secret key parsed as a recipient")
+	}
+
+	// The recipient of the documentation of age.
+	const example = "age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p"
+	if r, err := ParseRecipient(example); err != nil || r.String() != example {
+		t.Errorf("Unexpected recipient %v: %v", r, err)
+	}
+}
+
+func encrypt(t *testing.T, plain []byte, recipients ...Recipient) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, recipients...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(ciphertext []byte, identities ...Identity) ([]byte, error) {
+	r, err := Decrypt(bytes.NewReader(ciphertext), identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestEncrypt(t *testing.T) {
+	alice, _ := GenerateIdentity()
+	bob, _ := GenerateIdentity()
+	eve, _ := GenerateIdentity()
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3 * chunkSize} {
+		plain := make([]byte, size)
+		_, _ = rand.Read(plain)
+		ciphertext := encrypt(t, plain, alice.Recipient(), bob.Recipient())
+		// Short plaintexts may appear in random ciphertext by chance.
+		if !bytes.HasPrefix(ciphertext, []byte(intro)) || size >= 16 && bytes.Contains(ciphertext, plain) {
+			t.Fatalf("Unexpected ciphertext of %d bytes", size)
+		}
+		for _, id := range []Identity{alice, bob} {
+			got, err := decrypt(ciphertext, eve, id)
+			if err != nil || !bytes.Equal(got, plain) {
+				t.Errorf("Unexpected decrypt of %d bytes: %v", size, err)
+			}
+		}
+		if _, err := decrypt(ciphertext, eve); !errors.Is(err, ErrNoIdentity) {
+			t.Errorf("Unexpected decrypt without identity: %v", err)
+		}
+	}
+
+	// The stream reader encrypts the same way.
+	plain := bytes.Repeat([]byte("ipfs-pinner"), chunkSize)
+	rc, err := EncryptReader(bytes.NewReader(plain), alice.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := decrypt(ciphertext, alice); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("Unexpected decrypt of the stream: %v", err)
+	}
+
+	if KeyRef([]Recipient{alice.Recipient(), bob.Recipient()}) != alice.Recipient().String()+","+bob.Recipient().String() {
+		t.Error("Unexpected key reference")
+	}
+	if _, err := EncryptReader(bytes.NewReader(plain)); err == nil {
+		t.Error("Unexpected encrypt without recipient")
+	}
+}
+
+func TestEncryptReaderError(t *testing.T) {
+	id, _ := GenerateIdentity()
+	failure := errors.New("read failed")
+	rc, err := EncryptReader(io.MultiReader(strings.NewReader("partial"), &failingReader{failure}), id.Recipient())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(rc); !errors.Is(err, failure) {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+type failingReader struct{ err error }
+
+func (r *failingReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestPassphrase(t *testing.T) {
+	p := &Passphrase{Secret: "correct horse", WorkFactor: 10}
+	plain := []byte("ipfs-pinner")
+	ciphertext := encrypt(t, plain, p)
+	if !bytes.Contains(ciphertext, []byte("\n-> scrypt ")) || KeyRef([]Recipient{p}) != "passphrase" {
+		t.Fatalf("Unexpected header %q", ciphertext[:60])
+	}
+	if got, err := decrypt(ciphertext, &Passphrase{Secret: "correct horse"}); err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("Unexpected decrypt: %v", err)
+	}
+	if _, err := decrypt(ciphertext, &Passphrase{Secret: "wrong"}); !errors.Is(err, ErrNoIdentity) {
+		t.Errorf("Unexpected decrypt with a wrong passphrase: %v", err)
+	}
+
+	id, _ := GenerateIdentity()
+	if _, err := Encrypt(io.Discard, p, id.Recipient()); err == nil {
+		t.Error("Unexpected passphrase combined with a recipient")
+	}
+}
+
+func TestDecryptAltered(t *testing.T) {
+	id, _ := GenerateIdentity()
+	plain := bytes.Repeat([]byte("ipfs-pinner"), chunkSize/4)
+	ciphertext := encrypt(t, plain, id.Recipient())
+	header := bytes.Index(ciphertext, []byte("\n--- ")) + 1
+
+	flip := func(i int) []byte {
+		b := append([]byte(nil), ciphertext...)
+		b[i] ^= 1
+		return b
+	}
+	full := chunkSize + 16
+	tests := []struct {
+		name       string
+		ciphertext []byte
+	}{
+		{"header", flip(len(intro) + 4)},
+		{"mac", flip(header + 6)},
+		{"payload", flip(len(ciphertext) - 1)},
+		{"truncated", ciphertext[:len(ciphertext)-1]},
+		{"last chunk dropped", ciphertext[:len(ciphertext)-(len(plain)%chunkSize+16)]},
+		{"appended", append(append([]byte(nil), ciphertext...), ciphertext[len(ciphertext)-full:]...)},
+		{"empty", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got, err := decrypt(test.ciphertext, id); err == nil {
+				t.Errorf("Unexpected decrypt of %d bytes", len(got))
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package pinner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/wabarc/helper"
+	"github.com/wabarc/ipfs-pinner/crypt"
+	"github.com/wabarc/ipfs-pinner/file"
+)
+
+// KeyRef returns the reference of the keys content is encrypted to, the
+// recipients joined by commas, or an empty string if Recipients is empty.
+func (cfg *Config) KeyRef() string {
+	if len(cfg.Recipients) == 0 {
+		return ""
+	}
+	return crypt.KeyRef(cfg.Recipients)
+}
+
+// encrypted returns a reader of the content given to Pin encrypted to
+// Recipients. A directory is encrypted as a tar archive of the entries
+// selected by FileOptions. The name of the ciphertext is the name of the
+// content, or a random one, with an .age extension.
+func (cfg *Config) encrypted(path interface{}) (*encryptedReader, error) {
+	var (
+		src     io.Reader
+		name    string
+		closers []io.Closer
+	)
+	switch v := path.(type) {
+	case *file.Node:
+		base := filepath.Base(v.Root())
+		name = base + ".age"
+		if v.Mode().IsDir() {
+			nd, err := v.Files()
+			if err != nil {
+				return nil, err
+			}
+			name = base + ".tar.age"
+			src = tarReader(nd, base)
+			break
+		}
+		f, err := os.Open(v.Root())
+		if err != nil {
+			return nil, err
+		}
+		src, closers = f, []io.Closer{f}
+	case []byte:
+		src = bytes.NewReader(v)
+	case *file.NamedReader:
+		src = v
+		if v.Name != "" {
+			name = v.Name + ".age"
+		}
+	case io.Reader:
+		src = v
+	default:
+		return nil, ErrPinner
+	}
+
+	if name == "" {
+		name = helper.RandString(6, "lower") + ".age"
+	}
+
+	r, err := crypt.EncryptReader(src, cfg.Recipients...)
+	if err != nil {
+		for _, c := range closers {
+			c.Close()
+		}
+		return nil, err
+	}
+	return &encryptedReader{
+		NamedReader: file.NamedReader{Reader: r, Name: name, ContentType: "application/octet-stream"},
+		closers:     append([]io.Closer{r}, closers...),
+	}, nil
+}
+
+// encryptedReader is the ciphertext uploaded by Pin, closing the encrypter
+// and the source on Close.
+type encryptedReader struct {
+	file.NamedReader
+
+	closers []io.Closer
+}
+
+func (r *encryptedReader) Close() error {
+	var err error
+	for _, c := range r.closers {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// tarReader streams the tar archive of nd, its entries under name.
+func tarReader(nd files.Node, name string) io.Reader {
+	r, w := io.Pipe()
+	go func() {
+		tw, err := files.NewTarWriter(w)
+		if err == nil {
+			err = tw.WriteFile(nd, name)
+		}
+		if err == nil {
+			err = tw.Close()
+		}
+		_ = w.CloseWithError(err)
+	}()
+	return r
+}
+
+// Fetch returns a reader of the content of the UnixFS file c, retrieved
+// and verified as Get does. If Identities is set, the content is decrypted
+// with them, and the reader fails if it was altered.
+func (cfg *Config) Fetch(ctx context.Context, c string) (io.ReadCloser, error) {
+	ct, err := cfg.Get(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	r, err := ct.Reader()
+	if err == nil && len(cfg.Identities) > 0 {
+		if r, err = crypt.Decrypt(r, cfg.Identities...); err != nil {
+			err = fmt.Errorf("decrypt %s failed: %w", c, err)
+		}
+	}
+	if err != nil {
+		ct.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, ct}, nil
+}
@@ -0,0 +1,29 @@
+package file
+
+import (
+	"io"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/wabarc/ipfs-pinner/unixfs"
+)
+
+// CARReader streams the CARv1 archive of a UnixFS DAG built locally. It is
+// the upload body of the pinning services accepting CAR files, which keep
+// the DAG as is, metadata included.
+type CARReader struct {
+	*io.PipeReader
+}
+
+// NewCARReader returns a CARReader that encodes the DAG of nd, built with
+// the given options, see unixfs.WriteCAR. An error while building the DAG
+// aborts the stream, and the reader returns that error.
+func NewCARReader(nd files.Node, opts ...unixfs.Option) *CARReader {
+	r, w := io.Pipe()
+
+	go func() {
+		_, err := unixfs.WriteCAR(w, nd, opts...)
+		_ = w.CloseWithError(err)
+	}()
+
+	return &CARReader{PipeReader: r}
+}
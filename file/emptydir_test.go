@@ -0,0 +1,205 @@
+package file
+
+import (
+	"io/ioutil"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/wabarc/ipfs-pinner/unixfs"
+)
+
+func emptyDirTree(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "ipfs-pinner-emptydir-")
+	if err != nil {
+		t.Fatalf("Unexpected create directory: %v", err)
+	}
+	writeTree(t, dir, map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "b",
+	})
+	for _, d := range []string{"empty", "sub/nested/empty"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(d)), 0o700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+// emptyDirCid is the CID `ipfs add -r --cid-version=1` gives emptyDirTree,
+// as computed by the importer of Kubo in boxo.
+const emptyDirCid = "bafybeibxtlllppwp44eckmg55lpuixydmrttjut4rrodx7cpdbervvwhkm"
+
+// partsTree rebuilds the directory sent as parts under the base name.
+func partsTree(t *testing.T, ps parts, base string) files.Node {
+	type dir map[string]interface{}
+	root := dir{}
+	lookup := func(p string) dir {
+		d := root
+		if p == "." {
+			return d
+		}
+		for _, name := range strings.Split(p, "/") {
+			sub, ok := d[name].(dir)
+			if !ok {
+				t.Fatalf("Unexpected part %s before its directory", p)
+			}
+			d = sub
+		}
+		return d
+	}
+	for _, p := range ps {
+		if p.filename == "" {
+			continue
+		}
+		name, err := url.QueryUnescape(p.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(name, base), "/")
+		if rel == "" {
+			continue
+		}
+		parent := lookup(path.Dir(rel))
+		if p.contentType == "application/x-directory" {
+			parent[path.Base(rel)] = dir{}
+		} else {
+			parent[path.Base(rel)] = p.content
+		}
+	}
+
+	var convert func(d dir) files.Node
+	convert = func(d dir) files.Node {
+		m := make(map[string]files.Node)
+		for name, v := range d {
+			switch v := v.(type) {
+			case dir:
+				m[name] = convert(v)
+			case []byte:
+				m[name] = files.NewBytesFile(v)
+			}
+		}
+		return files.NewMapDirectory(m)
+	}
+	return convert(root)
+}
+
+func TestNewSerialFileEmptyDirectories(t *testing.T) {
+	dir, cleanup := emptyDirTree(t)
+	defer cleanup()
+
+	node, err := NewSerialFile(dir)
+	if err != nil {
+		t.Fatalf("Unexpected new a serial file: %v", err)
+	}
+	var got []string
+	for i, p := range node.paths {
+		if node.files[i].IsDir() {
+			got = append(got, filepath.ToSlash(p))
+		}
+	}
+	expected := []string{"empty", "sub", "sub/nested", "sub/nested/empty"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected directories, got %v instead of %v", got, expected)
+	}
+
+	// Directories without any included file are dropped
+	node, err = NewSerialFile(dir, Include("b.txt"))
+	if err != nil {
+		t.Fatalf("Unexpected new a serial file: %v", err)
+	}
+	if got := node.paths; len(got) != 2 || filepath.ToSlash(got[1]) != "sub/b.txt" {
+		t.Errorf("Unexpected paths with include patterns: %v", got)
+	}
+}
+
+func TestCreateMultiFormEmptyDirectories(t *testing.T) {
+	dir, cleanup := emptyDirTree(t)
+	defer cleanup()
+
+	node, err := NewSerialFile(dir)
+	if err != nil {
+		t.Fatalf("Unexpected new a serial file: %v", err)
+	}
+	node.MapDirectory("site")
+
+	mfr, err := CreateMultiForm(node, true)
+	if err != nil {
+		t.Fatalf("Unexpected creates multipart form data: %v", err)
+	}
+	data, err := ioutil.ReadAll(mfr)
+	if err != nil {
+		t.Fatalf("Unexpected read multipart form data: %v", err)
+	}
+	ps := readParts(t, data, mfr.Boundary())
+
+	var dirs []string
+	for _, p := range ps {
+		if p.contentType == "application/x-directory" {
+			dirs = append(dirs, p.filename)
+		}
+	}
+	expected := []string{"site", "empty", "sub", "nested", "empty"}
+	if !reflect.DeepEqual(dirs, expected) {
+		t.Errorf("Unexpected directory parts, got %v instead of %v", dirs, expected)
+	}
+
+	got, err := unixfs.Sum(partsTree(t, rawParts(t, data, mfr.Boundary()), "site"))
+	if err != nil {
+		t.Fatalf("Unexpected sum: %v", err)
+	}
+	if got.String() != emptyDirCid {
+		t.Errorf("Unexpected cid of the uploaded structure, got %s instead of %s", got, emptyDirCid)
+	}
+}
+
+func TestNewMultiFileReaderEmptyDirectories(t *testing.T) {
+	dir, cleanup := emptyDirTree(t)
+	defer cleanup()
+
+	mfr, err := NewMultiFileReader(dir, false)
+	if err != nil {
+		t.Fatalf("Unexpected creates multipart file: %v", err)
+	}
+
+	// Decode the upload the way the Kubo RPC API does.
+	d, err := files.NewFileFromPartReader(multipart.NewReader(mfr, mfr.Boundary()), "multipart/form-data")
+	if err != nil {
+		t.Fatalf("Unexpected read multipart file: %v", err)
+	}
+	it := d.Entries()
+	if !it.Next() {
+		t.Fatalf("Unexpected empty upload: %v", it.Err())
+	}
+	got, err := unixfs.Sum(it.Node())
+	if err != nil {
+		t.Fatalf("Unexpected sum: %v", err)
+	}
+	if got.String() != emptyDirCid {
+		t.Errorf("Unexpected cid of the uploaded structure, got %s instead of %s", got, emptyDirCid)
+	}
+
+	// The local CID of the Node agrees
+	node, err := NewSerialFile(dir)
+	if err != nil {
+		t.Fatalf("Unexpected new a serial file: %v", err)
+	}
+	nd, err := node.Files()
+	if err != nil {
+		t.Fatalf("Unexpected convert node: %v", err)
+	}
+	local, err := unixfs.Sum(nd)
+	if err != nil {
+		t.Fatalf("Unexpected sum: %v", err)
+	}
+	if local.String() != emptyDirCid {
+		t.Errorf("Unexpected local cid, got %s instead of %s", local, emptyDirCid)
+	}
+}
@@ -0,0 +1,182 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ipfs/boxo/files"
+)
+
+// Files converts the Node to a files.Node holding the same entries, so
+// that the boxo encoders upload exactly the entries selected by
+// NewSerialFile. Files are opened when they are read, and preserved links
+// become symlink nodes.
+//
+// If the Node preserves the mode or the modification time, the nodes
+// carry them as UnixFS 1.5 metadata, see unixfs.Metadata.
+func (n *Node) Files() (files.Node, error) {
+	if !n.stat.IsDir() {
+		return n.newLazyFile(n.root, n.stat), nil
+	}
+
+	root := &dirNode{meta: n.metadata(n.stat)}
+	for i, rel := range n.paths {
+		dir := root
+		elems := strings.Split(filepath.ToSlash(rel), "/")
+		for _, name := range elems[:len(elems)-1] {
+			dir = dir.subdir(name, metadata{})
+		}
+		if n.files[i].IsDir() {
+			dir.subdir(elems[len(elems)-1], n.metadata(n.files[i]))
+			continue
+		}
+		fp := filepath.Join(n.root, rel)
+		var nd files.Node = n.newLazyFile(fp, n.files[i])
+		if n.files[i].Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(fp)
+			if err != nil {
+				return nil, err
+			}
+			nd = files.NewLinkFile(target, n.files[i])
+		}
+		dir.entries = append(dir.entries, files.FileEntry(elems[len(elems)-1], nd))
+	}
+
+	return root.directory(), nil
+}
+
+// metadata holds the UnixFS 1.5 metadata of an entry, zero values are
+// not preserved.
+type metadata struct {
+	mode  os.FileMode
+	mtime time.Time
+}
+
+func (m metadata) Mode() os.FileMode {
+	return m.mode
+}
+
+func (m metadata) ModTime() time.Time {
+	return m.mtime
+}
+
+// metadata returns the metadata of fi preserved by the Node.
+func (n *Node) metadata(fi os.FileInfo) (m metadata) {
+	if n.preserveMode {
+		m.mode = fi.Mode()
+	}
+	if n.preserveMtime {
+		m.mtime = fi.ModTime()
+	}
+	return m
+}
+
+// metaDirectory is a files.Directory carrying metadata.
+type metaDirectory struct {
+	files.Directory
+	metadata
+}
+
+type dirNode struct {
+	meta    metadata
+	entries []files.DirEntry
+	subdirs map[string]*dirNode
+}
+
+// subdir returns the subdirectory name, created with the metadata m if
+// it does not exist yet.
+func (d *dirNode) subdir(name string, m metadata) *dirNode {
+	if sub, ok := d.subdirs[name]; ok {
+		return sub
+	}
+	if d.subdirs == nil {
+		d.subdirs = make(map[string]*dirNode)
+	}
+	sub := &dirNode{meta: m}
+	d.subdirs[name] = sub
+	d.entries = append(d.entries, files.FileEntry(name, nil))
+
+	return sub
+}
+
+func (d *dirNode) directory() files.Directory {
+	entries := make([]files.DirEntry, len(d.entries))
+	for i, entry := range d.entries {
+		if sub, ok := d.subdirs[entry.Name()]; ok && entry.Node() == nil {
+			entry = files.FileEntry(entry.Name(), sub.directory())
+		}
+		entries[i] = entry
+	}
+
+	dir := files.NewSliceDirectory(entries)
+	if d.meta == (metadata{}) {
+		return dir
+	}
+	return &metaDirectory{Directory: dir, metadata: d.meta}
+}
+
+// lazyFile is a files.File that opens the underlying file on first read.
+type lazyFile struct {
+	metadata
+
+	path string
+	stat os.FileInfo
+	file *os.File
+}
+
+var (
+	_ files.File     = (*lazyFile)(nil)
+	_ files.FileInfo = (*lazyFile)(nil)
+)
+
+func (n *Node) newLazyFile(path string, stat os.FileInfo) *lazyFile {
+	return &lazyFile{metadata: n.metadata(stat), path: path, stat: stat}
+}
+
+func (f *lazyFile) open() error {
+	if f.file != nil {
+		return nil
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	f.file = file
+
+	return nil
+}
+
+func (f *lazyFile) Read(p []byte) (int, error) {
+	if err := f.open(); err != nil {
+		return 0, err
+	}
+	return f.file.Read(p)
+}
+
+func (f *lazyFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.open(); err != nil {
+		return 0, err
+	}
+	return f.file.Seek(offset, whence)
+}
+
+func (f *lazyFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+func (f *lazyFile) Size() (int64, error) {
+	return f.stat.Size(), nil
+}
+
+func (f *lazyFile) AbsPath() string {
+	return f.path
+}
+
+func (f *lazyFile) Stat() os.FileInfo {
+	return f.stat
+}
@@ -0,0 +1,196 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	ignore "github.com/crackcomm/go-gitignore"
+)
+
+// DefaultIgnoreFiles holds the names of the ignore files honored by the
+// command line tool.
+var DefaultIgnoreFiles = []string{".gitignore", ".ipfsignore"}
+
+// Option configures which entries of a directory are taken by
+// NewSerialFile and NewMultiFileReader, and the metadata they keep.
+// Selection options do not apply to the root path itself. Entries which
+// are neither regular files, directories nor symbolic links, such as
+// sockets and named pipes, are always skipped.
+type Option func(*options)
+
+type options struct {
+	skipHidden  bool
+	include     []string
+	exclude     []string
+	ignoreFiles []string
+	symlinks    SymlinkMode
+	warn        func(error)
+
+	preserveMode  bool
+	preserveMtime bool
+}
+
+// SkipHidden skips the entries whose name starts with a dot, and the
+// contents of such directories.
+func SkipHidden() Option {
+	return func(o *options) {
+		o.skipHidden = true
+	}
+}
+
+// Include takes only the files matching at least one of the patterns.
+// Patterns use the gitignore syntax and are matched against the path
+// relative to the root. Directories are always traversed.
+func Include(patterns ...string) Option {
+	return func(o *options) {
+		o.include = append(o.include, patterns...)
+	}
+}
+
+// Exclude skips the entries matching any of the patterns. Patterns use
+// the gitignore syntax and are matched against the path relative to the
+// root.
+func Exclude(patterns ...string) Option {
+	return func(o *options) {
+		o.exclude = append(o.exclude, patterns...)
+	}
+}
+
+// IgnoreFiles honors the ignore files with the given names, such as
+// .gitignore, in every directory of the tree. The rules of an ignore file
+// apply to the directory holding it and its subdirectories.
+func IgnoreFiles(names ...string) Option {
+	return func(o *options) {
+		o.ignoreFiles = append(o.ignoreFiles, names...)
+	}
+}
+
+// Warn calls fn with the error of every entry skipped because it cannot
+// be taken, such as a followed link which dangles, points outside of the
+// root or forms a loop. Such entries fail the walk only as the root path.
+func Warn(fn func(err error)) Option {
+	return func(o *options) {
+		o.warn = fn
+	}
+}
+
+// PreserveMode preserves the permissions of the entries as UnixFS 1.5
+// metadata.
+func PreserveMode() Option {
+	return func(o *options) {
+		o.preserveMode = true
+	}
+}
+
+// PreserveMtime preserves the modification time of the entries as UnixFS
+// 1.5 metadata.
+func PreserveMtime() Option {
+	return func(o *options) {
+		o.preserveMtime = true
+	}
+}
+
+// PreservesMetadata reports whether the options preserve the mode or the
+// modification time, as Node.PreserveMetadata does, without walking.
+func PreservesMetadata(opts ...Option) bool {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o.preserveMode || o.preserveMtime
+}
+
+type rule struct {
+	dir    string // slash separated path relative to the root, empty for the root
+	ignore *ignore.GitIgnore
+}
+
+type filter struct {
+	options
+
+	include *ignore.GitIgnore
+	exclude *ignore.GitIgnore
+}
+
+func newFilter(opts []Option) *filter {
+	f := new(filter)
+	for _, opt := range opts {
+		opt(&f.options)
+	}
+	if len(f.options.include) > 0 {
+		f.include, _ = ignore.CompileIgnoreLines(f.options.include...)
+	}
+	if len(f.options.exclude) > 0 {
+		f.exclude, _ = ignore.CompileIgnoreLines(f.options.exclude...)
+	}
+
+	return f
+}
+
+// load compiles the ignore files found in the directory dir, whose slash
+// separated path relative to the root is rel, and returns them appended
+// to the rules of the parent directories. The rules of the parent are
+// left untouched, so that sibling directories can be walked concurrently.
+func (f *filter) load(dir, rel string, rules []rule) ([]rule, error) {
+	rules = rules[:len(rules):len(rules)]
+	for _, name := range f.ignoreFiles {
+		gi, err := ignore.CompileIgnoreFile(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read ignore file failed: %v", err)
+		}
+		rules = append(rules, rule{dir: rel, ignore: gi})
+	}
+
+	return rules, nil
+}
+
+// excluded reports whether the entry fi, whose slash separated path
+// relative to the root is rel, should be skipped given the rules of its
+// directory.
+func (f *filter) excluded(rel string, fi os.FileInfo, rules []rule) bool {
+	if special(fi) {
+		return true
+	}
+	if f.skipHidden && strings.HasPrefix(path.Base(rel), ".") {
+		return true
+	}
+
+	name := rel
+	if fi.IsDir() {
+		name += "/"
+	}
+	if f.exclude != nil && f.exclude.MatchesPath(name) {
+		return true
+	}
+	for _, r := range rules {
+		switch {
+		case r.dir == "":
+			if r.ignore.MatchesPath(name) {
+				return true
+			}
+		case strings.HasPrefix(name, r.dir+"/"):
+			if r.ignore.MatchesPath(strings.TrimPrefix(name, r.dir+"/")) {
+				return true
+			}
+		}
+	}
+	if !fi.IsDir() && f.include != nil && !f.include.MatchesPath(name) {
+		return true
+	}
+
+	return false
+}
+
+// special reports whether fi is neither a regular file, a directory nor a
+// symbolic link, which have no UnixFS counterpart.
+func special(fi os.FileInfo) bool {
+	mode := fi.Mode()
+	return !mode.IsRegular() && !mode.IsDir() && mode&os.ModeSymlink == 0
+}
@@ -0,0 +1,173 @@
+package file
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func writeTree(t *testing.T, dir string, tree map[string]string) {
+	for name, content := range tree {
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fp), 0o700); err != nil {
+			t.Fatalf("Unexpected create directory: %v", err)
+		}
+		if err := ioutil.WriteFile(fp, []byte(content), 0o600); err != nil {
+			t.Fatalf("Unexpected write file: %v", err)
+		}
+	}
+}
+
+// nodePaths returns the sorted paths of the non-directory entries.
+func nodePaths(node *Node) []string {
+	paths := make([]string, 0, len(node.paths))
+	for i, p := range node.paths {
+		if node.files[i].IsDir() {
+			continue
+		}
+		paths = append(paths, filepath.ToSlash(p))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestNewSerialFileWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfs-pinner-filter-")
+	if err != nil {
+		t.Fatalf("Unexpected create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTree(t, dir, map[string]string{
+		".git/config":        "[core]",
+		".gitignore":         "build/\n*.tmp\n",
+		"index.html":         "<html></html>",
+		"page.warc":          "WARC/1.1",
+		"page.tmp":           "tmp",
+		".index.html.swp":    "swap",
+		"build/out.bin":      "bin",
+		"sub/.ipfsignore":    "*.log\n",
+		"sub/debug.log":      "log",
+		"sub/keep.warc":      "WARC/1.1",
+		"sub/deep/trace.log": "log",
+		"other/debug.log":    "log",
+	})
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected []string
+	}{
+		{
+			name: "no options",
+			expected: []string{
+				".git/config", ".gitignore", ".index.html.swp", "build/out.bin", "index.html", "other/debug.log",
+				"page.tmp", "page.warc", "sub/.ipfsignore", "sub/debug.log", "sub/deep/trace.log", "sub/keep.warc",
+			},
+		},
+		{
+			name: "skip hidden",
+			opts: []Option{SkipHidden()},
+			expected: []string{
+				"build/out.bin", "index.html", "other/debug.log", "page.tmp", "page.warc",
+				"sub/debug.log", "sub/deep/trace.log", "sub/keep.warc",
+			},
+		},
+		{
+			name:     "ignore files",
+			opts:     []Option{SkipHidden(), IgnoreFiles(DefaultIgnoreFiles...)},
+			expected: []string{"index.html", "other/debug.log", "page.warc", "sub/keep.warc"},
+		},
+		{
+			name:     "exclude",
+			opts:     []Option{SkipHidden(), Exclude("*.log", "build/")},
+			expected: []string{"index.html", "page.tmp", "page.warc", "sub/keep.warc"},
+		},
+		{
+			name:     "include",
+			opts:     []Option{Include("*.warc")},
+			expected: []string{"page.warc", "sub/keep.warc"},
+		},
+		{
+			name:     "include and exclude",
+			opts:     []Option{Include("*.warc"), Exclude("sub/")},
+			expected: []string{"page.warc"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, err := NewSerialFile(dir, test.opts...)
+			if err != nil {
+				t.Fatalf("Unexpected new a serial file: %v", err)
+			}
+			if got := nodePaths(node); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("Unexpected paths, got %v instead of %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestNewSerialFileSkipsSpecialFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfs-pinner-special-")
+	if err != nil {
+		t.Fatalf("Unexpected create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTree(t, dir, map[string]string{"index.html": "<html></html>"})
+	ln, err := net.Listen("unix", filepath.Join(dir, "app.sock"))
+	if err != nil {
+		t.Skipf("Unix sockets are unsupported: %v", err)
+	}
+	defer ln.Close()
+
+	node, err := NewSerialFile(dir)
+	if err != nil {
+		t.Fatalf("Unexpected new a serial file: %v", err)
+	}
+	if got := nodePaths(node); !reflect.DeepEqual(got, []string{"index.html"}) {
+		t.Errorf("Unexpected paths: %v", got)
+	}
+	u, err := DiskUsage(dir)
+	if err != nil {
+		t.Fatalf("Unexpected disk usage: %v", err)
+	}
+	if u != node.Usage() {
+		t.Errorf("Unexpected disk usage, got %+v instead of %+v", u, node.Usage())
+	}
+}
+
+func TestNewMultiFileReaderWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfs-pinner-filter-")
+	if err != nil {
+		t.Fatalf("Unexpected create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTree(t, dir, map[string]string{
+		".hidden":    "hidden",
+		"a.txt":      "a",
+		"sub/b.txt":  "b",
+		"sub/c.skip": "c",
+	})
+
+	mfr, err := NewMultiFileReader(dir, false, SkipHidden(), Exclude("*.skip"))
+	if err != nil {
+		t.Fatalf("Unexpected creates multipart file: %v", err)
+	}
+	data, err := ioutil.ReadAll(mfr)
+	if err != nil {
+		t.Fatalf("Unexpected read multipart file: %v", err)
+	}
+
+	parts := readParts(t, data, mfr.Boundary())
+	expected := []string{"", "a.txt", "sub", "sub%2Fb.txt"}
+	if got := parts.names(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected parts, got %v instead of %v", got, expected)
+	}
+}
@@ -0,0 +1,176 @@
+package file
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/wabarc/ipfs-pinner/unixfs"
+)
+
+// FormReader streams a multipart form holding a single file part. It is
+// the upload body shared by every pinning service that accepts a form.
+type FormReader struct {
+	*io.PipeReader
+
+	contentType string
+}
+
+// NewFormReader returns a FormReader that encodes the content of src as
+// a form file named filename under the "file" field. If src is a
+// *NamedReader, its name and media type, if set, replace filename and
+// application/octet-stream.
+//
+// The form is encoded on demand while the request body is being read.
+// An error from src or from the multipart writer aborts the stream, the
+// reader returns that error instead of a truncated but well-formed body,
+// and the request carrying it fails.
+func NewFormReader(filename string, src io.Reader) *FormReader {
+	r, w := io.Pipe()
+	m := multipart.NewWriter(w)
+
+	contentType := "application/octet-stream"
+	if nr, ok := src.(*NamedReader); ok {
+		if nr.Name != "" {
+			filename = nr.Name
+		}
+		if nr.ContentType != "" {
+			contentType = nr.ContentType
+		}
+	}
+
+	go func() {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, escapeQuotes(filename)))
+		header.Set("Content-Type", contentType)
+		part, err := m.CreatePart(header)
+		if err != nil {
+			_ = w.CloseWithError(fmt.Errorf("create form file failed: %w", err))
+			return
+		}
+		if _, err = io.Copy(part, src); err != nil {
+			_ = w.CloseWithError(fmt.Errorf("read source failed: %w", err))
+			return
+		}
+		if err = m.Close(); err != nil {
+			_ = w.CloseWithError(fmt.Errorf("close multipart writer failed: %w", err))
+			return
+		}
+		_ = w.Close()
+	}()
+
+	return &FormReader{PipeReader: r, contentType: m.FormDataContentType()}
+}
+
+// NewFormReaderWithBytes returns a FormReader that encodes buf as a form
+// file named filename under the "file" field.
+func NewFormReaderWithBytes(filename string, buf []byte) *FormReader {
+	return NewFormReader(filename, bytes.NewReader(buf))
+}
+
+// ContentType returns the Content-Type of the form, including its boundary.
+func (fr *FormReader) ContentType() string {
+	return fr.contentType
+}
+
+// NewNodeReader returns a FormReader that encodes nd the same way as
+// files.MultiFileReader, the form expected by the add endpoint of Kubo.
+// The node is wrapped in a directory with an empty name, which Kubo
+// unwraps.
+//
+// Files and directories implementing unixfs.Metadata carry their mode and
+// modification time as the mode, mtime and mtime-nsecs parameters of the
+// Content-Disposition, which Kubo keeps when the preserve-mode and
+// preserve-mtime options of the add call are set.
+func NewNodeReader(nd files.Node) *FormReader {
+	r, w := io.Pipe()
+	m := multipart.NewWriter(w)
+
+	go func() {
+		if err := writeNode(m, "", nd); err != nil {
+			_ = w.CloseWithError(err)
+			return
+		}
+		if err := m.Close(); err != nil {
+			_ = w.CloseWithError(fmt.Errorf("close multipart writer failed: %w", err))
+			return
+		}
+		_ = w.Close()
+	}()
+
+	return &FormReader{PipeReader: r, contentType: m.FormDataContentType()}
+}
+
+// writeNode writes the part of nd, whose path in the form is name,
+// followed by the parts of its entries if nd is a directory.
+func writeNode(m *multipart.Writer, name string, nd files.Node) error {
+	defer nd.Close()
+
+	disposition := fmt.Sprintf(`attachment; filename="%s"`, url.QueryEscape(name))
+	if md, ok := nd.(unixfs.Metadata); ok {
+		if mode := md.Mode(); mode != 0 {
+			disposition += fmt.Sprintf("; mode=%#o", unixfs.UnixMode(mode))
+		}
+		if mtime := md.ModTime(); !mtime.IsZero() {
+			disposition += fmt.Sprintf("; mtime=%d; mtime-nsecs=%d", mtime.Unix(), mtime.Nanosecond())
+		}
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", disposition)
+
+	var body io.Reader
+	switch n := nd.(type) {
+	case *files.Symlink:
+		header.Set("Content-Type", "application/symlink")
+		body = strings.NewReader(n.Target)
+	case files.File:
+		header.Set("Content-Type", "application/octet-stream")
+		body = n
+	case files.Directory:
+		header.Set("Content-Type", "application/x-directory")
+	default:
+		return fmt.Errorf("unsupported node type %T", nd)
+	}
+	if fi, ok := nd.(files.FileInfo); ok {
+		header.Set("abspath", fi.AbsPath())
+	}
+
+	part, err := m.CreatePart(header)
+	if err != nil {
+		return fmt.Errorf("create form part failed: %w", err)
+	}
+	if body != nil {
+		if _, err := io.Copy(part, body); err != nil {
+			return fmt.Errorf("read source failed: %w", err)
+		}
+	}
+
+	dir, ok := nd.(files.Directory)
+	if !ok {
+		return nil
+	}
+	it := dir.Entries()
+	for it.Next() {
+		if err := writeNode(m, path.Join(name, it.Name()), it.Node()); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("read directory failed: %w", err)
+	}
+
+	return nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// escapeQuotes escapes a filename the same way as mime/multipart.
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
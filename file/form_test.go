@@ -0,0 +1,103 @@
+package file
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"strings"
+	"testing"
+
+	"github.com/wabarc/helper"
+)
+
+type failingReader struct {
+	err error
+}
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	return 0, fr.err
+}
+
+func TestNewFormReader(t *testing.T) {
+	content := helper.RandString(6, "lower")
+	fr := NewFormReader("foo", strings.NewReader(content))
+	defer fr.Close()
+
+	_, params, err := mime.ParseMediaType(fr.ContentType())
+	if err != nil {
+		t.Fatalf("Unexpected parse content type: %v", err)
+	}
+
+	mr := multipart.NewReader(fr, params["boundary"])
+	part, err := mr.NextPart()
+	if err != nil {
+		t.Fatalf("Unexpected read part: %v", err)
+	}
+	if part.FormName() != "file" || part.FileName() != "foo" {
+		t.Fatalf("Unexpected part, got name %q filename %q", part.FormName(), part.FileName())
+	}
+	data, err := ioutil.ReadAll(part)
+	if err != nil {
+		t.Fatalf("Unexpected read part content: %v", err)
+	}
+	if string(data) != content {
+		t.Fatalf("Unexpected part content, got %q instead of %q", data, content)
+	}
+	if _, err := mr.NextPart(); err != io.EOF {
+		t.Fatalf("Unexpected trailing part: %v", err)
+	}
+}
+
+func TestNewFormReaderWithFailingReader(t *testing.T) {
+	errSource := errors.New("source failed")
+	src := io.MultiReader(strings.NewReader(helper.RandString(6, "lower")), &failingReader{err: errSource})
+	fr := NewFormReader("foo", src)
+	defer fr.Close()
+
+	_, err := ioutil.ReadAll(fr)
+	if !errors.Is(err, errSource) {
+		t.Fatalf("Unexpected error, got %v instead of %v", err, errSource)
+	}
+}
+
+func TestNewFormReaderWithBytes(t *testing.T) {
+	content := helper.RandString(6, "lower")
+	fr := NewFormReaderWithBytes("foo", []byte(content))
+	defer fr.Close()
+
+	data, err := ioutil.ReadAll(fr)
+	if err != nil {
+		t.Fatalf("Unexpected read form: %v", err)
+	}
+	if !strings.Contains(string(data), content) {
+		t.Fatalf("Unexpected form content: %s", data)
+	}
+}
+
+func TestNewFormReaderWithNamedReader(t *testing.T) {
+	content := helper.RandString(6, "lower")
+	src := &NamedReader{Reader: strings.NewReader(content), Name: `site "v1".tar`, ContentType: "application/x-tar"}
+	fr := NewFormReader("foo", src)
+	defer fr.Close()
+
+	_, params, err := mime.ParseMediaType(fr.ContentType())
+	if err != nil {
+		t.Fatalf("Unexpected parse content type: %v", err)
+	}
+	part, err := multipart.NewReader(fr, params["boundary"]).NextPart()
+	if err != nil {
+		t.Fatalf("Unexpected read part: %v", err)
+	}
+	if part.FileName() != `site "v1".tar` {
+		t.Errorf("Unexpected filename %q", part.FileName())
+	}
+	if ct := part.Header.Get("Content-Type"); ct != "application/x-tar" {
+		t.Errorf("Unexpected part content type %q", ct)
+	}
+	data, err := ioutil.ReadAll(part)
+	if err != nil || string(data) != content {
+		t.Fatalf("Unexpected part content %q: %v", data, err)
+	}
+}
@@ -0,0 +1,65 @@
+package file
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"testing"
+)
+
+type part struct {
+	filename    string
+	contentType string
+	content     []byte
+}
+
+type parts []part
+
+func (ps parts) names() []string {
+	names := make([]string, 0, len(ps))
+	for _, p := range ps {
+		names = append(names, p.filename)
+	}
+	return names
+}
+
+// readParts decodes multipart data, keeping the base of the escaped file
+// names as they are sent.
+func readParts(t *testing.T, data []byte, boundary string) (ps parts) {
+	return decodeParts(t, data, boundary, func(p *multipart.Part) string {
+		return p.FileName()
+	})
+}
+
+// rawParts decodes multipart data, keeping the file names as they are
+// sent.
+func rawParts(t *testing.T, data []byte, boundary string) (ps parts) {
+	return decodeParts(t, data, boundary, func(p *multipart.Part) string {
+		_, params, _ := mime.ParseMediaType(p.Header.Get("Content-Disposition"))
+		return params["filename"]
+	})
+}
+
+func decodeParts(t *testing.T, data []byte, boundary string, filename func(*multipart.Part) string) (ps parts) {
+	mr := multipart.NewReader(bytes.NewReader(data), boundary)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return ps
+		}
+		if err != nil {
+			t.Fatalf("Unexpected read part: %v", err)
+		}
+		content, err := ioutil.ReadAll(p)
+		if err != nil {
+			t.Fatalf("Unexpected read part content: %v", err)
+		}
+		ps = append(ps, part{
+			filename:    filename(p),
+			contentType: p.Header.Get("Content-Type"),
+			content:     content,
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package file
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/wabarc/ipfs-pinner/unixfs"
+)
+
+var mtime = time.Date(2023, 4, 1, 12, 30, 0, 0, time.UTC)
+
+func metadataTree(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "ipfs-pinner-metadata-")
+	if err != nil {
+		t.Fatalf("Unexpected create directory: %v", err)
+	}
+	writeTree(t, dir, map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	for name, mode := range map[string]os.FileMode{"a.txt": 0o640, "sub/b.txt": 0o600, "sub": 0o750, ".": 0o755} {
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.Chmod(fp, mode); err != nil {
+			t.Fatalf("Unexpected chmod: %v", err)
+		}
+		if err := os.Chtimes(fp, mtime, mtime); err != nil {
+			t.Fatalf("Unexpected chtimes: %v", err)
+		}
+	}
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestFilesMetadata(t *testing.T) {
+	dir, cleanup := metadataTree(t)
+	defer cleanup()
+
+	node, err := NewSerialFile(dir, PreserveMode(), PreserveMtime())
+	if err != nil {
+		t.Fatalf("Unexpected new a serial file: %v", err)
+	}
+	if !node.PreserveMetadata() {
+		t.Error("Unexpected metadata not preserved")
+	}
+	nd, err := node.Files()
+	if err != nil {
+		t.Fatalf("Unexpected convert node: %v", err)
+	}
+
+	got := make(map[string]os.FileMode)
+	err = files.Walk(nd, func(fpath string, nd files.Node) error {
+		md, ok := nd.(unixfs.Metadata)
+		if !ok {
+			t.Errorf("Unexpected %s without metadata", fpath)
+			return nil
+		}
+		if !md.ModTime().Equal(mtime) {
+			t.Errorf("Unexpected mtime of %s, got %v instead of %v", fpath, md.ModTime(), mtime)
+		}
+		got[fpath] = md.Mode().Perm()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected walk: %v", err)
+	}
+	expected := map[string]os.FileMode{"": 0o755, "a.txt": 0o640, "sub": 0o750, "sub/b.txt": 0o600}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected modes, got %v instead of %v", got, expected)
+	}
+}
+
+func TestSumMetadata(t *testing.T) {
+	dir, cleanup := metadataTree(t)
+	defer cleanup()
+
+	sum := func(opts ...Option) string {
+		node, err := NewSerialFile(dir, opts...)
+		if err != nil {
+			t.Fatalf("Unexpected new a serial file: %v", err)
+		}
+		nd, err := node.Files()
+		if err != nil {
+			t.Fatalf("Unexpected convert node: %v", err)
+		}
+		c, err := unixfs.Sum(nd)
+		if err != nil {
+			t.Fatalf("Unexpected sum: %v", err)
+		}
+		return c.String()
+	}
+
+	plain, mode, both := sum(), sum(PreserveMode()), sum(PreserveMode(), PreserveMtime())
+	if plain == mode || mode == both || plain == both {
+		t.Errorf("Unexpected cids not taking the metadata into account: %s, %s, %s", plain, mode, both)
+	}
+
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), mtime, mtime.Add(time.Second)); err != nil {
+		t.Fatalf("Unexpected chtimes: %v", err)
+	}
+	if sum(PreserveMode()) != mode {
+		t.Error("Unexpected cid depending on the mtime without PreserveMtime")
+	}
+	if sum(PreserveMode(), PreserveMtime()) == both {
+		t.Error("Unexpected cid not depending on the mtime with PreserveMtime")
+	}
+}
+
+func TestNewNodeReader(t *testing.T) {
+	dir, cleanup := metadataTree(t)
+	defer cleanup()
+
+	// Without metadata, the form is the same as the one of
+	// files.MultiFileReader.
+	mfr, err := NewMultiFileReader(dir, false)
+	if err != nil {
+		t.Fatalf("Unexpected creates multipart file: %v", err)
+	}
+	data, err := ioutil.ReadAll(mfr)
+	if err != nil {
+		t.Fatalf("Unexpected read multipart file: %v", err)
+	}
+	expected := rawParts(t, data, mfr.Boundary())
+
+	node, err := NewSerialFile(dir)
+	if err != nil {
+		t.Fatalf("Unexpected new a serial file: %v", err)
+	}
+	nd, err := node.Files()
+	if err != nil {
+		t.Fatalf("Unexpected convert node: %v", err)
+	}
+	fr := NewNodeReader(nd)
+	data, err = ioutil.ReadAll(fr)
+	if err != nil {
+		t.Fatalf("Unexpected read node reader: %v", err)
+	}
+	_, params, _ := mime.ParseMediaType(fr.ContentType())
+	if got := rawParts(t, data, params["boundary"]); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected parts, got %v instead of %v", got, expected)
+	}
+
+	// With metadata, every part carries it.
+	node, err = NewSerialFile(dir, PreserveMode(), PreserveMtime())
+	if err != nil {
+		t.Fatalf("Unexpected new a serial file: %v", err)
+	}
+	nd, err = node.Files()
+	if err != nil {
+		t.Fatalf("Unexpected convert node: %v", err)
+	}
+	fr = NewNodeReader(nd)
+	data, err = ioutil.ReadAll(fr)
+	if err != nil {
+		t.Fatalf("Unexpected read node reader: %v", err)
+	}
+	_, params, _ = mime.ParseMediaType(fr.ContentType())
+	modes := make(map[string]string)
+	got := decodeParts(t, data, params["boundary"], func(p *multipart.Part) string {
+		_, params, err := mime.ParseMediaType(p.Header.Get("Content-Disposition"))
+		if err != nil {
+			t.Fatalf("Unexpected content disposition: %v", err)
+		}
+		if params["mtime"] != strconv.FormatInt(mtime.Unix(), 10) || params["mtime-nsecs"] != "0" {
+			t.Errorf("Unexpected mtime of %q: %v", params["filename"], params)
+		}
+		modes[params["filename"]] = params["mode"]
+		return params["filename"]
+	})
+	if !reflect.DeepEqual(got.names(), expected.names()) {
+		t.Errorf("Unexpected parts, got %v instead of %v", got.names(), expected.names())
+	}
+	want := map[string]string{"": "0755", "a.txt": "0640", "sub": "0750", "sub%2Fb.txt": "0600"}
+	if !reflect.DeepEqual(modes, want) {
+		t.Errorf("Unexpected modes, got %v instead of %v", modes, want)
+	}
+}
@@ -1,52 +1,204 @@
 package file
 
 import (
-	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
 	"io"
+	"mime"
 	"net/http"
 	"os"
-	// "github.com/gabriel-vasile/mimetype"
+	"path/filepath"
+	"strings"
 )
 
+const (
+	defaultType = "application/octet-stream"
+
+	// sniffLen is the number of bytes considered by http.DetectContentType.
+	sniffLen = 512
+)
+
+// extTypes holds the media types of the archive formats produced by
+// archiving runs, which are unknown to or inconsistently registered in the
+// system mime tables.
+var extTypes = map[string]string{
+	".warc":    "application/warc",
+	".warc.gz": "application/warc",
+	".wacz":    "application/wacz",
+	".pdf":     "application/pdf",
+	".htm":     "text/html; charset=utf-8",
+	".html":    "text/html; charset=utf-8",
+}
+
+// waczEntries holds the names a WACZ package may start with.
+var waczEntries = []string{"datapackage.json", "datapackage-digest.json", "archive/", "indexes/", "pages/"}
+
 // MediaType returns the file's mime type. If the mime type cannot be
 // determined, it returns "application/octet-stream".
 //
-// The i should be a *os.File, io.Reader, or byte slice.
+// The i should be a *os.File, io.ReadSeeker, or byte slice, a reader is
+// rewound after sniffing. Other readers are not read, since the sniffed
+// bytes could not be restored, and are reported as
+// "application/octet-stream"; use DetectReader for them.
+//
+// Deprecated: use DetectFile, DetectReader or DetectBytes instead.
 func MediaType(i interface{}) string {
-	defaultType := "application/octet-stream"
-
-	// var err error
-	// var mtype *mimetype.MIME
-	// switch v := i.(type) {
-	// case *os.File:
-	// 	mtype, err = mimetype.DetectFile(v.Name())
-	// case io.Reader:
-	// 	mtype, err = mimetype.DetectReader(v)
-	// case []byte:
-	// 	mtype = mimetype.Detect(v)
-	// default:
-	// 	return defaultType
-	// }
-
-	// if err != nil {
-	// 	return defaultType
-	// }
-	// return mtype.String()
-
 	switch v := i.(type) {
 	case *os.File:
-		scanner := bufio.NewScanner(v)
-		return http.DetectContentType(scanner.Bytes())
-	case io.Reader:
-		rd := bufio.NewReader(v)
-		buf, err := rd.Peek(8192)
+		mtype, err := DetectFile(v)
 		if err != nil {
 			return defaultType
 		}
-		return http.DetectContentType(buf)
+		return mtype
+	case io.ReadSeeker:
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return defaultType
+		}
+		buf, err := readHead(v)
+		if _, serr := v.Seek(offset, io.SeekStart); err != nil || serr != nil {
+			return defaultType
+		}
+		return DetectBytes(buf, "")
 	case []byte:
-		return http.DetectContentType(v)
+		return DetectBytes(v, "")
 	}
 
 	return defaultType
 }
+
+// DetectFile returns the media type of f. It sniffs the content at the
+// current offset without moving it, and falls back to the extension of
+// the file name if the content is not recognized.
+func DetectFile(f *os.File) (string, error) {
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return defaultType, err
+	}
+	buf := make([]byte, sniffLen)
+	n, err := f.ReadAt(buf, offset)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return defaultType, err
+	}
+
+	return DetectBytes(buf[:n], f.Name()), nil
+}
+
+// DetectReader returns the media type of the content read from rd, and a
+// reader that yields the whole content, including the sniffed bytes. The
+// name is used to look up the media type by extension if the content is
+// not recognized, and may be empty.
+//
+// The caller must read from the returned reader instead of rd.
+func DetectReader(rd io.Reader, name string) (string, io.Reader, error) {
+	buf, err := readHead(rd)
+	if err != nil {
+		return defaultType, io.MultiReader(bytes.NewReader(buf), rd), err
+	}
+
+	return DetectBytes(buf, name), io.MultiReader(bytes.NewReader(buf), rd), nil
+}
+
+// DetectBytes returns the media type of buf. The name is used to look up
+// the media type by extension if the content is not recognized, and may
+// be empty.
+func DetectBytes(buf []byte, name string) string {
+	mtype := sniff(buf)
+	if !generic(mtype) {
+		return mtype
+	}
+	if ext := typeByExtension(name); ext != "" {
+		return ext
+	}
+
+	return mtype
+}
+
+// readHead reads up to sniffLen bytes from rd. A short input is not an
+// error.
+func readHead(rd io.Reader) ([]byte, error) {
+	buf := make([]byte, sniffLen)
+	n, err := io.ReadFull(rd, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+
+	return buf[:n], err
+}
+
+func sniff(buf []byte) string {
+	if len(buf) == 0 {
+		return defaultType
+	}
+	if bytes.HasPrefix(buf, []byte("WARC/")) {
+		return "application/warc"
+	}
+
+	mtype := http.DetectContentType(buf)
+	switch mtype {
+	case "application/x-gzip":
+		// A WARC file is commonly stored as a series of gzip members.
+		if zr, err := gzip.NewReader(bytes.NewReader(buf)); err == nil {
+			head := make([]byte, 5)
+			if _, err := io.ReadFull(zr, head); err == nil && string(head) == "WARC/" {
+				return "application/warc"
+			}
+		}
+	case "application/zip":
+		if isWACZ(buf) {
+			return "application/wacz"
+		}
+	}
+
+	return mtype
+}
+
+// isWACZ reports whether the first entry of the zip archive in buf is one
+// of the entries of a WACZ package.
+func isWACZ(buf []byte) bool {
+	// Local file header: the file name length is at offset 26, and the
+	// file name starts at offset 30.
+	if len(buf) < 30 {
+		return false
+	}
+	n := int(binary.LittleEndian.Uint16(buf[26:28]))
+	if len(buf) < 30+n {
+		return false
+	}
+	name := string(buf[30 : 30+n])
+	for _, entry := range waczEntries {
+		if name == entry || (strings.HasSuffix(entry, "/") && strings.HasPrefix(name, entry)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// generic reports whether mtype is too unspecific to be trusted over the
+// file extension.
+func generic(mtype string) bool {
+	switch mtype {
+	case defaultType, "text/plain; charset=utf-8", "application/zip", "application/x-gzip":
+		return true
+	}
+	return false
+}
+
+func typeByExtension(name string) string {
+	if name == "" {
+		return ""
+	}
+	base := strings.ToLower(filepath.Base(name))
+	if strings.HasSuffix(base, ".warc.gz") {
+		return extTypes[".warc.gz"]
+	}
+	ext := filepath.Ext(base)
+	if mtype, ok := extTypes[ext]; ok {
+		return mtype
+	}
+
+	return mime.TypeByExtension(ext)
+}
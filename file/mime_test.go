@@ -0,0 +1,160 @@
+package file
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/wabarc/helper"
+)
+
+const warcRecord = "WARC/1.1\r\nWARC-Type: warcinfo\r\nContent-Length: 0\r\n\r\n\r\n"
+
+func gzipBytes(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipBytes(t *testing.T, name string) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDetectBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		expected string
+	}{
+		{"empty", "", nil, "application/octet-stream"},
+		{"text", "", []byte("hello"), "text/plain; charset=utf-8"},
+		{"html", "", []byte("<!DOCTYPE html><html></html>"), "text/html; charset=utf-8"},
+		{"pdf", "", []byte("%PDF-1.7\n"), "application/pdf"},
+		{"warc", "", []byte(warcRecord), "application/warc"},
+		{"warc.gz", "", gzipBytes(t, warcRecord), "application/warc"},
+		{"gzip", "", gzipBytes(t, "hello"), "application/x-gzip"},
+		{"wacz", "", zipBytes(t, "datapackage.json"), "application/wacz"},
+		{"zip", "", zipBytes(t, "foo.txt"), "application/zip"},
+		{"zip with wacz extension", "foo.wacz", zipBytes(t, "foo.txt"), "application/wacz"},
+		{"gzip with warc extension", "foo.warc.gz", gzipBytes(t, "hello"), "application/warc"},
+		{"binary with pdf extension", "foo.PDF", []byte{0x00, 0x01}, "application/pdf"},
+		{"text with html extension", "foo.html", []byte("hello"), "text/html; charset=utf-8"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DetectBytes(test.data, test.filename); got != test.expected {
+				t.Errorf("Unexpected media type, got %q instead of %q", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestDetectReader(t *testing.T) {
+	// Larger than the sniffed bytes
+	content := "<!DOCTYPE html>" + helper.RandString(sniffLen*4, "lower")
+	mtype, r, err := DetectReader(strings.NewReader(content), "")
+	if err != nil {
+		t.Fatalf("Unexpected detect reader: %v", err)
+	}
+	if mtype != "text/html; charset=utf-8" {
+		t.Errorf("Unexpected media type: %s", mtype)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Unexpected read content: %v", err)
+	}
+	if string(data) != content {
+		t.Errorf("Unexpected content, sniffed bytes not restored")
+	}
+
+	// Smaller than the sniffed bytes
+	mtype, r, err = DetectReader(strings.NewReader(warcRecord), "")
+	if err != nil {
+		t.Fatalf("Unexpected detect reader: %v", err)
+	}
+	if mtype != "application/warc" {
+		t.Errorf("Unexpected media type: %s", mtype)
+	}
+	data, _ = ioutil.ReadAll(r)
+	if string(data) != warcRecord {
+		t.Errorf("Unexpected content, sniffed bytes not restored")
+	}
+}
+
+func TestDetectFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfs-pinner-mime-")
+	if err != nil {
+		t.Fatalf("Unexpected create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fp := filepath.Join(dir, "foo.pdf")
+	if err := ioutil.WriteFile(fp, []byte("%PDF-1.7\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	mtype, err := DetectFile(f)
+	if err != nil {
+		t.Fatalf("Unexpected detect file: %v", err)
+	}
+	if mtype != "application/pdf" {
+		t.Errorf("Unexpected media type: %s", mtype)
+	}
+	data, _ := ioutil.ReadAll(f)
+	if string(data) != "%PDF-1.7\n" {
+		t.Errorf("Unexpected file offset moved after detecting")
+	}
+}
+
+func TestMediaTypeReader(t *testing.T) {
+	content := "<!DOCTYPE html>" + helper.RandString(sniffLen, "lower")
+
+	rs := strings.NewReader(content)
+	if mtype := MediaType(rs); mtype != "text/html; charset=utf-8" {
+		t.Errorf("Unexpected media type: %s", mtype)
+	}
+	if rs.Len() != len(content) {
+		t.Errorf("Unexpected seeker not rewound after sniffing")
+	}
+
+	// A reader which cannot be rewound is left untouched.
+	rd := io.MultiReader(strings.NewReader(content))
+	if mtype := MediaType(rd); mtype != defaultType {
+		t.Errorf("Unexpected media type: %s", mtype)
+	}
+	data, _ := ioutil.ReadAll(rd)
+	if string(data) != content {
+		t.Errorf("Unexpected content consumed by sniffing")
+	}
+}
@@ -24,16 +24,17 @@ type MultiFileReader struct {
 
 // NewMultiFileReader constructs a files.MultiFileReader via github.com/ipfs/go-ipfs-files.
 // `path` can be any `commands.Directory`. If `form` is set to true, the Content-Disposition
-// will be "form-data". Otherwise, it will be "attachment".
+// will be "form-data". Otherwise, it will be "attachment". The options select the
+// entries taken from a directory, the same as NewSerialFile.
 //
 // It returns an io.Reader and error.
-func NewMultiFileReader(path string, form bool) (*files.MultiFileReader, error) {
-	stat, err := os.Lstat(path)
+func NewMultiFileReader(path string, form bool, opts ...Option) (*files.MultiFileReader, error) {
+	node, err := NewSerialFile(path, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	file, err := files.NewSerialFile(path, false, stat)
+	file, err := node.Files()
 	if err != nil {
 		return nil, err
 	}
@@ -54,9 +55,14 @@ func NewMultiFileReader(path string, form bool) (*files.MultiFileReader, error)
 // >
 // > node.MapDirectory("a-dir-name-show-in-pinning-service")
 func CreateMultiForm(node *Node, form bool) (mfr *MultiFileReader, err error) {
-	if len(node.files) == 0 {
+	if len(node.files) == 0 && (node.base == "" || !node.stat.IsDir()) {
 		return mfr, fmt.Errorf("node.files empty")
 	}
+	for i, fi := range node.files {
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return mfr, fmt.Errorf("%s: %w", node.paths[i], ErrSymlinkUnsupported)
+		}
+	}
 
 	dispositionPrefix := "attachment"
 	if form {
@@ -106,7 +112,28 @@ func CreateMultiForm(node *Node, form bool) (mfr *MultiFileReader, err error) {
 		_, _ = part.Write([]byte(m.data))
 	}
 
-	for _, fp := range node.paths {
+	// Directories are sent as application/x-directory parts, the same as
+	// files.MultiFileReader does, so that empty directories are kept.
+	dirHeader := func(filename string) textproto.MIMEHeader {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`%s; name="file"; filename="%s"`, dispositionPrefix, filepath.ToSlash(filename)))
+		header.Set("Content-Type", "application/x-directory")
+		return header
+	}
+	if node.stat.IsDir() && node.base != "" {
+		if _, err := writer.CreatePart(dirHeader(node.base)); err != nil {
+			return mfr, fmt.Errorf("error writing directory headers: %v", err)
+		}
+	}
+
+	for i, fp := range node.paths {
+		if node.files[i].IsDir() {
+			if _, err := writer.CreatePart(dirHeader(filepath.Join(node.base, fp))); err != nil {
+				return mfr, fmt.Errorf("error writing directory headers: %v", err)
+			}
+			continue
+		}
+
 		fn := node.root
 		switch {
 		case node.stat.IsDir():
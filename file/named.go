@@ -0,0 +1,15 @@
+package file
+
+import (
+	"io"
+)
+
+// NamedReader is content read from a stream, such as the standard input,
+// uploaded under a filename with a media type. Empty fields are chosen by
+// the pinner, a random name and a detected or generic media type.
+type NamedReader struct {
+	io.Reader
+
+	Name        string
+	ContentType string
+}
@@ -5,43 +5,70 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // Node represents a serial files.
 type Node struct {
 	base  string
 	root  string
-	files []os.FileInfo
-	paths []string // relative path
+	files []entry
+	paths []string // relative path, directories precede their entries
 	stat  os.FileInfo
+	usage Usage
+
+	preserveMode  bool
+	preserveMtime bool
+}
+
+// entry is the part of the os.FileInfo of an entry kept by a Node, which
+// is several times smaller for large trees. Its name shares the memory
+// of the path of the entry.
+type entry struct {
+	name  string
+	mode  os.FileMode
+	size  int64
+	mtime time.Time
+}
+
+var _ os.FileInfo = entry{}
+
+func newEntry(path string, fi os.FileInfo) entry {
+	return entry{name: filepath.Base(path), mode: fi.Mode(), size: fi.Size(), mtime: fi.ModTime()}
 }
 
+func (e entry) Name() string       { return e.name }
+func (e entry) Size() int64        { return e.size }
+func (e entry) Mode() os.FileMode  { return e.mode }
+func (e entry) ModTime() time.Time { return e.mtime }
+func (e entry) IsDir() bool        { return e.mode.IsDir() }
+func (e entry) Sys() interface{}   { return nil }
+
 // NewSerialFile adopts serial files and returns a Node represents a file,
-// directory, or special file.
-func NewSerialFile(root string) (node *Node, err error) {
+// directory, or special file. The options select the entries taken from a
+// directory.
+func NewSerialFile(root string, opts ...Option) (node *Node, err error) {
 	node = new(Node)
 	node.root = root
+	o := newFilter(opts).options
+	node.preserveMode, node.preserveMtime = o.preserveMode, o.preserveMtime
 	stat, err := os.Stat(root)
 	if err != nil {
-		return node, fmt.Errorf("lookup path failed: %v", err)
+		return node, fmt.Errorf("lookup path failed: %w", err)
 	}
 	node.stat = stat
 	switch mode := stat.Mode(); {
 	case mode.IsRegular():
-		node.files = append(node.files, stat)
+		node.files = append(node.files, newEntry(root, stat))
 		node.paths = append(node.paths, root)
+		node.usage.count(stat)
 	case mode.IsDir():
-		err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
-			if !fi.IsDir() {
-				path = strings.TrimPrefix(path, root)
-				path = strings.TrimPrefix(path, "/")
-				node.paths = append(node.paths, path)
-				node.files = append(node.files, fi)
-			}
-			return nil
-		})
+		w, err := newWalker(root, opts)
 		if err != nil {
-			return node, fmt.Errorf("read directory failed: %v", err)
+			return node, fmt.Errorf("read directory failed: %w", err)
+		}
+		if node.usage, err = w.walk(node, root, "", scope{}); err != nil {
+			return node, fmt.Errorf("read directory failed: %w", err)
 		}
 	default:
 		return node, fmt.Errorf("unrecognized file type for %s: %s", root, mode.String())
@@ -49,6 +76,173 @@ func NewSerialFile(root string) (node *Node, err error) {
 	return
 }
 
+// walker walks a directory tree, applying the filter and the symlink
+// policy.
+type walker struct {
+	filter *filter
+	// warn reports the entries skipped with an error, if not nil.
+	warn func(error)
+
+	// realRoot is the root with symbolic links resolved.
+	realRoot string
+}
+
+// scope is the state of the walk inherited by the entries of a
+// directory.
+type scope struct {
+	rules []rule
+	// ancestors holds the resolved paths of the directories being walked,
+	// to detect followed links forming a loop.
+	ancestors *ancestor
+}
+
+type ancestor struct {
+	path   string
+	parent *ancestor
+}
+
+func (a *ancestor) contains(path string) bool {
+	for ; a != nil; a = a.parent {
+		if a.path == path {
+			return true
+		}
+	}
+	return false
+}
+
+// child is a selected entry of a directory.
+type child struct {
+	name string
+	fi   os.FileInfo
+}
+
+func newWalker(root string, opts []Option) (*walker, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+
+	f := newFilter(opts)
+	return &walker{
+		filter:   f,
+		warn:     f.warn,
+		realRoot: realRoot,
+	}, nil
+}
+
+// readDir returns the entries of the directory at path, whose path
+// relative to the root is rel, selected by the filter. Followed links
+// come with the file info of their target. It also returns the scope of
+// the entries.
+func (w *walker) readDir(path, rel string, parent scope) ([]child, scope, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, scope{}, err
+	}
+	rules, err := w.filter.load(path, filepath.ToSlash(rel), parent.rules)
+	if err != nil {
+		return nil, scope{}, err
+	}
+	sc := scope{rules: rules, ancestors: &ancestor{path: resolved, parent: parent.ancestors}}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, scope{}, err
+	}
+	children := make([]child, 0, len(entries))
+	for _, entry := range entries {
+		fp := filepath.Join(path, entry.Name())
+		fi, err := entry.Info()
+		if err != nil {
+			return nil, scope{}, err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			switch w.filter.symlinks {
+			case SymlinkSkip:
+				continue
+			case SymlinkFollow:
+				// A link which cannot be followed is skipped, rather
+				// than failing the whole tree.
+				if fi, err = w.follow(fp, sc.ancestors); err != nil {
+					if w.warn != nil {
+						w.warn(err)
+					}
+					continue
+				}
+			}
+		}
+		if w.filter.excluded(filepath.ToSlash(filepath.Join(rel, entry.Name())), fi, sc.rules) {
+			continue
+		}
+		children = append(children, child{name: entry.Name(), fi: fi})
+	}
+
+	return children, sc, nil
+}
+
+// walk records the entries of the directory at path, whose path relative
+// to the root is rel, in node, and returns their usage.
+func (w *walker) walk(node *Node, path, rel string, parent scope) (u Usage, err error) {
+	children, sc, err := w.readDir(path, rel, parent)
+	if err != nil {
+		return u, err
+	}
+	for _, c := range children {
+		fp := filepath.Join(path, c.name)
+		rp := filepath.Join(rel, c.name)
+		if !c.fi.IsDir() {
+			node.paths = append(node.paths, rp)
+			node.files = append(node.files, newEntry(rp, c.fi))
+			u.count(c.fi)
+			continue
+		}
+
+		// Directories are recorded before their entries, so that empty
+		// directories are kept and are created before their contents.
+		n := len(node.paths)
+		node.paths = append(node.paths, rp)
+		node.files = append(node.files, newEntry(rp, c.fi))
+		su, err := w.walk(node, fp, rp, sc)
+		if err != nil {
+			return u, err
+		}
+		// Directories left empty only because no file matches the
+		// include patterns are dropped.
+		if w.filter.include != nil && len(node.paths) == n+1 {
+			node.paths = node.paths[:n]
+			node.files = node.files[:n]
+			continue
+		}
+		su.count(c.fi)
+		u.add(su)
+	}
+
+	return u, nil
+}
+
+// follow resolves the link at path, and returns the file info of its
+// target. It refuses links pointing outside of the root or to a directory
+// being walked.
+func (w *walker) follow(path string, ancestors *ancestor) (os.FileInfo, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, fmt.Errorf("skip symlink %s: %w", path, err)
+	}
+	rel, err := filepath.Rel(w.realRoot, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, fmt.Errorf("skip symlink %s: %w", path, ErrSymlinkEscape)
+	}
+	if ancestors.contains(resolved) {
+		return nil, fmt.Errorf("skip symlink %s: %w", path, ErrSymlinkLoop)
+	}
+
+	fi, err := os.Stat(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("skip symlink %s: %w", path, err)
+	}
+	return fi, nil
+}
+
 // MapDirectory sets up a new target directory by given path name.
 func (n *Node) MapDirectory(name string) {
 	if n.stat.IsDir() {
@@ -56,38 +250,46 @@ func (n *Node) MapDirectory(name string) {
 	}
 }
 
+// Root returns the path the Node was created from.
+func (n *Node) Root() string {
+	return n.root
+}
+
 // Mode returns a os.FileMode of Node
 func (n *Node) Mode() os.FileMode {
 	return n.stat.Mode()
 }
 
-// Size returns the file size of the Node.
-func (n *Node) Size() (du int64, err error) {
-	if len(n.files) == 0 {
-		return 0, fmt.Errorf("node is empty")
-	}
+// PreserveMode reports whether the mode of the entries is preserved.
+func (n *Node) PreserveMode() bool {
+	return n.preserveMode
+}
 
-	for _, fi := range n.files {
-		if fi.Mode().IsRegular() {
-			du += fi.Size()
-		}
-		if fi.Mode().IsDir() {
-			err = filepath.Walk(fi.Name(), func(p string, fi os.FileInfo, err error) error {
-				if err != nil || fi == nil {
-					return err
-				}
+// PreserveMtime reports whether the modification time of the entries is
+// preserved.
+func (n *Node) PreserveMtime() bool {
+	return n.preserveMtime
+}
 
-				if fi.Mode().IsRegular() {
-					du += fi.Size()
-				}
+// PreserveMetadata reports whether the mode or the modification time of
+// the entries is preserved.
+func (n *Node) PreserveMetadata() bool {
+	return n.preserveMode || n.preserveMtime
+}
 
-				return nil
-			})
-			if err != nil {
-				return 0, fmt.Errorf("walk directory failed: %v", err)
-			}
-		}
+// Usage returns the disk usage of the entries of the Node, counted by
+// NewSerialFile while walking them. The size of a followed link is the
+// size of its target.
+func (n *Node) Usage() Usage {
+	return n.usage
+}
+
+// Size returns the file size of the Node, the total size of its regular
+// files.
+func (n *Node) Size() (du int64, err error) {
+	if len(n.files) == 0 {
+		return 0, fmt.Errorf("node is empty")
 	}
 
-	return du, err
+	return n.usage.Bytes, nil
 }
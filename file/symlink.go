@@ -0,0 +1,70 @@
+package file
+
+import (
+	"errors"
+)
+
+// SymlinkMode is the policy applied to the symbolic links found in a
+// directory.
+type SymlinkMode int
+
+const (
+	// SymlinkFollow pins the file or directory a link points to, in place
+	// of the link. Links pointing outside of the root, dangling links and
+	// links forming a loop are skipped, and reported to the Warn option.
+	SymlinkFollow SymlinkMode = iota
+
+	// SymlinkSkip leaves links out.
+	SymlinkSkip
+
+	// SymlinkPreserve pins links as UnixFS symlink nodes holding the link
+	// target as it is. Only the pinning services taking a Kubo compatible
+	// upload, such as Infura, support it.
+	SymlinkPreserve
+)
+
+var (
+	// ErrSymlinkEscape is reported when a followed link points outside
+	// of the root.
+	ErrSymlinkEscape = errors.New("symlink points outside of the root")
+
+	// ErrSymlinkLoop is reported when a followed link points to one of
+	// the directories holding it.
+	ErrSymlinkLoop = errors.New("symlink loop")
+
+	// ErrSymlinkUnsupported is returned when preserved links are
+	// uploaded in a form that cannot represent them.
+	ErrSymlinkUnsupported = errors.New("symlinks are not supported by the upload form")
+)
+
+// Symlinks sets the policy applied to the symbolic links found in a
+// directory, SymlinkFollow by default. A symbolic link given as the root
+// is always followed.
+func Symlinks(mode SymlinkMode) Option {
+	return func(o *options) {
+		o.symlinks = mode
+	}
+}
+
+func (m SymlinkMode) String() string {
+	switch m {
+	case SymlinkFollow:
+		return "follow"
+	case SymlinkSkip:
+		return "skip"
+	case SymlinkPreserve:
+		return "preserve"
+	}
+	return "unknown"
+}
+
+// ParseSymlinkMode returns the SymlinkMode named s, one of "follow",
+// "skip" or "preserve".
+func ParseSymlinkMode(s string) (SymlinkMode, error) {
+	for _, m := range []SymlinkMode{SymlinkFollow, SymlinkSkip, SymlinkPreserve} {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return SymlinkFollow, errors.New("unknown symlink mode: " + s)
+}
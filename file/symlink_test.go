@@ -0,0 +1,166 @@
+package file
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func symlinkTree(t *testing.T) (string, func()) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on Windows")
+	}
+
+	dir, err := ioutil.TempDir("", "ipfs-pinner-symlink-")
+	if err != nil {
+		t.Fatalf("Unexpected create directory: %v", err)
+	}
+	writeTree(t, dir, map[string]string{
+		"a.txt":     "a",
+		"sub/b.txt": "b",
+	})
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub", filepath.Join(dir, "linkdir")); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func TestNewSerialFileSymlinks(t *testing.T) {
+	dir, cleanup := symlinkTree(t)
+	defer cleanup()
+
+	tests := []struct {
+		mode     SymlinkMode
+		expected []string
+	}{
+		{SymlinkFollow, []string{"a.txt", "link.txt", "linkdir/b.txt", "sub/b.txt"}},
+		{SymlinkSkip, []string{"a.txt", "sub/b.txt"}},
+		{SymlinkPreserve, []string{"a.txt", "link.txt", "linkdir", "sub/b.txt"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode.String(), func(t *testing.T) {
+			node, err := NewSerialFile(dir, Symlinks(test.mode))
+			if err != nil {
+				t.Fatalf("Unexpected new a serial file: %v", err)
+			}
+			if got := nodePaths(node); !reflect.DeepEqual(got, test.expected) {
+				t.Errorf("Unexpected paths, got %v instead of %v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestNewSerialFileSymlinkRefused(t *testing.T) {
+	outside, err := ioutil.TempDir("", "ipfs-pinner-outside-")
+	if err != nil {
+		t.Fatalf("Unexpected create directory: %v", err)
+	}
+	defer os.RemoveAll(outside)
+
+	tests := []struct {
+		name     string
+		target   string
+		expected error
+	}{
+		{"escape", outside, ErrSymlinkEscape},
+		{"loop", "..", ErrSymlinkLoop},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, cleanup := symlinkTree(t)
+			defer cleanup()
+
+			if err := os.Symlink(test.target, filepath.Join(dir, "sub", "bad")); err != nil {
+				t.Fatal(err)
+			}
+			// The link is skipped and reported, the rest of the tree is taken.
+			var warnings []error
+			node, err := NewSerialFile(dir, Warn(func(err error) { warnings = append(warnings, err) }))
+			if err != nil {
+				t.Fatalf("Unexpected new a serial file: %v", err)
+			}
+			if len(warnings) == 0 {
+				t.Fatal("Unexpected refused link not reported")
+			}
+			for _, err := range warnings {
+				if !errors.Is(err, test.expected) {
+					t.Errorf("Unexpected warning, got %v instead of %v", err, test.expected)
+				}
+			}
+			for _, p := range node.paths {
+				if filepath.Base(p) == "bad" {
+					t.Errorf("Unexpected refused link %s taken", p)
+				}
+			}
+			// Preserved links are not resolved
+			if _, err := NewSerialFile(dir, Symlinks(SymlinkPreserve)); err != nil {
+				t.Fatalf("Unexpected new a serial file: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewSerialFileDanglingSymlink(t *testing.T) {
+	dir, cleanup := symlinkTree(t)
+	defer cleanup()
+
+	link := filepath.Join(dir, "dangling")
+	if err := os.Symlink("missing", link); err != nil {
+		t.Fatal(err)
+	}
+	var warnings []error
+	if _, err := NewSerialFile(dir, Warn(func(err error) { warnings = append(warnings, err) })); err != nil {
+		t.Fatalf("Unexpected new a serial file: %v", err)
+	}
+	if len(warnings) != 1 || !errors.Is(warnings[0], os.ErrNotExist) {
+		t.Errorf("Unexpected warnings %v", warnings)
+	}
+	// A dangling link given as the root fails.
+	if _, err := NewSerialFile(link); err == nil {
+		t.Error("Unexpected new a serial file of a dangling link")
+	}
+}
+
+func TestSymlinkPreserveUpload(t *testing.T) {
+	dir, cleanup := symlinkTree(t)
+	defer cleanup()
+
+	mfr, err := NewMultiFileReader(dir, false, Symlinks(SymlinkPreserve))
+	if err != nil {
+		t.Fatalf("Unexpected creates multipart file: %v", err)
+	}
+	data, err := ioutil.ReadAll(mfr)
+	if err != nil {
+		t.Fatalf("Unexpected read multipart file: %v", err)
+	}
+	var found bool
+	for _, p := range readParts(t, data, mfr.Boundary()) {
+		if p.filename == "link.txt" {
+			found = true
+			if p.contentType != "application/symlink" || string(p.content) != "a.txt" {
+				t.Errorf("Unexpected symlink part, got %q with %q", p.contentType, p.content)
+			}
+		}
+	}
+	if !found {
+		t.Error("Unexpected symlink part missing")
+	}
+
+	node, err := NewSerialFile(dir, Symlinks(SymlinkPreserve))
+	if err != nil {
+		t.Fatalf("Unexpected new a serial file: %v", err)
+	}
+	if _, err := CreateMultiForm(node, true); !errors.Is(err, ErrSymlinkUnsupported) {
+		t.Fatalf("Unexpected error, got %v instead of %v", err, ErrSymlinkUnsupported)
+	}
+}
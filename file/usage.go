@@ -0,0 +1,134 @@
+package file
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// Usage is the disk usage of the entries of a Node.
+type Usage struct {
+	// Bytes is the total size of the regular files.
+	Bytes int64
+	// Files is the number of regular files.
+	Files int
+	// Dirs is the number of directories, not counting the root.
+	Dirs int
+	// Symlinks is the number of preserved symbolic links.
+	Symlinks int
+}
+
+func (u *Usage) add(v Usage) {
+	u.Bytes += v.Bytes
+	u.Files += v.Files
+	u.Dirs += v.Dirs
+	u.Symlinks += v.Symlinks
+}
+
+// count adds the entry fi to the usage.
+func (u *Usage) count(fi os.FileInfo) {
+	switch mode := fi.Mode(); {
+	case mode.IsRegular():
+		u.Files++
+		u.Bytes += fi.Size()
+	case mode.IsDir():
+		u.Dirs++
+	case mode&os.ModeSymlink != 0:
+		u.Symlinks++
+	}
+}
+
+// DiskUsage returns the disk usage of root, counting the entries
+// NewSerialFile(root, opts...) would take, without keeping them. It suits
+// progress totals and size limits of very large trees. Directories are
+// walked concurrently.
+func DiskUsage(root string, opts ...Option) (Usage, error) {
+	stat, err := os.Stat(root)
+	if err != nil {
+		return Usage{}, fmt.Errorf("lookup path failed: %w", err)
+	}
+	var u Usage
+	switch mode := stat.Mode(); {
+	case mode.IsRegular():
+		u.count(stat)
+		return u, nil
+	case !mode.IsDir():
+		return u, fmt.Errorf("unrecognized file type for %s: %s", root, mode.String())
+	}
+
+	w, err := newWalker(root, opts)
+	if err != nil {
+		return u, fmt.Errorf("read directory failed: %w", err)
+	}
+	// The skipped entries are reported by NewSerialFile only, rather than
+	// once more for the totals.
+	w.warn = nil
+	du := &diskUsage{walker: w, sem: make(chan struct{}, 4*runtime.GOMAXPROCS(0))}
+	if u, err = du.walk(root, "", scope{}); err != nil {
+		return u, fmt.Errorf("read directory failed: %w", err)
+	}
+
+	return u, nil
+}
+
+// diskUsage counts the entries of a tree. Subdirectories are walked by
+// new goroutines while sem has room, and by the current one otherwise.
+type diskUsage struct {
+	*walker
+
+	sem chan struct{}
+}
+
+func (du *diskUsage) walk(path, rel string, parent scope) (u Usage, err error) {
+	children, sc, err := du.readDir(path, rel, parent)
+	if err != nil {
+		return u, err
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	walkDir := func(c child) {
+		su, e := du.walk(filepath.Join(path, c.name), filepath.Join(rel, c.name), sc)
+		mu.Lock()
+		defer mu.Unlock()
+		if e != nil {
+			if err == nil {
+				err = e
+			}
+			return
+		}
+		// Directories left empty only because no file matches the include
+		// patterns are dropped, the same as NewSerialFile does.
+		if du.filter.include != nil && su == (Usage{}) {
+			return
+		}
+		su.count(c.fi)
+		u.add(su)
+	}
+	for _, c := range children {
+		if !c.fi.IsDir() {
+			mu.Lock()
+			u.count(c.fi)
+			mu.Unlock()
+			continue
+		}
+		select {
+		case du.sem <- struct{}{}:
+			wg.Add(1)
+			go func(c child) {
+				defer wg.Done()
+				defer func() { <-du.sem }()
+				walkDir(c)
+			}(c)
+		default:
+			walkDir(c)
+		}
+	}
+	wg.Wait()
+
+	return u, err
+}
@@ -0,0 +1,133 @@
+package file
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestUsage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfs-pinner-usage-")
+	if err != nil {
+		t.Fatalf("Unexpected create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	writeTree(t, dir, map[string]string{
+		"a.txt":          "aaa",
+		".hidden":        "hidden",
+		"sub/b.txt":      "bb",
+		"sub/deep/c.log": "c",
+		"other/d.log":    "dddd",
+	})
+	if err := os.Mkdir(dir+"/empty", 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		expected Usage
+	}{
+		{"all", nil, Usage{Bytes: 16, Files: 5, Dirs: 4}},
+		{"skip hidden", []Option{SkipHidden()}, Usage{Bytes: 10, Files: 4, Dirs: 4}},
+		{"include", []Option{Include("*.log")}, Usage{Bytes: 5, Files: 2, Dirs: 3}},
+		{"exclude", []Option{Exclude("sub/")}, Usage{Bytes: 13, Files: 3, Dirs: 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			node, err := NewSerialFile(dir, test.opts...)
+			if err != nil {
+				t.Fatalf("Unexpected new a serial file: %v", err)
+			}
+			if got := node.Usage(); got != test.expected {
+				t.Errorf("Unexpected usage of the node, got %+v instead of %+v", got, test.expected)
+			}
+			if size, err := node.Size(); err != nil || size != test.expected.Bytes {
+				t.Errorf("Unexpected size, got %d (%v) instead of %d", size, err, test.expected.Bytes)
+			}
+			got, err := DiskUsage(dir, test.opts...)
+			if err != nil {
+				t.Fatalf("Unexpected disk usage: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("Unexpected disk usage, got %+v instead of %+v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestUsageSymlinks(t *testing.T) {
+	dir, cleanup := symlinkTree(t)
+	defer cleanup()
+
+	tests := []struct {
+		mode     SymlinkMode
+		expected Usage
+	}{
+		{SymlinkFollow, Usage{Bytes: 4, Files: 4, Dirs: 2}},
+		{SymlinkSkip, Usage{Bytes: 2, Files: 2, Dirs: 1}},
+		{SymlinkPreserve, Usage{Bytes: 2, Files: 2, Dirs: 1, Symlinks: 2}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode.String(), func(t *testing.T) {
+			node, err := NewSerialFile(dir, Symlinks(test.mode))
+			if err != nil {
+				t.Fatalf("Unexpected new a serial file: %v", err)
+			}
+			if got := node.Usage(); got != test.expected {
+				t.Errorf("Unexpected usage of the node, got %+v instead of %+v", got, test.expected)
+			}
+			got, err := DiskUsage(dir, Symlinks(test.mode))
+			if err != nil {
+				t.Fatalf("Unexpected disk usage: %v", err)
+			}
+			if got != test.expected {
+				t.Errorf("Unexpected disk usage, got %+v instead of %+v", got, test.expected)
+			}
+		})
+	}
+}
+
+func TestDiskUsageLargeTree(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfs-pinner-usage-")
+	if err != nil {
+		t.Fatalf("Unexpected create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tree := make(map[string]string)
+	var expected Usage
+	for i := 0; i < 40; i++ {
+		for j := 0; j < 5; j++ {
+			content := strings.Repeat("x", i+j)
+			tree[fmt.Sprintf("d%d/e%d/f%d", i, j%2, j)] = content
+			expected.Files++
+			expected.Bytes += int64(len(content))
+		}
+		expected.Dirs += 3
+	}
+	writeTree(t, dir, tree)
+
+	got, err := DiskUsage(dir)
+	if err != nil {
+		t.Fatalf("Unexpected disk usage: %v", err)
+	}
+	if got != expected {
+		t.Errorf("Unexpected disk usage, got %+v instead of %+v", got, expected)
+	}
+}
+
+func TestDiskUsageFile(t *testing.T) {
+	got, err := DiskUsage("usage_test.go")
+	if err != nil {
+		t.Fatalf("Unexpected disk usage: %v", err)
+	}
+	fi, _ := os.Stat("usage_test.go")
+	if got != (Usage{Bytes: fi.Size(), Files: 1}) {
+		t.Errorf("Unexpected disk usage %+v", got)
+	}
+}
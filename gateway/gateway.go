@@ -0,0 +1,319 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package gateway checks that content is retrievable from IPFS, by fetching
+it from trustless HTTP gateways and verifying it against its CID.
+
+Pinning services may report a CID long before the content can be fetched
+from the network. A Verifier fetches the whole DAG of a CID as a CAR
+archive, or its root block only in the raw mode, and retries with backoff
+across gateways until it succeeds or its deadline passes. A gateway is not
+trusted: every block must hash to its CID, and every block of the DAG must
+be present.
+
+Kubo fetches content the same way from the RPC API of a Kubo node, and
+Blocks indexes the verified blocks of a source to read them back.
+*/
+package gateway // import "github.com/wabarc/ipfs-pinner/gateway"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/wabarc/ipfs-pinner/unixfs"
+
+	httpretry "github.com/wabarc/ipfs-pinner/http"
+)
+
+// Formats of the responses of trustless gateways.
+const (
+	FormatCAR = "car"
+	FormatRaw = "raw"
+)
+
+// Defaults of a Verifier.
+const (
+	DefaultTimeout = 2 * time.Minute
+	DefaultBackoff = time.Second
+	// MaxBackoff is the longest wait between two rounds of attempts.
+	MaxBackoff = 30 * time.Second
+)
+
+// maxBlock is the largest block read in the raw mode.
+const maxBlock = 4 << 20
+
+// ErrUnretrievable is returned, wrapped, for content that could not be
+// fetched and verified before the deadline.
+var ErrUnretrievable = errors.New("not retrievable")
+
+// Verifier checks that content is retrievable through gateways.
+type Verifier struct {
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+	// Gateways are the base URLs of the gateways, such as https://ipfs.io,
+	// tried in turn.
+	Gateways []string
+	// Format is FormatCAR, the default, or FormatRaw.
+	Format string
+	// Timeout is the deadline of a verification, DefaultTimeout if zero.
+	Timeout time.Duration
+	// Backoff is the wait after the first round of failed attempts,
+	// doubled after every round up to MaxBackoff. DefaultBackoff if zero.
+	Backoff time.Duration
+}
+
+// Result is the outcome of a successful verification.
+type Result struct {
+	// Gateway is the gateway the content was fetched from.
+	Gateway string
+	// Blocks is the number of blocks verified, and Size their total size.
+	Blocks int
+	Size   int64
+	// Attempts is the number of requests sent.
+	Attempts int
+}
+
+// Verify fetches c from the gateways until the content is verified, or
+// the deadline passes or ctx is done. It returns an error wrapping
+// ErrUnretrievable and the error of the last attempt if it is not verified.
+func (v *Verifier) Verify(ctx context.Context, c cid.Cid) (Result, error) {
+	format := v.Format
+	switch format {
+	case "":
+		format = FormatCAR
+	case FormatCAR, FormatRaw:
+	default:
+		return Result{}, fmt.Errorf("unsupported gateway format %s", format)
+	}
+	return v.retrieve(ctx, c, format, nil)
+}
+
+// FetchCAR fetches the CAR archive of the DAG of c like Verify, whatever
+// Format is, and returns it once verified. The archive is kept in a
+// temporary file, removed on Close.
+func (v *Verifier) FetchCAR(ctx context.Context, c cid.Cid) (io.ReadCloser, Result, error) {
+	f, err := os.CreateTemp("", "ipfs-pinner-*.car")
+	if err != nil {
+		return nil, Result{}, err
+	}
+	tmp := &tempFile{f}
+	// Every attempt writes the archive from scratch.
+	reset := func() (io.Writer, error) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return f, f.Truncate(0)
+	}
+	res, err := v.retrieve(ctx, c, FormatCAR, reset)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		return nil, res, err
+	}
+	return tmp, res, nil
+}
+
+// Fetch fetches the content of the UnixFS file c through a verified CAR
+// archive, as FetchCAR does, and returns a reader of the file reassembled
+// from its blocks. It returns unixfs.ErrNotFile, wrapped, if c is not a file.
+func (v *Verifier) Fetch(ctx context.Context, c cid.Cid) (io.ReadCloser, Result, error) {
+	dag, closer, res, err := Blocks(ctx, v, c)
+	if err != nil {
+		return nil, res, err
+	}
+	r, err := unixfs.NewFileReader(c, dag)
+	if err != nil {
+		closer.Close()
+		return nil, res, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, closer}, res, nil
+}
+
+// tempFile is a temporary file removed on Close.
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	err := f.File.Close()
+	if rmErr := os.Remove(f.Name()); err == nil {
+		err = rmErr
+	}
+	return err
+}
+
+// retrieve fetches c in format from the gateways until it is verified, with
+// backoff between rounds. If reset is not nil, the response of every
+// attempt is copied to the writer it returns.
+func (v *Verifier) retrieve(ctx context.Context, c cid.Cid, format string, reset func() (io.Writer, error)) (Result, error) {
+	if len(v.Gateways) == 0 {
+		return Result{}, errors.New("no gateway to verify with")
+	}
+	timeout := v.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	backoff := v.Backoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		res     Result
+		lastErr error
+	)
+	for {
+		for _, gw := range v.Gateways {
+			var w io.Writer
+			if reset != nil {
+				var err error
+				if w, err = reset(); err != nil {
+					return res, err
+				}
+			}
+			res.Attempts++
+			blocks, size, err := v.fetch(ctx, gw, c, format, w)
+			if err == nil {
+				res.Gateway, res.Blocks, res.Size = gw, blocks, size
+				return res, nil
+			}
+			lastErr = fmt.Errorf("%s: %w", gw, err)
+			if ctx.Err() != nil {
+				return res, unretrievable(c, res.Attempts, lastErr)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return res, unretrievable(c, res.Attempts, lastErr)
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > MaxBackoff {
+			backoff = MaxBackoff
+		}
+	}
+}
+
+func unretrievable(c cid.Cid, attempts int, err error) error {
+	return fmt.Errorf("%s %w after %d attempts: %v", c, ErrUnretrievable, attempts, err)
+}
+
+// fetch fetches c from a gateway and verifies it, returning the number of
+// blocks and their total size. The response is copied to w if not nil.
+func (v *Verifier) fetch(ctx context.Context, gw string, c cid.Cid, format string, w io.Writer) (int, int64, error) {
+	u, err := url.Parse(strings.TrimRight(gw, "/") + "/ipfs/" + c.String())
+	if err != nil {
+		return 0, 0, err
+	}
+	u.RawQuery = url.Values{"format": {format}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Accept", "application/vnd.ipld."+format)
+
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, httpretry.NewStatusError(resp)
+	}
+	var body io.Reader = resp.Body
+	if w != nil {
+		body = io.TeeReader(resp.Body, w)
+	}
+
+	if format == FormatRaw {
+		data, err := io.ReadAll(io.LimitReader(body, maxBlock+1))
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(data) > maxBlock {
+			return 0, 0, fmt.Errorf("block of %s larger than %d bytes", c, maxBlock)
+		}
+		if err := unixfs.Check(unixfs.Block{Cid: c, Data: data}); err != nil {
+			return 0, 0, err
+		}
+		return 1, int64(len(data)), nil
+	}
+	return verifyCAR(body, c)
+}
+
+// verifyCAR reads the CAR archive of the DAG of root from r, and checks
+// that every block of the DAG is present and matches its CID. The links of
+// blocks of codecs other than dag-pb and raw are not followed.
+func verifyCAR(r io.Reader, root cid.Cid) (int, int64, error) {
+	cr, err := unixfs.NewCARReader(r)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(cr.Roots) == 0 || !cr.Roots[0].Equals(root) {
+		return 0, 0, fmt.Errorf("car roots %v do not match %s", cr.Roots, root)
+	}
+
+	var (
+		blocks int
+		size   int64
+		// Blocks are keyed by multihash, as a gateway may send them
+		// under another CID version than the one of the links.
+		seen = make(map[string]bool)
+		// missing are the blocks linked to which were not read yet.
+		missing = map[string]bool{string(root.Hash()): true}
+	)
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		key := string(blk.Cid.Hash())
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		delete(missing, key)
+		blocks++
+		size += int64(len(blk.Data))
+
+		links, err := unixfs.Links(blk)
+		if err != nil && blk.Cid.Type() == cid.DagProtobuf {
+			return 0, 0, err
+		}
+		for _, l := range links {
+			// Identity CIDs hold their data, and need no block.
+			if !seen[string(l.Hash())] && l.Prefix().MhType != multihash.IDENTITY {
+				missing[string(l.Hash())] = true
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return 0, 0, fmt.Errorf("car of %s misses %d blocks", root, len(missing))
+	}
+	return blocks, size, nil
+}
@@ -0,0 +1,184 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/go-cid"
+	"github.com/wabarc/ipfs-pinner/unixfs"
+)
+
+// content returns the CAR archive of a file of several blocks, its root
+// and the data of its root block.
+func content(t *testing.T) ([]byte, cid.Cid, []byte) {
+	t.Helper()
+
+	data := bytes.Repeat([]byte("ipfs-pinner"), unixfs.DefaultChunkSize/4)
+	var buf bytes.Buffer
+	root, err := unixfs.WriteCAR(&buf, files.NewBytesFile(data))
+	if err != nil {
+		t.Fatalf("Unexpected write car: %v", err)
+	}
+	var rootData []byte
+	_, _ = unixfs.Sum(files.NewBytesFile(data), unixfs.OnBlock(func(blk unixfs.Block) error {
+		if blk.Cid.Equals(root) {
+			rootData = blk.Data
+		}
+		return nil
+	}))
+	return buf.Bytes(), root, rootData
+}
+
+// gateway returns a trustless gateway serving c, failing the first
+// requests with a gateway timeout.
+func gateway(t *testing.T, archive []byte, c cid.Cid, block []byte, failures int32) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		if r.URL.Path != "/ipfs/"+c.String() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.URL.Query().Get("format") {
+		case FormatCAR:
+			if r.Header.Get("Accept") != "application/vnd.ipld.car" {
+				t.Errorf("Unexpected accept %s", r.Header.Get("Accept"))
+			}
+			_, _ = w.Write(archive)
+		case FormatRaw:
+			_, _ = w.Write(block)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestVerify(t *testing.T) {
+	archive, root, block := content(t)
+	srv, _ := gateway(t, archive, root, block, 0)
+
+	for _, format := range []string{FormatCAR, FormatRaw} {
+		v := &Verifier{Gateways: []string{srv.URL + "/"}, Format: format}
+		res, err := v.Verify(context.Background(), root)
+		if err != nil {
+			t.Fatalf("Unexpected verify with %s: %v", format, err)
+		}
+		if res.Gateway != srv.URL+"/" || res.Attempts != 1 || res.Blocks == 0 || res.Size == 0 {
+			t.Errorf("Unexpected result with %s: %+v", format, res)
+		}
+		if format == FormatCAR && res.Blocks < 2 {
+			t.Errorf("Unexpected blocks of the car %d", res.Blocks)
+		}
+	}
+}
+
+func TestVerifyRetries(t *testing.T) {
+	archive, root, block := content(t)
+	down := httptest.NewServer(http.NotFoundHandler())
+	defer down.Close()
+	srv, requests := gateway(t, archive, root, block, 1)
+
+	v := &Verifier{Gateways: []string{down.URL, srv.URL}, Backoff: time.Millisecond}
+	res, err := v.Verify(context.Background(), root)
+	if err != nil {
+		t.Fatalf("Unexpected verify: %v", err)
+	}
+	if res.Gateway != srv.URL || res.Attempts != 4 || atomic.LoadInt32(requests) != 2 {
+		t.Errorf("Unexpected result %+v after %d requests", res, atomic.LoadInt32(requests))
+	}
+}
+
+func TestVerifyUnretrievable(t *testing.T) {
+	archive, root, block := content(t)
+
+	// A block is altered, or missing: the first block written is a leaf.
+	altered := append([]byte(nil), archive...)
+	altered[len(altered)-1] ^= 0xff
+	section := func(b []byte) int {
+		n, m := binary.Uvarint(b)
+		return int(n) + m
+	}
+	header := section(archive)
+	missing := append(append([]byte(nil), archive[:header]...), archive[header+section(archive[header:]):]...)
+	tests := []struct {
+		name    string
+		archive []byte
+		block   []byte
+		format  string
+	}{
+		{"altered block", altered, block, FormatCAR},
+		{"missing block", missing, block, FormatCAR},
+		{"altered raw block", archive, append([]byte{0}, block...), FormatRaw},
+		{"truncated car", archive[:len(archive)/2], block, FormatCAR},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv, _ := gateway(t, test.archive, root, test.block, 0)
+			v := &Verifier{Gateways: []string{srv.URL}, Format: test.format, Timeout: 50 * time.Millisecond, Backoff: 10 * time.Millisecond}
+			res, err := v.Verify(context.Background(), root)
+			if !errors.Is(err, ErrUnretrievable) {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if res.Attempts < 2 {
+				t.Errorf("Unexpected %d attempts", res.Attempts)
+			}
+		})
+	}
+}
+
+func TestFetchCAR(t *testing.T) {
+	archive, root, block := content(t)
+	srv, _ := gateway(t, archive, root, block, 1)
+
+	v := &Verifier{Gateways: []string{srv.URL}, Format: FormatRaw, Backoff: time.Millisecond}
+	rc, res, err := v.FetchCAR(context.Background(), root)
+	if err != nil {
+		t.Fatalf("Unexpected fetch: %v", err)
+	}
+	got, err := io.ReadAll(rc)
+	if err != nil || !bytes.Equal(got, archive) {
+		t.Errorf("Unexpected archive of %d bytes: %v", len(got), err)
+	}
+	if res.Attempts != 2 || res.Blocks < 2 {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	name := rc.(*tempFile).Name()
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Unexpected archive left after close: %v", err)
+	}
+
+	rc, _, err = v.Fetch(context.Background(), root)
+	if err != nil {
+		t.Fatalf("Unexpected fetch: %v", err)
+	}
+	got, err = io.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(got, bytes.Repeat([]byte("ipfs-pinner"), unixfs.DefaultChunkSize/4)) {
+		t.Errorf("Unexpected content of %d bytes: %v", len(got), err)
+	}
+
+	v.Timeout = 10 * time.Millisecond
+	if _, _, err := v.FetchCAR(context.Background(), cid.NewCidV1(cid.Raw, root.Hash())); !errors.Is(err, ErrUnretrievable) {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/wabarc/ipfs-pinner/unixfs"
+
+	httpretry "github.com/wabarc/ipfs-pinner/http"
+)
+
+// Source fetches the verified CAR archive of the DAG of a CID. Verifier
+// and Kubo are sources.
+type Source interface {
+	FetchCAR(ctx context.Context, c cid.Cid) (io.ReadCloser, Result, error)
+}
+
+// Kubo fetches content from the RPC API of a Kubo node, which is not
+// trusted more than a gateway: the DAG it exports is verified the same way.
+type Kubo struct {
+	// Client sends the requests, http.DefaultClient if nil.
+	Client *http.Client
+	// Endpoint is the base URL of the RPC API, such as
+	// http://127.0.0.1:5001.
+	Endpoint string
+}
+
+// FetchCAR exports the DAG of c as a CAR archive and returns it once
+// verified. The archive is kept in a temporary file, removed on Close.
+func (k *Kubo) FetchCAR(ctx context.Context, c cid.Cid) (io.ReadCloser, Result, error) {
+	res := Result{Gateway: k.Endpoint, Attempts: 1}
+	u, err := url.Parse(strings.TrimRight(k.Endpoint, "/") + "/api/v0/dag/export")
+	if err != nil {
+		return nil, res, err
+	}
+	u.RawQuery = url.Values{"arg": {c.String()}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), nil)
+	if err != nil {
+		return nil, res, err
+	}
+
+	client := k.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, res, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, res, httpretry.NewStatusError(resp)
+	}
+
+	f, err := os.CreateTemp("", "ipfs-pinner-*.car")
+	if err != nil {
+		return nil, res, err
+	}
+	tmp := &tempFile{f}
+	res.Blocks, res.Size, err = verifyCAR(io.TeeReader(resp.Body, f), c)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmp.Close()
+		return nil, res, fmt.Errorf("%s: %w", k.Endpoint, err)
+	}
+	return tmp, res, nil
+}
+
+// Blocks fetches the DAG of c from src, and returns a DAG service of its
+// verified blocks, valid until the closer is called.
+func Blocks(ctx context.Context, src Source, c cid.Cid) (ipld.DAGService, io.Closer, Result, error) {
+	rc, res, err := src.FetchCAR(ctx, c)
+	if err != nil {
+		return nil, nil, res, err
+	}
+	// Archives of other sources are copied to a file to be indexed.
+	tmp, ok := rc.(*tempFile)
+	if !ok {
+		defer rc.Close()
+		f, err := os.CreateTemp("", "ipfs-pinner-*.car")
+		if err != nil {
+			return nil, nil, res, err
+		}
+		tmp = &tempFile{f}
+		if _, err := io.Copy(f, rc); err != nil {
+			tmp.Close()
+			return nil, nil, res, err
+		}
+	}
+
+	fi, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return nil, nil, res, err
+	}
+	_, dag, err := unixfs.IndexCAR(tmp, fi.Size())
+	if err != nil {
+		tmp.Close()
+		return nil, nil, res, err
+	}
+	return dag, tmp, res, nil
+}
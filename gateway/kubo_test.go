@@ -0,0 +1,49 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wabarc/ipfs-pinner/unixfs"
+)
+
+func TestKubo(t *testing.T) {
+	archive, root, _ := content(t)
+	served := archive
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v0/dag/export" || r.URL.Query().Get("arg") != root.String() {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write(served)
+	}))
+	defer srv.Close()
+
+	k := &Kubo{Endpoint: srv.URL + "/"}
+	dag, closer, res, err := Blocks(context.Background(), k, root)
+	if err != nil {
+		t.Fatalf("Unexpected fetch: %v", err)
+	}
+	defer closer.Close()
+	if res.Gateway != k.Endpoint || res.Blocks < 2 {
+		t.Errorf("Unexpected result %+v", res)
+	}
+	r, err := unixfs.NewFileReader(root, dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, bytes.Repeat([]byte("ipfs-pinner"), unixfs.DefaultChunkSize/4)) {
+		t.Errorf("Unexpected content of %d bytes: %v", len(got), err)
+	}
+
+	// A node is not trusted more than a gateway.
+	served = archive[:len(archive)-1]
+	if _, _, err := k.FetchCAR(context.Background(), root); err == nil {
+		t.Error("Unexpected fetch of a truncated archive")
+	}
+}
@@ -0,0 +1,72 @@
+package pinner
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/wabarc/ipfs-pinner/gateway"
+	"github.com/wabarc/ipfs-pinner/unixfs"
+)
+
+// Content is the DAG of a CID retrieved by Get, every block verified
+// against its CID. It is kept in a temporary CAR archive until Close.
+type Content struct {
+	// Cid is the root of the content.
+	Cid cid.Cid
+	// Result tells the gateway or Kubo node the content was fetched from.
+	Result gateway.Result
+
+	dag    ipld.DAGService
+	closer io.Closer
+}
+
+// Get retrieves the DAG of c from the Kubo RPC API of Kubo if set, else
+// from the gateways of Verifier, and verifies every block against its CID.
+func (cfg *Config) Get(ctx context.Context, c string) (*Content, error) {
+	id, err := cid.Parse(c)
+	if err != nil {
+		return nil, err
+	}
+
+	var src gateway.Source
+	switch {
+	case cfg.Kubo != nil:
+		src = cfg.Kubo
+	case cfg.Verifier != nil:
+		src = cfg.Verifier
+	default:
+		return nil, errors.New("no verifier or kubo")
+	}
+	dag, closer, res, err := gateway.Blocks(ctx, src, id)
+	if err != nil {
+		return nil, err
+	}
+	return &Content{Cid: id, Result: res, dag: dag, closer: closer}, nil
+}
+
+// Reader returns a reader of the content of a UnixFS file. It returns
+// unixfs.ErrNotFile, wrapped, for a directory.
+func (ct *Content) Reader() (io.Reader, error) {
+	return unixfs.NewFileReader(ct.Cid, ct.dag)
+}
+
+// FS returns the content as a read-only file system, the entries of a
+// directory, or a file opened as ".".
+func (ct *Content) FS() fs.FS {
+	return unixfs.NewFS(ct.Cid, ct.dag)
+}
+
+// Extract writes the content to path, a directory with its entries or a
+// file.
+func (ct *Content) Extract(path string) error {
+	return unixfs.Extract(ct.Cid, ct.dag, path)
+}
+
+// Close removes the archive of the content.
+func (ct *Content) Close() error {
+	return ct.closer.Close()
+}
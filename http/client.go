@@ -11,14 +11,28 @@ import (
 	"github.com/ybbus/httpretry"
 )
 
+// DefaultRetries is the number of times NewClient retries a failed
+// request, unless set by WithRetries.
+const DefaultRetries = 5
+
 func NewClient(client *http.Client) *http.Client {
 	if client == nil {
 		client = http.DefaultClient
 	}
+	// httpretry wraps the transport of the client it is given, which is
+	// copied so that the client of the caller is left untouched.
+	c := *client
+	max := DefaultRetries
+	if r, ok := c.Transport.(*retries); ok {
+		max = r.max
+	}
+	if max == 0 {
+		return &c
+	}
 	return httpretry.NewCustomClient(
-		client,
-		// retry 5 times
-		httpretry.WithMaxRetryCount(5),
+		&c,
+		// retry 5 times by default
+		httpretry.WithMaxRetryCount(max),
 		// retry on status == 429, if status >= 500, if err != nil, or if response was nil (status == 0)
 		httpretry.WithRetryPolicy(func(statusCode int, err error) bool {
 			return err != nil || statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError || statusCode == 0
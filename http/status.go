@@ -0,0 +1,24 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package http // import "github.com/wabarc/ipfs-pinner/http"
+
+import (
+	"net/http"
+)
+
+// StatusError is returned for a response with an unexpected status code.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+// NewStatusError returns a StatusError for the response.
+func NewStatusError(resp *http.Response) *StatusError {
+	return &StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+}
+
+func (e *StatusError) Error() string {
+	return e.Status
+}
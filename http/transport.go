@@ -0,0 +1,142 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+package http // import "github.com/wabarc/ipfs-pinner/http"
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transport returns the transport of client, or the default one.
+func transport(client *http.Client) (*http.Client, http.RoundTripper) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := *client
+	if c.Transport == nil {
+		return &c, http.DefaultTransport
+	}
+	return &c, c.Transport
+}
+
+// retries records the number of retries of a client, for NewClient.
+type retries struct {
+	max int
+	http.RoundTripper
+}
+
+// WithRetries returns a copy of client that the pinners retry max times
+// on failure instead of DefaultRetries, zero disables retries.
+func WithRetries(client *http.Client, max int) *http.Client {
+	c, rt := transport(client)
+	if r, ok := rt.(*retries); ok {
+		rt = r.RoundTripper
+	}
+	c.Transport = &retries{max: max, RoundTripper: rt}
+	return c
+}
+
+// limiter spaces the requests sent through it.
+type limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+
+	http.RoundTripper
+}
+
+func (l *limiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	l.mu.Lock()
+	now := time.Now()
+	at := l.next
+	if at.Before(now) {
+		at = now
+	}
+	l.next = at.Add(l.interval)
+	l.mu.Unlock()
+
+	if wait := time.Until(at); wait > 0 {
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-req.Context().Done():
+			t.Stop()
+			return nil, req.Context().Err()
+		}
+	}
+	return l.RoundTripper.RoundTrip(req)
+}
+
+// WithRateLimit returns a copy of client sending at most rps requests per
+// second, retries included, shared by all the copies of the client and
+// the goroutines using it. A rate of zero or less leaves it unlimited.
+func WithRateLimit(client *http.Client, rps float64) *http.Client {
+	c, rt := transport(client)
+	if rps <= 0 {
+		return c
+	}
+	interval := time.Duration(float64(time.Second) / rps)
+	l := &limiter{interval: interval}
+	// The limiter stays under the retries marker, which NewClient looks
+	// for at the top of the transport.
+	if r, ok := rt.(*retries); ok {
+		l.RoundTripper = r.RoundTripper
+		c.Transport = &retries{max: r.max, RoundTripper: l}
+		return c
+	}
+	l.RoundTripper = rt
+	c.Transport = l
+	return c
+}
+
+// rewrite sends requests to another base URL.
+type rewrite struct {
+	base *url.URL
+
+	http.RoundTripper
+}
+
+func (rw *rewrite) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = rw.base.Scheme
+	r.URL.Host = rw.base.Host
+	r.URL.User = rw.base.User
+	if rw.base.Path != "" && rw.base.Path != "/" {
+		r.URL.Path = path.Join(rw.base.Path, req.URL.Path)
+		if strings.HasSuffix(req.URL.Path, "/") && !strings.HasSuffix(r.URL.Path, "/") {
+			r.URL.Path += "/"
+		}
+		r.URL.RawPath = ""
+	}
+	r.Host = ""
+	return rw.RoundTripper.RoundTrip(r)
+}
+
+// WithEndpoint returns a copy of client sending the requests to endpoint
+// instead of the API of the pinner, the path of a request is appended to
+// the path of endpoint. It allows using a self-hosted service speaking
+// the same protocol, such as a Kubo RPC API in place of Infura.
+func WithEndpoint(client *http.Client, endpoint string) (*http.Client, error) {
+	base, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %s", endpoint)
+	}
+
+	c, rt := transport(client)
+	if r, ok := rt.(*retries); ok {
+		c.Transport = &retries{max: r.max, RoundTripper: &rewrite{base: base, RoundTripper: r.RoundTripper}}
+		return c, nil
+	}
+	c.Transport = &rewrite{base: base, RoundTripper: rt}
+	return c, nil
+}
@@ -0,0 +1,83 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := NewClient(WithRetries(server.Client(), 0))
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Unexpected request: %v", err)
+	}
+	resp.Body.Close()
+	if calls != 1 {
+		t.Errorf("Unexpected %d requests without retries", calls)
+	}
+}
+
+func TestWithRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := WithRateLimit(server.Client(), 50)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := NewClient(client).Get(server.URL)
+			if err != nil {
+				t.Errorf("Unexpected request: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	// The first request is sent at once, the next ones every 20ms.
+	if d := time.Since(start); d < 80*time.Millisecond {
+		t.Errorf("Unexpected 5 requests in %s at 50 requests per second", d)
+	}
+}
+
+func TestWithEndpoint(t *testing.T) {
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.RequestURI()
+	}))
+	defer server.Close()
+
+	client, err := WithEndpoint(WithRetries(server.Client(), 1), server.URL+"/kubo")
+	if err != nil {
+		t.Fatalf("Unexpected endpoint: %v", err)
+	}
+	if _, ok := client.Transport.(*retries); !ok {
+		t.Errorf("Unexpected transport %T, the retries are lost", client.Transport)
+	}
+	resp, err := NewClient(client).Post("https://ipfs.infura.io:5001/api/v0/add?pin=true", "text/plain", nil)
+	if err != nil {
+		t.Fatalf("Unexpected request: %v", err)
+	}
+	resp.Body.Close()
+	if path != "/kubo/api/v0/add?pin=true" {
+		t.Errorf("Unexpected request to %s", path)
+	}
+
+	if _, err := WithEndpoint(nil, "127.0.0.1:5001"); err == nil {
+		t.Error("Unexpected endpoint without scheme")
+	}
+}
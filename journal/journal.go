@@ -0,0 +1,272 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package journal records successful pins in a local file, so that content
+already pinned to a pinning service is not uploaded again.
+
+The journal is an append-only file of JSON lines, loaded in memory when
+opened. A later line replaces an earlier one with the same key, and the
+file is compacted when opened if it holds many replaced lines.
+*/
+package journal // import "github.com/wabarc/ipfs-pinner/journal"
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+)
+
+// Entry is a successful pin.
+type Entry struct {
+	// Digest identifies the content, see pinner.Config.
+	Digest string `json:"digest"`
+	// Cid is the CID returned by the pinner.
+	Cid string `json:"cid"`
+	// Pinner is the identifier of the pinning service.
+	Pinner string `json:"pinner"`
+	// Account identifies the account of the pinning service, so that
+	// accounts sharing a journal do not share entries, see
+	// pinner.Config.Account.
+	Account string `json:"account,omitempty"`
+	// Time is when the pin was recorded or last verified.
+	Time time.Time `json:"time"`
+
+	// Deleted marks a removed entry in the file.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+type key struct {
+	pinner  string
+	account string
+	digest  string
+}
+
+// Journal is a journal of pins, safe for concurrent use.
+type Journal struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	entries map[key]Entry
+	// lines is the number of lines of the file.
+	lines int
+}
+
+// Open opens the journal at path, creating it if it does not exist.
+func Open(path string) (*Journal, error) {
+	j := &Journal{path: path, entries: make(map[key]Entry)}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	// Rewrite the file once it holds more replaced lines than entries.
+	if j.lines > 2*len(j.entries)+64 {
+		if err := j.compact(); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open journal failed: %w", err)
+	}
+	j.file = f
+
+	return j, nil
+}
+
+func (j *Journal) load() error {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open journal failed: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 4096), 1<<20)
+	for sc.Scan() {
+		j.lines++
+		var e Entry
+		// A line left incomplete by an interrupted write is skipped.
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			continue
+		}
+		k := key{e.Pinner, e.Account, e.Digest}
+		if e.Deleted {
+			delete(j.entries, k)
+			continue
+		}
+		j.entries[k] = e
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read journal failed: %w", err)
+	}
+
+	return nil
+}
+
+// compact rewrites the file with the current entries only.
+func (j *Journal) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(j.path), filepath.Base(j.path)+".*")
+	if err != nil {
+		return fmt.Errorf("compact journal failed: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, e := range j.entries {
+		if err := enc.Encode(e); err != nil {
+			tmp.Close()
+			return fmt.Errorf("compact journal failed: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("compact journal failed: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("compact journal failed: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), j.path); err != nil {
+		return fmt.Errorf("compact journal failed: %w", err)
+	}
+	j.lines = len(j.entries)
+
+	return nil
+}
+
+// Get returns the entry of the content digest pinned to the account of
+// pinner.
+func (j *Journal) Get(pinner, account, digest string) (Entry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	e, ok := j.entries[key{pinner, account, digest}]
+	return e, ok
+}
+
+// Put records e, replacing the entry with the same pinner, account and
+// digest. A zero Time is set to the current time.
+func (j *Journal) Put(e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	e.Deleted = false
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.append(e); err != nil {
+		return err
+	}
+	j.entries[key{e.Pinner, e.Account, e.Digest}] = e
+
+	return nil
+}
+
+// Delete removes the entry of the content digest pinned to the account of
+// pinner.
+func (j *Journal) Delete(pinner, account, digest string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	k := key{pinner, account, digest}
+	if _, ok := j.entries[k]; !ok {
+		return nil
+	}
+	if err := j.append(Entry{Digest: digest, Pinner: pinner, Account: account, Time: time.Now().UTC(), Deleted: true}); err != nil {
+		return err
+	}
+	delete(j.entries, k)
+
+	return nil
+}
+
+// DeleteCid removes the entries of the account of pinner whose CID is c,
+// of any CID version, such as the entries of content unpinned from the
+// account.
+func (j *Journal) DeleteCid(pinner, account, c string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for k, e := range j.entries {
+		if k.pinner != pinner || k.account != account || !sameCid(e.Cid, c) {
+			continue
+		}
+		if err := j.append(Entry{Digest: k.digest, Pinner: pinner, Account: account, Time: time.Now().UTC(), Deleted: true}); err != nil {
+			return err
+		}
+		delete(j.entries, k)
+	}
+
+	return nil
+}
+
+// sameCid reports whether a and b are CIDs of the same multihash, or the
+// same string if either is not a CID.
+func sameCid(a, b string) bool {
+	if a == b {
+		return true
+	}
+	ca, err := cid.Decode(a)
+	if err != nil {
+		return false
+	}
+	cb, err := cid.Decode(b)
+	if err != nil {
+		return false
+	}
+	return string(ca.Hash()) == string(cb.Hash())
+}
+
+// Entries returns the entries of the journal, in no particular order.
+func (j *Journal) Entries() []Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := make([]Entry, 0, len(j.entries))
+	for _, e := range j.entries {
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func (j *Journal) append(e Entry) error {
+	if j.file == nil {
+		return fmt.Errorf("journal is closed")
+	}
+	buf, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	// A single write of a whole line keeps lines from interleaving.
+	if _, err := j.file.Write(append(buf, '\n')); err != nil {
+		return fmt.Errorf("write journal failed: %w", err)
+	}
+	j.lines++
+
+	return nil
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
@@ -0,0 +1,141 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected open journal: %v", err)
+	}
+
+	if _, ok := j.Get("infura", "", "digest"); ok {
+		t.Error("Unexpected entry in an empty journal")
+	}
+	if err := j.Put(Entry{Digest: "digest", Cid: "cid-1", Pinner: "infura"}); err != nil {
+		t.Fatalf("Unexpected put: %v", err)
+	}
+	if err := j.Put(Entry{Digest: "digest", Cid: "cid-2", Pinner: "infura"}); err != nil {
+		t.Fatalf("Unexpected put: %v", err)
+	}
+	if err := j.Put(Entry{Digest: "other", Cid: "cid-3", Pinner: "pinata"}); err != nil {
+		t.Fatalf("Unexpected put: %v", err)
+	}
+	if err := j.Delete("pinata", "", "other"); err != nil {
+		t.Fatalf("Unexpected delete: %v", err)
+	}
+	e, ok := j.Get("infura", "", "digest")
+	if !ok || e.Cid != "cid-2" || e.Time.IsZero() {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+	if _, ok := j.Get("pinata", "", "digest"); ok {
+		t.Error("Unexpected entry of another pinner")
+	}
+	if _, ok := j.Get("infura", "other", "digest"); ok {
+		t.Error("Unexpected entry of another account")
+	}
+	if err := j.Close(); err != nil {
+		t.Fatalf("Unexpected close: %v", err)
+	}
+
+	// A line left incomplete by an interrupted write is skipped.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"digest":"torn","ci`)
+	f.Close()
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected open journal: %v", err)
+	}
+	defer j.Close()
+	if e, ok := j.Get("infura", "", "digest"); !ok || e.Cid != "cid-2" {
+		t.Errorf("Unexpected entry after reopening %+v", e)
+	}
+	if _, ok := j.Get("pinata", "", "other"); ok {
+		t.Error("Unexpected deleted entry after reopening")
+	}
+	if n := len(j.Entries()); n != 1 {
+		t.Errorf("Unexpected %d entries", n)
+	}
+}
+
+func TestJournalCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected open journal: %v", err)
+	}
+	mtime := time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 200; i++ {
+		if err := j.Put(Entry{Digest: "digest", Cid: "cid", Pinner: "infura", Time: mtime}); err != nil {
+			t.Fatalf("Unexpected put: %v", err)
+		}
+	}
+	j.Close()
+	before, _ := os.Stat(path)
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected open journal: %v", err)
+	}
+	defer j.Close()
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Errorf("Unexpected journal of %d bytes not compacted from %d bytes", after.Size(), before.Size())
+	}
+	if e, ok := j.Get("infura", "", "digest"); !ok || !e.Time.Equal(mtime) {
+		t.Errorf("Unexpected entry after compaction %+v", e)
+	}
+	if err := j.Put(Entry{Digest: "new", Cid: "cid", Pinner: "infura"}); err != nil {
+		t.Fatalf("Unexpected put after compaction: %v", err)
+	}
+}
+
+func TestJournalDeleteCid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+	j, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected open journal: %v", err)
+	}
+	v0 := "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"
+	v1 := "bafybeicg2rebjoofv4kbyovkw7af3rpiitvnl6i7ckcywaq6xjcxnc2mby"
+	_ = j.Put(Entry{Digest: "a", Cid: v1, Pinner: "infura"})
+	_ = j.Put(Entry{Digest: "b", Cid: v0, Pinner: "infura"})
+	_ = j.Put(Entry{Digest: "a", Cid: v1, Pinner: "pinata"})
+	_ = j.Put(Entry{Digest: "c", Cid: "other", Pinner: "infura"})
+	_ = j.Put(Entry{Digest: "a", Cid: v1, Pinner: "infura", Account: "other"})
+
+	// Entries of any version of the CID are removed, on the account only.
+	if err := j.DeleteCid("infura", "", v0); err != nil {
+		t.Fatalf("Unexpected delete: %v", err)
+	}
+	j.Close()
+
+	j, err = Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected open journal: %v", err)
+	}
+	defer j.Close()
+	for _, digest := range []string{"a", "b"} {
+		if _, ok := j.Get("infura", "", digest); ok {
+			t.Errorf("Unexpected entry %s after deleting its cid", digest)
+		}
+	}
+	if _, ok := j.Get("pinata", "", "a"); !ok {
+		t.Error("Unexpected deleted entry of another pinner")
+	}
+	if _, ok := j.Get("infura", "", "c"); !ok {
+		t.Error("Unexpected deleted entry of another cid")
+	}
+	if _, ok := j.Get("infura", "other", "a"); !ok {
+		t.Error("Unexpected deleted entry of another account")
+	}
+}
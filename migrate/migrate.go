@@ -0,0 +1,156 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package migrate moves pins from a pinning service to another one, such as
+from a hosted service to a self-hosted IPFS Cluster.
+
+The pins of the source are enumerated through its list API, and pinned on
+the destination by CID if it supports it, carrying their name and metadata
+over if it supports names. Otherwise, the DAG is fetched as a CAR archive
+through trustless gateways, verified, and uploaded to the destination. The
+source pin is only removed on request, once the destination holds the
+content and it is retrievable through the gateways.
+*/
+package migrate // import "github.com/wabarc/ipfs-pinner/migrate"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/wabarc/ipfs-pinner/capability"
+	"github.com/wabarc/ipfs-pinner/gateway"
+	"github.com/wabarc/ipfs-pinner/pinning"
+
+	pinner "github.com/wabarc/ipfs-pinner"
+)
+
+// ErrNotVerified is returned, wrapped, when the source pin is kept since
+// the destination is not known to hold the content.
+var ErrNotVerified = errors.New("not verified on the destination")
+
+// Migrator moves pins from the pinner of From to the pinner of To.
+type Migrator struct {
+	From *pinner.Config
+	To   *pinner.Config
+	// Gateway fetches the content the destination cannot pin by CID, and
+	// verifies the content is retrievable before the source is unpinned.
+	Gateway *gateway.Verifier
+	// UnpinSource removes the pin from the source once verified on the
+	// destination. It requires Gateway.
+	UnpinSource bool
+}
+
+// Pins returns the pins of the source to migrate, the ones it holds. Pins
+// queued, in progress or failed on the source are left out.
+func (m *Migrator) Pins() ([]pinning.Pin, error) {
+	pins, err := m.From.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []pinning.Pin
+	for _, p := range pins {
+		if p.Status == pinning.Pinned {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+// Migrate pins p on the destination, and unpins it from the source if
+// UnpinSource is set, returning the CID pinned on the destination.
+// Migrating a pin again is harmless, pinning being idempotent.
+func (m *Migrator) Migrate(ctx context.Context, p pinning.Pin) (string, error) {
+	if m.UnpinSource && m.Gateway == nil {
+		return "", fmt.Errorf("unpin source: %w: no gateway", ErrNotVerified)
+	}
+	id, err := cid.Decode(p.Cid)
+	if err != nil {
+		return "", fmt.Errorf("invalid cid %s: %w", p.Cid, err)
+	}
+	caps, err := m.To.Capabilities()
+	if err != nil {
+		return "", err
+	}
+
+	var c string
+	switch {
+	case caps.PinHash:
+		c, err = m.To.PinHashNamed(p.Cid, p.Name, p.Meta)
+	case caps.CAR && m.Gateway != nil:
+		c, err = m.pinCAR(ctx, id)
+	case caps.CAR:
+		err = fmt.Errorf("%s: pin %s: no gateway to fetch it from", m.To.Pinner, p.Cid)
+	default:
+		err = fmt.Errorf("%s: pin hash: %w", m.To.Pinner, capability.ErrUnsupported)
+	}
+	if err != nil {
+		return c, err
+	}
+
+	if m.UnpinSource {
+		if err := m.verify(ctx, c); err != nil {
+			return c, err
+		}
+		if err := m.From.Unpin(p.Cid); err != nil {
+			return c, err
+		}
+	}
+	return c, nil
+}
+
+// pinCAR fetches the DAG of id through the gateways and uploads it to the
+// destination.
+func (m *Migrator) pinCAR(ctx context.Context, id cid.Cid) (string, error) {
+	rc, _, err := m.Gateway.FetchCAR(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	c, err := m.To.PinCAR(rc)
+	if err != nil {
+		return c, err
+	}
+	// The destination may answer another version of the CID.
+	got, err := cid.Decode(c)
+	if err != nil || string(got.Hash()) != string(id.Hash()) {
+		return c, fmt.Errorf("%s: pinned %s instead of %s", m.To.Pinner, c, id)
+	}
+	return c, nil
+}
+
+// verify checks that the destination holds c, if it tells, and that c is
+// retrievable through the gateways. A pin still queued or in progress on
+// the destination is not verified.
+func (m *Migrator) verify(ctx context.Context, c string) error {
+	caps, err := m.To.Capabilities()
+	if err != nil {
+		return err
+	}
+	if caps.Status {
+		status, err := m.To.PinStatus(ctx, c)
+		if err != nil {
+			return err
+		}
+		if status != pinning.Pinned {
+			if status == "" {
+				status = "not pinned"
+			}
+			return fmt.Errorf("%s %w: %s on %s", c, ErrNotVerified, status, m.To.Pinner)
+		}
+	}
+
+	id, err := cid.Decode(c)
+	if err != nil {
+		return err
+	}
+	if _, err := m.Gateway.Verify(ctx, id); err != nil {
+		return fmt.Errorf("%s %w: %v", c, ErrNotVerified, err)
+	}
+	return nil
+}
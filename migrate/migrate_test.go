@@ -0,0 +1,158 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/wabarc/helper"
+	"github.com/wabarc/ipfs-pinner/gateway"
+	"github.com/wabarc/ipfs-pinner/pinning"
+	"github.com/wabarc/ipfs-pinner/unixfs"
+
+	pinner "github.com/wabarc/ipfs-pinner"
+)
+
+// source mocks a Pinata account holding the content of archive, named,
+// an IPFS Cluster and Web3.Storage, and records the requests changing pins.
+type source struct {
+	mu      sync.Mutex
+	archive []byte
+	root    string
+	// status is the status of the pin of root on the Cluster peer.
+	status string
+	calls  []string
+}
+
+func (s *source) record(call string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = append(s.calls, call)
+}
+
+func (s *source) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/data/pinList":
+		if r.URL.Query().Get("pageOffset") != "0" {
+			_, _ = w.Write([]byte(`{"count":1,"rows":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"count":1,"rows":[{"ipfs_pin_hash":"` + s.root + `","metadata":{"name":"site","keyvalues":{"env":"prod"}}}]}`))
+	case r.URL.Path == "/pinning/unpin/"+s.root:
+		s.record("unpin " + s.root)
+		_, _ = w.Write([]byte(`OK`))
+	case r.URL.Path == "/pins/"+s.root && r.Method == http.MethodPost:
+		q := r.URL.Query()
+		s.record("pin " + s.root + " " + q.Get("name") + " " + q.Get("meta-env"))
+		_, _ = w.Write([]byte(`{"cid":"` + s.root + `"}`))
+	case r.URL.Path == "/pins/"+s.root:
+		_, _ = w.Write([]byte(`{"cid":"` + s.root + `","peer_map":{"a":{"status":"` + s.status + `"}}}`))
+	case r.URL.Path == "/car":
+		body, _ := io.ReadAll(r.Body)
+		if !bytes.Equal(body, s.archive) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.record("car " + s.root)
+		_, _ = w.Write([]byte(`{"cid":"` + s.root + `"}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func setup(t *testing.T) (*source, *http.Client, *gateway.Verifier) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	root, err := unixfs.WriteCAR(&buf, files.NewBytesFile(bytes.Repeat([]byte("ipfs-pinner"), 1<<16)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := &source{archive: buf.Bytes(), root: root.String(), status: "pinned"}
+	httpClient, mux, server := helper.MockServer()
+	mux.Handle("/", src)
+	t.Cleanup(server.Close)
+
+	gw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ipfs/"+src.root {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(src.archive)
+	}))
+	t.Cleanup(gw.Close)
+
+	return src, httpClient, &gateway.Verifier{Gateways: []string{gw.URL}, Timeout: 50 * time.Millisecond, Backoff: time.Millisecond}
+}
+
+func TestMigrate(t *testing.T) {
+	src, httpClient, v := setup(t)
+	from := (&pinner.Config{Pinner: pinner.Pinata}).WithClient(httpClient)
+	to := (&pinner.Config{Pinner: pinner.Cluster}).WithClient(httpClient)
+
+	m := &Migrator{From: from, To: to, Gateway: v, UnpinSource: true}
+	pins, err := m.Pins()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 1 || pins[0].Cid != src.root {
+		t.Fatalf("Unexpected pins to migrate %+v", pins)
+	}
+	c, err := m.Migrate(context.Background(), pins[0])
+	if err != nil {
+		t.Fatalf("Unexpected migrate: %v", err)
+	}
+	expected := []string{"pin " + src.root + " site prod", "unpin " + src.root}
+	if c != src.root || len(src.calls) != 2 || src.calls[0] != expected[0] || src.calls[1] != expected[1] {
+		t.Errorf("Unexpected migrate to %s with %q", c, src.calls)
+	}
+
+	// The source is kept if the destination does not hold the content yet.
+	for _, status := range []string{"unpinned", "pin_queued", "pinning"} {
+		src.calls, src.status = nil, status
+		if _, err := m.Migrate(context.Background(), pins[0]); !errors.Is(err, ErrNotVerified) {
+			t.Errorf("Unexpected error of a %s pin: %v", status, err)
+		}
+		if len(src.calls) != 1 {
+			t.Errorf("Unexpected calls of a %s pin %q", status, src.calls)
+		}
+	}
+
+	m.Gateway = nil
+	if _, err := m.Migrate(context.Background(), pins[0]); !errors.Is(err, ErrNotVerified) {
+		t.Errorf("Unexpected unpin without gateway: %v", err)
+	}
+}
+
+func TestMigrateCAR(t *testing.T) {
+	src, httpClient, v := setup(t)
+	from := (&pinner.Config{Pinner: pinner.Pinata}).WithClient(httpClient)
+	to := (&pinner.Config{Pinner: pinner.Web3Storage, Apikey: "fake"}).WithClient(httpClient)
+
+	m := &Migrator{From: from, To: to}
+	p := pinning.Pin{Cid: src.root, Name: "site"}
+	if _, err := m.Migrate(context.Background(), p); err == nil {
+		t.Error("Unexpected migrate without gateway")
+	}
+
+	m.Gateway = v
+	c, err := m.Migrate(context.Background(), p)
+	if err != nil {
+		t.Fatalf("Unexpected migrate: %v", err)
+	}
+	if c != src.root || len(src.calls) != 1 || src.calls[0] != "car "+src.root {
+		t.Errorf("Unexpected migrate to %s with %q", c, src.calls)
+	}
+
+	m.Gateway.Gateways = []string{"http://127.0.0.1:1"}
+	if _, err := m.Migrate(context.Background(), p); !errors.Is(err, gateway.ErrUnretrievable) {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
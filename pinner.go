@@ -1,34 +1,98 @@
 package pinner // import "github.com/wabarc/ipfs-pinner"
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/go-cid"
+	"github.com/wabarc/ipfs-pinner/capability"
+	"github.com/wabarc/ipfs-pinner/crypt"
+	"github.com/wabarc/ipfs-pinner/file"
+	"github.com/wabarc/ipfs-pinner/gateway"
+	"github.com/wabarc/ipfs-pinner/journal"
+	"github.com/wabarc/ipfs-pinner/pinning"
 	"github.com/wabarc/ipfs-pinner/pkg/infura"
+	"github.com/wabarc/ipfs-pinner/pkg/ipfs-cluster"
 	"github.com/wabarc/ipfs-pinner/pkg/nftstorage"
 	"github.com/wabarc/ipfs-pinner/pkg/pinata"
 	"github.com/wabarc/ipfs-pinner/pkg/web3storage"
+	"github.com/wabarc/ipfs-pinner/unixfs"
 )
 
 var ErrPinner = fmt.Errorf("unsupported pinner")
 
+// ErrPinFailed is returned, wrapped, by WaitPinned when the pinner reports
+// the pin failed.
+var ErrPinFailed = errors.New("pin failed")
+
 const (
 	Infura      = "infura"
 	Pinata      = "pinata"
 	NFTStorage  = "nftstorage"
 	Web3Storage = "web3storage"
+	Cluster     = "cluster"
 )
 
 // Config represents pinner's configuration. Pinner is the identifier of
-// the target IPFS service.
+// the target IPFS service. FileOptions select the entries taken when
+// pinning a directory. Endpoint is the base URL of the REST API of the
+// peer of the Cluster pinner, http://127.0.0.1:9094 if empty.
+//
+// If Journal is set, Pin records every successful pin in it, and returns
+// the recorded CID of content already pinned to the same account of the
+// same pinner instead of uploading it again, see Account. Content is identified by its CIDv1 built locally
+// with the default options of the unixfs package. Readers are only
+// journaled if they implement io.Seeker, since they are read twice. An
+// entry older than JournalTTL is only trusted once the pinner reports it
+// still holds the pin, a zero JournalTTL trusts entries forever. Unpin
+// removes the entries of the unpinned CID.
+//
+// If Verifier is set, Pin and PinHash check that the content of the CID
+// they return, journaled or not, is retrievable through its gateways.
+// Content the verifier fails to fetch before its deadline is reported by
+// the CID along with an error wrapping gateway.ErrUnretrievable, the pin
+// itself is kept. Get retrieves content through Kubo if set, else through
+// the gateways of Verifier.
+//
+// If PinWait is positive, PinHash, PinHashNamed and PinHashStatus wait up
+// to PinWait for the pinner to report the pin done, as WaitPinned does,
+// since pinning a CID may only queue a search for the content on the
+// network.
+//
+// If Recipients is set, Pin encrypts the content to them as it uploads it,
+// and returns the CID of the ciphertext, KeyRef telling the keys able to
+// decrypt it. A directory is encrypted as a single tar archive. Encrypted
+// content is journaled by its digest and KeyRef, except when encrypted
+// with a passphrase. Fetch decrypts content with Identities.
 type Config struct {
 	*http.Client
 
 	Pinner string
 	Apikey string
 	Secret string
+
+	Endpoint string
+
+	FileOptions []file.Option
+
+	Journal    *journal.Journal
+	JournalTTL time.Duration
+
+	Verifier *gateway.Verifier
+	Kubo     *gateway.Kubo
+
+	PinWait time.Duration
+
+	Recipients []crypt.Recipient
+	Identities []crypt.Identity
 }
 
 // Pin pins a file to a network and returns a content id and an error. The file
@@ -36,29 +100,81 @@ type Config struct {
 // memory or on disk. If stored on disk, it's underlying concrete type should
 // be a file path. If it is in memory, it should be an *io.Reader or byte slice.
 //
-//nolint:gocyclo
+// A file path is walked once with FileOptions, and the walk is shared by the
+// checks, the journal and the upload. A *file.Node already walked by
+// file.NewSerialFile is pinned as is, with the options it was walked with,
+// so that the caller can reuse it, such as for its Usage.
 func (cfg *Config) Pin(path interface{}) (cid string, err error) {
+	if p, ok := path.(string); ok {
+		if path, err = file.NewSerialFile(p, cfg.FileOptions...); err != nil {
+			return "", err
+		}
+	}
+	if err = cfg.Check(path); err != nil {
+		return
+	}
+
+	var digest string
+	if cfg.Journal != nil {
+		if digest, err = cfg.digest(path); err != nil {
+			return "", fmt.Errorf("%s: %w", cfg.Pinner, err)
+		}
+		if cid, ok := cfg.journaled(digest); ok {
+			return cid, cfg.verify(cid)
+		}
+	}
+
+	if len(cfg.Recipients) > 0 {
+		cid, err = cfg.pinEncrypted(path)
+	} else {
+		cid, err = cfg.pin(path)
+	}
+	if err != nil {
+		return cid, err
+	}
+	if digest != "" {
+		err = cfg.Journal.Put(journal.Entry{Digest: digest, Cid: cid, Pinner: cfg.Pinner, Account: cfg.Account()})
+		if err != nil {
+			return cid, fmt.Errorf("%s: %w", cfg.Pinner, err)
+		}
+	}
+
+	return cid, cfg.verify(cid)
+}
+
+// pinEncrypted pins the content given to Pin encrypted to Recipients.
+func (cfg *Config) pinEncrypted(path interface{}) (string, error) {
+	r, err := cfg.encrypted(path)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", cfg.Pinner, err)
+	}
+	defer r.Close()
+
+	return cfg.pin(&r.NamedReader)
+}
+
+//nolint:gocyclo
+func (cfg *Config) pin(path interface{}) (cid string, err error) {
 	// TODO using generics
 	err = ErrPinner
 	switch v := path.(type) {
-	case string:
-		_, err = os.Lstat(v)
-		if err != nil {
-			return
-		}
+	case *file.Node:
 		switch cfg.Pinner {
 		case Infura:
 			inf := &infura.Infura{Apikey: cfg.Apikey, Secret: cfg.Secret, Client: cfg.Client}
-			cid, err = inf.PinFile(v)
+			cid, err = inf.PinNode(v)
 		case Pinata:
 			pnt := &pinata.Pinata{Apikey: cfg.Apikey, Secret: cfg.Secret, Client: cfg.Client}
-			cid, err = pnt.PinFile(v)
+			cid, err = pnt.PinNode(v)
 		case NFTStorage:
 			nft := &nftstorage.NFTStorage{Apikey: cfg.Apikey, Client: cfg.Client}
-			cid, err = nft.PinFile(v)
+			cid, err = nft.PinNode(v)
 		case Web3Storage:
 			web3 := &web3storage.Web3Storage{Apikey: cfg.Apikey, Client: cfg.Client}
-			cid, err = web3.PinFile(v)
+			cid, err = web3.PinNode(v)
+		case Cluster:
+			cls := &ipfsCluster.Cluster{Apikey: cfg.Apikey, Secret: cfg.Secret, Endpoint: cfg.Endpoint, Client: cfg.Client}
+			cid, err = cls.PinNode(v)
 		}
 	case io.Reader:
 		switch cfg.Pinner {
@@ -74,6 +190,9 @@ func (cfg *Config) Pin(path interface{}) (cid string, err error) {
 		case Web3Storage:
 			web3 := &web3storage.Web3Storage{Apikey: cfg.Apikey, Client: cfg.Client}
 			cid, err = web3.PinWithReader(v)
+		case Cluster:
+			cls := &ipfsCluster.Cluster{Apikey: cfg.Apikey, Secret: cfg.Secret, Endpoint: cfg.Endpoint, Client: cfg.Client}
+			cid, err = cls.PinWithReader(v)
 		}
 	case []byte:
 		switch cfg.Pinner {
@@ -89,6 +208,9 @@ func (cfg *Config) Pin(path interface{}) (cid string, err error) {
 		case Web3Storage:
 			web3 := &web3storage.Web3Storage{Apikey: cfg.Apikey, Client: cfg.Client}
 			cid, err = web3.PinWithBytes(v)
+		case Cluster:
+			cls := &ipfsCluster.Cluster{Apikey: cfg.Apikey, Secret: cfg.Secret, Endpoint: cfg.Endpoint, Client: cfg.Client}
+			cid, err = cls.PinWithBytes(v)
 		}
 	}
 	if err != nil {
@@ -100,21 +222,461 @@ func (cfg *Config) Pin(path interface{}) (cid string, err error) {
 
 // PinHash pins from any IPFS node, returns the original cid and an error.
 func (cfg *Config) PinHash(cid string) (string, error) {
+	return cfg.PinHashNamed(cid, "", nil)
+}
+
+// PinHashNamed pins from any IPFS node like PinHash, naming the pin and
+// attaching the key-value metadata if the pinner supports names. They are
+// dropped otherwise.
+func (cfg *Config) PinHashNamed(cid, name string, meta map[string]string) (string, error) {
+	cid, _, err := cfg.PinHashStatus(cid, name, meta)
+	return cid, err
+}
+
+// PinHashStatus pins from any IPFS node like PinHashNamed, and returns the
+// status of the pin as well: pinning.Queued or pinning.Pinning while the
+// pinner searches for the content, unless it pins synchronously or
+// PinWait is positive and the wait succeeds.
+func (cfg *Config) PinHashStatus(cid, name string, meta map[string]string) (string, pinning.Status, error) {
+	caps, err := cfg.Capabilities()
+	if err != nil {
+		return "", "", err
+	}
+	if !caps.PinHash {
+		return "", "", fmt.Errorf("%s: pin hash: %w", cfg.Pinner, capability.ErrUnsupported)
+	}
+
 	ok := false
-	err := ErrPinner
+	status := pinning.Queued
 	switch cfg.Pinner {
 	case Infura:
 		inf := &infura.Infura{Apikey: cfg.Apikey, Secret: cfg.Secret, Client: cfg.Client}
 		ok, err = inf.PinHash(cid)
+		status = pinning.Pinned
+	case Pinata:
+		pnt := &pinata.Pinata{Apikey: cfg.Apikey, Secret: cfg.Secret, Client: cfg.Client}
+		var job pinata.PinJob
+		if job, err = pnt.PinHashJob(cid, name, meta); err == nil {
+			ok, status = job.Cid == cid, job.PinStatus()
+		}
+	case Cluster:
+		cls := &ipfsCluster.Cluster{Apikey: cfg.Apikey, Secret: cfg.Secret, Endpoint: cfg.Endpoint, Client: cfg.Client}
+		ok, err = cls.PinHashNamed(cid, name, meta)
+	}
+	if !ok {
+		return "", "", err
+	}
+	if cfg.PinWait > 0 && status != pinning.Pinned {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.PinWait)
+		defer cancel()
+		if err := cfg.WaitPinned(ctx, cid); err != nil {
+			return cid, status, err
+		}
+		status = pinning.Pinned
+	}
+
+	return cid, status, cfg.verify(cid)
+}
+
+// WaitPinned waits until the pinner reports the pin of cid done, or ctx is
+// done. Pinata is asked about its pin jobs, and reports a failed job by an
+// error wrapping pinata.ErrPinJobFailed. Other pinners are asked for the
+// status of the pin, as PinStatus does, a queued or pinning one is waited
+// for and a failed one is reported by an error wrapping ErrPinFailed. The
+// end of ctx is reported by an error wrapping its error.
+func (cfg *Config) WaitPinned(ctx context.Context, cid string) error {
+	caps, err := cfg.Capabilities()
+	if err != nil {
+		return err
+	}
+	if !caps.Status {
+		return fmt.Errorf("%s: pin status: %w", cfg.Pinner, capability.ErrUnsupported)
+	}
+
+	if cfg.Pinner == Pinata {
+		pnt := &pinata.Pinata{Apikey: cfg.Apikey, Secret: cfg.Secret, Client: cfg.Client}
+		if err := pnt.WaitPinned(ctx, cid); err != nil {
+			return fmt.Errorf("%s: %w", cfg.Pinner, err)
+		}
+		return nil
+	}
+	var status pinning.Status = "not pinned"
+	for {
+		s, err := cfg.PinStatus(ctx, cid)
+		switch {
+		case ctx.Err() != nil:
+			// The end of ctx is reported in place of the error of a
+			// request it interrupted.
+			return fmt.Errorf("%s: %s %s: %w", cfg.Pinner, cid, status, ctx.Err())
+		case err != nil:
+			return err
+		case s == pinning.Pinned:
+			return nil
+		case s == pinning.Failed:
+			return fmt.Errorf("%s: %s: %w", cfg.Pinner, cid, ErrPinFailed)
+		case s != "":
+			status = s
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(pinning.PollInterval):
+		}
+	}
+}
+
+// PinCAR pins the DAG of the CAR file read from r, returns the CID of its
+// root and an error. It is only supported by the pinners uploading CAR
+// files.
+func (cfg *Config) PinCAR(r io.Reader) (string, error) {
+	caps, err := cfg.Capabilities()
+	if err != nil {
+		return "", err
+	}
+	if !caps.CAR {
+		return "", fmt.Errorf("%s: pin car: %w", cfg.Pinner, capability.ErrUnsupported)
+	}
+
+	var cid string
+	switch cfg.Pinner {
+	case NFTStorage:
+		nft := &nftstorage.NFTStorage{Apikey: cfg.Apikey, Client: cfg.Client}
+		cid, err = nft.PinCAR(r)
+	case Web3Storage:
+		web3 := &web3storage.Web3Storage{Apikey: cfg.Apikey, Client: cfg.Client}
+		cid, err = web3.PinCAR(r)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", cfg.Pinner, err)
+	}
+
+	return cid, cfg.verify(cid)
+}
+
+// Verify checks that c is retrievable through the gateways of Verifier.
+func (cfg *Config) Verify(ctx context.Context, c string) (gateway.Result, error) {
+	if cfg.Verifier == nil {
+		return gateway.Result{}, errors.New("no verifier")
+	}
+	id, err := cid.Parse(c)
+	if err != nil {
+		return gateway.Result{}, err
+	}
+	return cfg.Verifier.Verify(ctx, id)
+}
+
+// verify checks that c is retrievable if Verifier is set.
+func (cfg *Config) verify(c string) error {
+	if cfg.Verifier == nil {
+		return nil
+	}
+	if _, err := cfg.Verify(context.Background(), c); err != nil {
+		return fmt.Errorf("%s: %w", cfg.Pinner, err)
+	}
+	return nil
+}
+
+// Pinned reports whether the pinner holds a pin of cid.
+func (cfg *Config) Pinned(cid string) (bool, error) {
+	caps, err := cfg.Capabilities()
+	if err != nil {
+		return false, err
+	}
+	if !caps.Status {
+		return false, fmt.Errorf("%s: pin status: %w", cfg.Pinner, capability.ErrUnsupported)
+	}
+
+	var ok bool
+	switch cfg.Pinner {
+	case Infura:
+		inf := &infura.Infura{Apikey: cfg.Apikey, Secret: cfg.Secret, Client: cfg.Client}
+		ok, err = inf.Pinned(cid)
+	case Pinata:
+		pnt := &pinata.Pinata{Apikey: cfg.Apikey, Secret: cfg.Secret, Client: cfg.Client}
+		ok, err = pnt.Pinned(cid)
+	case NFTStorage:
+		nft := &nftstorage.NFTStorage{Apikey: cfg.Apikey, Client: cfg.Client}
+		ok, err = nft.Pinned(cid)
+	case Web3Storage:
+		web3 := &web3storage.Web3Storage{Apikey: cfg.Apikey, Client: cfg.Client}
+		ok, err = web3.Pinned(cid)
+	case Cluster:
+		cls := &ipfsCluster.Cluster{Apikey: cfg.Apikey, Secret: cfg.Secret, Endpoint: cfg.Endpoint, Client: cfg.Client}
+		ok, err = cls.Pinned(cid)
+	}
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", cfg.Pinner, err)
+	}
+
+	return ok, nil
+}
+
+// PinStatus returns the status of the pin of cid on the pinner, empty if
+// it holds none. Unlike Pinned, only pinning.Pinned tells that the pinner
+// holds the content, a queued or pinning one may still fail.
+func (cfg *Config) PinStatus(ctx context.Context, cid string) (pinning.Status, error) {
+	caps, err := cfg.Capabilities()
+	if err != nil {
+		return "", err
+	}
+	if !caps.Status {
+		return "", fmt.Errorf("%s: pin status: %w", cfg.Pinner, capability.ErrUnsupported)
+	}
+
+	var status pinning.Status
+	switch cfg.Pinner {
+	case Infura:
+		inf := &infura.Infura{Apikey: cfg.Apikey, Secret: cfg.Secret, Client: cfg.Client}
+		status, err = inf.Status(ctx, cid)
 	case Pinata:
 		pnt := &pinata.Pinata{Apikey: cfg.Apikey, Secret: cfg.Secret, Client: cfg.Client}
-		ok, err = pnt.PinHash(cid)
+		status, err = pnt.Status(ctx, cid)
+	case NFTStorage:
+		nft := &nftstorage.NFTStorage{Apikey: cfg.Apikey, Client: cfg.Client}
+		status, err = nft.Status(ctx, cid)
+	case Web3Storage:
+		web3 := &web3storage.Web3Storage{Apikey: cfg.Apikey, Client: cfg.Client}
+		status, err = web3.Status(ctx, cid)
+	case Cluster:
+		cls := &ipfsCluster.Cluster{Apikey: cfg.Apikey, Secret: cfg.Secret, Endpoint: cfg.Endpoint, Client: cfg.Client}
+		status, err = cls.Status(ctx, cid)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", cfg.Pinner, err)
+	}
+
+	return status, nil
+}
+
+// Unpin removes the pin of cid from the pinner.
+func (cfg *Config) Unpin(cid string) error {
+	caps, err := cfg.Capabilities()
+	if err != nil {
+		return err
+	}
+	if !caps.Unpin {
+		return fmt.Errorf("%s: unpin: %w", cfg.Pinner, capability.ErrUnsupported)
+	}
+
+	switch cfg.Pinner {
+	case Infura:
+		inf := &infura.Infura{Apikey: cfg.Apikey, Secret: cfg.Secret, Client: cfg.Client}
+		err = inf.Unpin(cid)
+	case Pinata:
+		pnt := &pinata.Pinata{Apikey: cfg.Apikey, Secret: cfg.Secret, Client: cfg.Client}
+		err = pnt.Unpin(cid)
+	case NFTStorage:
+		nft := &nftstorage.NFTStorage{Apikey: cfg.Apikey, Client: cfg.Client}
+		err = nft.Unpin(cid)
+	case Web3Storage:
+		web3 := &web3storage.Web3Storage{Apikey: cfg.Apikey, Client: cfg.Client}
+		err = web3.Unpin(cid)
+	case Cluster:
+		cls := &ipfsCluster.Cluster{Apikey: cfg.Apikey, Secret: cfg.Secret, Endpoint: cfg.Endpoint, Client: cfg.Client}
+		err = cls.Unpin(cid)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", cfg.Pinner, err)
+	}
+	if cfg.Journal != nil {
+		if err := cfg.Journal.DeleteCid(cfg.Pinner, cfg.Account(), cid); err != nil {
+			return fmt.Errorf("%s: %w", cfg.Pinner, err)
+		}
+	}
+
+	return nil
+}
+
+// List returns the pins held by the pinner for the account.
+func (cfg *Config) List() ([]pinning.Pin, error) {
+	caps, err := cfg.Capabilities()
+	if err != nil {
+		return nil, err
+	}
+	if !caps.List {
+		return nil, fmt.Errorf("%s: list pins: %w", cfg.Pinner, capability.ErrUnsupported)
+	}
+
+	var pins []pinning.Pin
+	switch cfg.Pinner {
+	case Infura:
+		inf := &infura.Infura{Apikey: cfg.Apikey, Secret: cfg.Secret, Client: cfg.Client}
+		pins, err = inf.List()
+	case Pinata:
+		pnt := &pinata.Pinata{Apikey: cfg.Apikey, Secret: cfg.Secret, Client: cfg.Client}
+		pins, err = pnt.List()
+	case NFTStorage:
+		nft := &nftstorage.NFTStorage{Apikey: cfg.Apikey, Client: cfg.Client}
+		pins, err = nft.List()
+	case Web3Storage:
+		web3 := &web3storage.Web3Storage{Apikey: cfg.Apikey, Client: cfg.Client}
+		pins, err = web3.List()
+	case Cluster:
+		cls := &ipfsCluster.Cluster{Apikey: cfg.Apikey, Secret: cfg.Secret, Endpoint: cfg.Endpoint, Client: cfg.Client}
+		pins, err = cls.List()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", cfg.Pinner, err)
+	}
+
+	return pins, nil
+}
+
+// digest returns the CIDv1 of the content given to Pin, built locally, or
+// an empty string if the content cannot be read twice. The digest of
+// encrypted content is followed by KeyRef, it is empty for a passphrase.
+func (cfg *Config) digest(path interface{}) (string, error) {
+	if len(cfg.Recipients) > 0 {
+		for _, r := range cfg.Recipients {
+			if _, ok := r.(*crypt.Passphrase); ok {
+				return "", nil
+			}
+		}
+		d, err := cfg.plainDigest(path)
+		if d == "" || err != nil {
+			return "", err
+		}
+		return d + " " + cfg.KeyRef(), nil
 	}
-	if ok {
-		return cid, nil
+	return cfg.plainDigest(path)
+}
+
+func (cfg *Config) plainDigest(path interface{}) (string, error) {
+	var nd files.Node
+	switch v := path.(type) {
+	case *file.Node:
+		var err error
+		if nd, err = v.Files(); err != nil {
+			return "", err
+		}
+	case []byte:
+		nd = files.NewBytesFile(v)
+	case io.ReadSeeker:
+		offset, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return "", nil
+		}
+		// The reader is hidden behind a struct, so that closing the file
+		// node does not close it.
+		c, err := unixfs.Sum(files.NewReaderFile(struct{ io.Reader }{v}))
+		if err != nil {
+			return "", err
+		}
+		if _, err := v.Seek(offset, io.SeekStart); err != nil {
+			return "", err
+		}
+		return c.String(), nil
+	default:
+		return "", nil
+	}
+
+	c, err := unixfs.Sum(nd)
+	if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
+
+// Account identifies the account of the pinner in the journal, a short
+// hash of Endpoint and Apikey that does not reveal the credentials. It is
+// empty when neither is set, such as for a local Cluster peer.
+func (cfg *Config) Account() string {
+	if cfg.Apikey == "" && cfg.Endpoint == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(cfg.Endpoint + "\n" + cfg.Apikey))
+	return hex.EncodeToString(sum[:8])
+}
+
+// journaled returns the CID recorded in the journal for the content
+// digest, if it can be trusted. A stale entry is verified with the pinner,
+// and dropped if the pinner no longer holds the pin or cannot tell.
+func (cfg *Config) journaled(digest string) (string, bool) {
+	e, ok := cfg.Journal.Get(cfg.Pinner, cfg.Account(), digest)
+	if !ok {
+		return "", false
+	}
+	if cfg.JournalTTL <= 0 || time.Since(e.Time) < cfg.JournalTTL {
+		return e.Cid, true
 	}
 
-	return "", err
+	pinned, err := cfg.Pinned(e.Cid)
+	switch {
+	case err == nil && pinned:
+		// A failure to refresh the entry only means it is verified again.
+		_ = cfg.Journal.Put(journal.Entry{Digest: digest, Cid: e.Cid, Pinner: cfg.Pinner, Account: cfg.Account()})
+		return e.Cid, true
+	case err == nil, errors.Is(err, capability.ErrUnsupported):
+		_ = cfg.Journal.Delete(cfg.Pinner, cfg.Account(), digest)
+	}
+
+	// The content is uploaded again, pinning is idempotent.
+	return "", false
+}
+
+// Capabilities returns the capabilities of the pinner.
+func (cfg *Config) Capabilities() (capability.Capabilities, error) {
+	switch cfg.Pinner {
+	case Infura:
+		return (&infura.Infura{}).Capabilities(), nil
+	case Pinata:
+		return (&pinata.Pinata{}).Capabilities(), nil
+	case NFTStorage:
+		return (&nftstorage.NFTStorage{}).Capabilities(), nil
+	case Web3Storage:
+		return (&web3storage.Web3Storage{}).Capabilities(), nil
+	case Cluster:
+		return (&ipfsCluster.Cluster{}).Capabilities(), nil
+	}
+	return capability.Capabilities{}, ErrPinner
+}
+
+// Check checks the content given to Pin against the capabilities of the
+// pinner, without sending anything. The size of a path is the size of the
+// entries selected by FileOptions, counted by walking it, the size of a
+// *file.Node is its Usage. The size of a reader is only known for
+// regular files and readers having a Len method, such as *bytes.Reader.
+// Encrypted content is checked as a single file of about the same size.
+func (cfg *Config) Check(path interface{}) error {
+	caps, err := cfg.Capabilities()
+	if err != nil {
+		return err
+	}
+
+	req := capability.Request{Size: -1}
+	switch v := path.(type) {
+	case string:
+		fi, err := os.Stat(v)
+		if err != nil {
+			return err
+		}
+		u, err := file.DiskUsage(v, cfg.FileOptions...)
+		if err != nil {
+			return err
+		}
+		req.Directory = fi.IsDir()
+		req.Metadata = file.PreservesMetadata(cfg.FileOptions...)
+		req.Size = u.Bytes
+	case *file.Node:
+		req.Directory = v.Mode().IsDir()
+		req.Metadata = v.PreserveMetadata()
+		req.Size = v.Usage().Bytes
+	case []byte:
+		req.Size = int64(len(v))
+	case *os.File:
+		if fi, err := v.Stat(); err == nil && fi.Mode().IsRegular() {
+			req.Size = fi.Size()
+		}
+	case interface{ Len() int }:
+		req.Size = int64(v.Len())
+	}
+	if len(cfg.Recipients) > 0 {
+		req.Directory, req.Metadata = false, false
+	}
+
+	if err := caps.Check(req); err != nil {
+		return fmt.Errorf("%s: %w", cfg.Pinner, err)
+	}
+	return nil
 }
 
 // WithClient attach http.Client
@@ -1,18 +1,35 @@
 package pinner // import "github.com/wabarc/ipfs-pinner"
 
 import (
+	"archive/tar"
 	"bytes"
+	"context"
 	"encoding/base64"
+	"errors"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/ipfs/boxo/files"
 	"github.com/wabarc/helper"
+	"github.com/wabarc/ipfs-pinner/capability"
+	"github.com/wabarc/ipfs-pinner/crypt"
+	"github.com/wabarc/ipfs-pinner/file"
+	"github.com/wabarc/ipfs-pinner/gateway"
+	"github.com/wabarc/ipfs-pinner/journal"
+	"github.com/wabarc/ipfs-pinner/pinning"
+	"github.com/wabarc/ipfs-pinner/pkg/pinata"
+	"github.com/wabarc/ipfs-pinner/unixfs"
 )
 
 var (
@@ -209,3 +226,484 @@ func TestPinFileWithBytes(t *testing.T) {
 		})
 	}
 }
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errFailingReader
+}
+
+var errFailingReader = errors.New("failing reader")
+
+func TestPinWithFailingReader(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", handleResponse)
+	defer server.Close()
+
+	for _, p := range []string{Infura, Pinata, NFTStorage, Web3Storage, Cluster} {
+		t.Run(p, func(t *testing.T) {
+			pinner := Config{Pinner: p, Apikey: apikey, Secret: secret}
+			rd := io.MultiReader(strings.NewReader(helper.RandString(6, "lower")), failingReader{})
+			o, err := pinner.WithClient(httpClient).Pin(rd)
+			if !errors.Is(err, errFailingReader) {
+				t.Fatalf("Unexpected error, got %v instead of %v", err, errFailingReader)
+			}
+			if o != "" {
+				t.Fatalf("Unexpected cid from a truncated upload: %s", o)
+			}
+		})
+	}
+}
+
+// sizedReader reports a size without holding any content.
+type sizedReader int
+
+func (r sizedReader) Len() int { return int(r) }
+
+func (sizedReader) Read([]byte) (int, error) {
+	return 0, errors.New("unexpected read")
+}
+
+func TestPreflightCheck(t *testing.T) {
+	var requests int32
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	})
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "ipfs-pinner-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	t.Run("pin hash", func(t *testing.T) {
+		for _, p := range []string{NFTStorage, Web3Storage} {
+			cfg := Config{Pinner: p, Apikey: apikey}
+			_, err := cfg.WithClient(httpClient).PinHash("Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a")
+			if !errors.Is(err, capability.ErrUnsupported) {
+				t.Errorf("Unexpected error of %s, got %v", p, err)
+			}
+		}
+	})
+	t.Run("too large", func(t *testing.T) {
+		cfg := Config{Pinner: NFTStorage, Apikey: apikey}
+		_, err := cfg.WithClient(httpClient).Pin(sizedReader(101 << 20))
+		if !errors.Is(err, capability.ErrTooLarge) {
+			t.Errorf("Unexpected error, got %v", err)
+		}
+	})
+	t.Run("metadata", func(t *testing.T) {
+		cfg := Config{Pinner: Pinata, Apikey: apikey, Secret: secret, FileOptions: []file.Option{file.PreserveMtime()}}
+		_, err := cfg.WithClient(httpClient).Pin(dir)
+		if !errors.Is(err, capability.ErrUnsupported) {
+			t.Errorf("Unexpected error, got %v", err)
+		}
+	})
+	t.Run("unknown pinner", func(t *testing.T) {
+		cfg := Config{Pinner: "unknown"}
+		if err := cfg.Check(dir); !errors.Is(err, ErrPinner) {
+			t.Errorf("Unexpected error, got %v", err)
+		}
+	})
+
+	if n := atomic.LoadInt32(&requests); n > 0 {
+		t.Errorf("Unexpected %d requests sent", n)
+	}
+}
+
+func TestPinJournal(t *testing.T) {
+	var uploads, checks int32
+	pinned := true
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v0/add":
+			atomic.AddInt32(&uploads, 1)
+			_, _ = ioutil.ReadAll(r.Body)
+			_, _ = w.Write([]byte(addJSON))
+		case "/api/v0/pin/ls":
+			atomic.AddInt32(&checks, 1)
+			if !pinned {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(`{"Message":"path is not pinned","Code":0,"Type":"error"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"Keys":{"Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a":{"Type":"recursive"}}}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	defer server.Close()
+
+	j, err := journal.Open(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	cfg := &Config{Pinner: Infura, Apikey: apikey, Secret: secret, Journal: j}
+	cfg.WithClient(httpClient)
+	content := []byte(helper.RandString(16, "lower"))
+	expect := func(name string, wantUploads, wantChecks int32) {
+		t.Helper()
+		cid, err := cfg.Pin(content)
+		if err != nil {
+			t.Fatalf("%s: unexpected pin: %v", name, err)
+		}
+		if cid != "Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a" {
+			t.Errorf("%s: unexpected cid %s", name, cid)
+		}
+		if n := atomic.LoadInt32(&uploads); n != wantUploads {
+			t.Errorf("%s: unexpected %d uploads instead of %d", name, n, wantUploads)
+		}
+		if n := atomic.LoadInt32(&checks); n != wantChecks {
+			t.Errorf("%s: unexpected %d status checks instead of %d", name, n, wantChecks)
+		}
+	}
+
+	expect("first pin", 1, 0)
+	expect("journaled pin", 1, 0)
+	if _, err := cfg.Pin(bytes.NewReader(content)); err != nil || atomic.LoadInt32(&uploads) != 1 {
+		t.Errorf("Unexpected upload of a journaled reader: %v", err)
+	}
+
+	// Stale entries are verified with the pinner first.
+	cfg.JournalTTL = time.Nanosecond
+	expect("stale pin still pinned", 1, 1)
+	pinned = false
+	expect("stale pin unpinned", 2, 2)
+
+	// Other pinners and accounts do not share the entries.
+	if _, ok := j.Get(Pinata, cfg.Account(), j.Entries()[0].Digest); ok {
+		t.Error("Unexpected entry for another pinner")
+	}
+	other := &Config{Pinner: Infura, Apikey: "other", Secret: secret, Journal: j}
+	other.WithClient(httpClient)
+	if _, err := other.Pin(content); err != nil {
+		t.Fatalf("Unexpected pin of another account: %v", err)
+	}
+	if n := atomic.LoadInt32(&uploads); n != 3 {
+		t.Errorf("Unexpected %d uploads instead of 3 for another account", n)
+	}
+}
+
+func TestPinNode(t *testing.T) {
+	var uploads int32
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&uploads, 1)
+		_, _ = ioutil.ReadAll(r.Body)
+		_, _ = w.Write([]byte(addJSON))
+	})
+	defer server.Close()
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{"index.html": "<html></html>", "sub/page.warc": "WARC/1.1"} {
+		fp := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fp), 0o700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(fp, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j, err := journal.Open(filepath.Join(t.TempDir(), "journal"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+
+	cfg := &Config{Pinner: Infura, Apikey: apikey, Secret: secret, Journal: j}
+	cfg.WithClient(httpClient)
+	if _, err := cfg.Pin(dir); err != nil {
+		t.Fatalf("Unexpected pin: %v", err)
+	}
+
+	// A walked Node is the same content as its path.
+	node, err := file.NewSerialFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Check(node); err != nil {
+		t.Fatalf("Unexpected check: %v", err)
+	}
+	if _, err := cfg.Pin(node); err != nil {
+		t.Fatalf("Unexpected pin: %v", err)
+	}
+	if n := atomic.LoadInt32(&uploads); n != 1 {
+		t.Errorf("Unexpected %d uploads of a journaled node", n)
+	}
+	if node.Usage().Bytes != int64(len("<html></html>")+len("WARC/1.1")) {
+		t.Errorf("Unexpected usage: %+v", node.Usage())
+	}
+}
+
+func TestPinVerify(t *testing.T) {
+	content := []byte(helper.RandString(16, "lower"))
+	var archive bytes.Buffer
+	root, err := unixfs.WriteCAR(&archive, files.NewBytesFile(content), unixfs.CidV0())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = ioutil.ReadAll(r.Body)
+		_, _ = w.Write([]byte(`{"Hash": "` + root.String() + `"}`))
+	})
+	defer server.Close()
+	available := true
+	gw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available || r.URL.Path != "/ipfs/"+root.String() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(archive.Bytes())
+	}))
+	defer gw.Close()
+
+	verifier := &gateway.Verifier{Gateways: []string{gw.URL}, Timeout: 50 * time.Millisecond, Backoff: 10 * time.Millisecond}
+	cfg := &Config{Pinner: Infura, Apikey: apikey, Secret: secret, Verifier: verifier}
+	cfg.WithClient(httpClient)
+	cid, err := cfg.Pin(content)
+	if err != nil || cid != root.String() {
+		t.Fatalf("Unexpected pin of retrievable content %s: %v", cid, err)
+	}
+	res, err := cfg.Verify(context.Background(), cid)
+	if err != nil || res.Gateway != gw.URL || res.Blocks != 1 {
+		t.Errorf("Unexpected verify %+v: %v", res, err)
+	}
+
+	// Content not retrievable is still reported by its CID.
+	available = false
+	cid, err = cfg.Pin(content)
+	if !errors.Is(err, gateway.ErrUnretrievable) || cid != root.String() {
+		t.Errorf("Unexpected pin of unretrievable content %s: %v", cid, err)
+	}
+}
+
+func TestPinEncrypted(t *testing.T) {
+	id, err := crypt.GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	archives := make(map[string][]byte)
+	var filename string
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		f, fh, err := r.FormFile("file")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		ciphertext, _ := ioutil.ReadAll(f)
+		var archive bytes.Buffer
+		root, _ := unixfs.WriteCAR(&archive, files.NewBytesFile(ciphertext))
+		archives[root.String()] = archive.Bytes()
+		filename = fh.Filename
+		_, _ = w.Write([]byte(`{"Hash": "` + root.String() + `"}`))
+	})
+	defer server.Close()
+	gw := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		archive, ok := archives[strings.TrimPrefix(r.URL.Path, "/ipfs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(archive)
+	}))
+	defer gw.Close()
+
+	verifier := &gateway.Verifier{Gateways: []string{gw.URL}, Timeout: time.Second}
+	cfg := &Config{Pinner: Infura, Apikey: apikey, Secret: secret, Verifier: verifier, Recipients: []crypt.Recipient{id.Recipient()}}
+	cfg.WithClient(httpClient)
+	if cfg.KeyRef() != id.Recipient().String() {
+		t.Errorf("Unexpected key reference %s", cfg.KeyRef())
+	}
+
+	content := []byte(helper.RandString(16, "lower"))
+	cid, err := cfg.Pin(content)
+	if err != nil {
+		t.Fatalf("Unexpected pin: %v", err)
+	}
+	if !strings.HasSuffix(filename, ".age") {
+		t.Errorf("Unexpected uploaded name %s", filename)
+	}
+	// Without identities, the ciphertext is returned as is.
+	if got, err := io.ReadAll(mustFetch(t, cfg, cid)); err != nil || !bytes.HasPrefix(got, []byte("age-encryption.org/v1\n")) || bytes.Contains(got, content) {
+		t.Errorf("Unexpected ciphertext %q: %v", got, err)
+	}
+	cfg.Identities = []crypt.Identity{id}
+	if got, err := io.ReadAll(mustFetch(t, cfg, cid)); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("Unexpected decrypted content %q: %v", got, err)
+	}
+
+	// A directory is encrypted as a tar archive.
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "index.html"), content, 0o600)
+	cid, err = cfg.Pin(dir)
+	if err != nil {
+		t.Fatalf("Unexpected pin of a directory: %v", err)
+	}
+	if filename != filepath.Base(dir)+".tar.age" {
+		t.Errorf("Unexpected uploaded name %s", filename)
+	}
+	tr := tar.NewReader(mustFetch(t, cfg, cid))
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected tar: %v", err)
+		}
+		names = append(names, hdr.Name)
+	}
+	if strings.Join(names, ",") != filepath.Base(dir)+","+filepath.Base(dir)+"/index.html" {
+		t.Errorf("Unexpected entries %v", names)
+	}
+
+	other, _ := crypt.GenerateIdentity()
+	cfg.Identities = []crypt.Identity{other}
+	if _, err := cfg.Fetch(context.Background(), cid); !errors.Is(err, crypt.ErrNoIdentity) {
+		t.Errorf("Unexpected fetch with another identity: %v", err)
+	}
+}
+
+func mustFetch(t *testing.T, cfg *Config, cid string) io.Reader {
+	t.Helper()
+
+	rc, err := cfg.Fetch(context.Background(), cid)
+	if err != nil {
+		t.Fatalf("Unexpected fetch: %v", err)
+	}
+	t.Cleanup(func() { rc.Close() })
+	return rc
+}
+
+func TestGet(t *testing.T) {
+	nd := files.NewMapDirectory(map[string]files.Node{
+		"index.html": files.NewBytesFile([]byte("<html></html>")),
+		"sub":        files.NewMapDirectory(map[string]files.Node{"a.txt": files.NewBytesFile([]byte("a"))}),
+	})
+	var archive bytes.Buffer
+	root, err := unixfs.WriteCAR(&archive, nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kubo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v0/dag/export" || r.URL.Query().Get("arg") != root.String() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(archive.Bytes())
+	}))
+	defer kubo.Close()
+
+	cfg := &Config{Kubo: &gateway.Kubo{Endpoint: kubo.URL}}
+	ct, err := cfg.Get(context.Background(), root.String())
+	if err != nil {
+		t.Fatalf("Unexpected get: %v", err)
+	}
+	defer ct.Close()
+	if b, err := fs.ReadFile(ct.FS(), "sub/a.txt"); err != nil || string(b) != "a" {
+		t.Errorf("Unexpected content %q: %v", b, err)
+	}
+	if _, err := ct.Reader(); !errors.Is(err, unixfs.ErrNotFile) {
+		t.Errorf("Unexpected reader of a directory: %v", err)
+	}
+	dir := filepath.Join(t.TempDir(), "out")
+	if err := ct.Extract(dir); err != nil {
+		t.Fatalf("Unexpected extract: %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "index.html")); err != nil || string(b) != "<html></html>" {
+		t.Errorf("Unexpected extracted content %q: %v", b, err)
+	}
+
+	if _, err := (&Config{}).Get(context.Background(), root.String()); err == nil {
+		t.Error("Unexpected get without source")
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	const hash = "Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/pins/"+hash {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte(`{"cid":"` + hash + `"}`))
+	}))
+	defer server.Close()
+
+	cfg := &Config{Pinner: Cluster, Endpoint: server.URL}
+	if cid, err := cfg.PinHash(hash); err != nil || cid != hash {
+		t.Errorf("Unexpected pin hash through the endpoint %s: %v", cid, err)
+	}
+}
+
+func TestPinHashWait(t *testing.T) {
+	const hash = "Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a"
+	status := "expired"
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/pinning/pinByHash", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"8c2bd5b6","ipfsHash":"` + hash + `","status":"prechecking"}`))
+	})
+	mux.HandleFunc("/data/pinList", func(w http.ResponseWriter, r *http.Request) {
+		if status != "pinned" {
+			_, _ = w.Write([]byte(`{"count":0,"rows":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"count":1,"rows":[{"ipfs_pin_hash":"` + hash + `"}]}`))
+	})
+	mux.HandleFunc("/pinning/pinJobs", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"count":1,"rows":[{"id":"8c2bd5b6","ipfs_pin_hash":"` + hash + `","status":"` + status + `"}]}`))
+	})
+	defer server.Close()
+
+	cfg := &Config{Pinner: Pinata, Apikey: apikey, Secret: secret}
+	cfg.WithClient(httpClient)
+	if cid, s, err := cfg.PinHashStatus(hash, "", nil); err != nil || cid != hash || s != pinning.Queued {
+		t.Errorf("Unexpected pin hash without wait %s %q: %v", cid, s, err)
+	}
+	cfg.PinWait = time.Second
+	if cid, err := cfg.PinHash(hash); !errors.Is(err, pinata.ErrPinJobFailed) || cid != hash {
+		t.Errorf("Unexpected pin hash of a failed job %s: %v", cid, err)
+	}
+	status = "pinned"
+	if cid, s, err := cfg.PinHashStatus(hash, "", nil); err != nil || cid != hash || s != pinning.Pinned {
+		t.Errorf("Unexpected pin hash %s %q: %v", cid, s, err)
+	}
+
+	// Other pinners are polled for the status of the pin, a queued or
+	// pinning one is not done.
+	defer func(d time.Duration) { pinning.PollInterval = d }(pinning.PollInterval)
+	pinning.PollInterval = time.Millisecond
+	var peer atomic.Value
+	mux.HandleFunc("/pins/"+hash, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"cid":"` + hash + `","peer_map":{"a":{"status":"` + peer.Load().(string) + `"}}}`))
+	})
+	cluster := &Config{Pinner: Cluster}
+	cluster.WithClient(httpClient)
+	for _, s := range []string{"unpinned", "pin_queued", "pinning"} {
+		peer.Store(s)
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		if err := cluster.WaitPinned(ctx, hash); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Unexpected wait of a %s pin: %v", s, err)
+		}
+		cancel()
+	}
+	peer.Store("pin_error")
+	if err := cluster.WaitPinned(context.Background(), hash); !errors.Is(err, ErrPinFailed) {
+		t.Errorf("Unexpected wait of a failed pin: %v", err)
+	}
+	peer.Store("pinned")
+	if err := cluster.WaitPinned(context.Background(), hash); err != nil {
+		t.Errorf("Unexpected wait of a pinned pin: %v", err)
+	}
+}
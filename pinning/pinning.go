@@ -0,0 +1,38 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package pinning holds the pins listed by the pinning services, in a form
+shared by all of them.
+*/
+package pinning // import "github.com/wabarc/ipfs-pinner/pinning"
+
+import (
+	"time"
+)
+
+// Status is the state of a pin, as named by the IPFS Pinning Services API.
+type Status string
+
+const (
+	Queued  Status = "queued"
+	Pinning Status = "pinning"
+	Pinned  Status = "pinned"
+	Failed  Status = "failed"
+)
+
+// PollInterval is the wait between two checks of the status of a pin, by
+// the WaitPinned functions.
+var PollInterval = 5 * time.Second
+
+// Pin is a pin held by a pinning service. Name, Meta, Size and Created are
+// left empty when the service does not record them.
+type Pin struct {
+	Cid     string            `json:"cid"`
+	Name    string            `json:"name,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+	Size    int64             `json:"size,omitempty"`
+	Created time.Time         `json:"created"`
+	Status  Status            `json:"status"`
+}
@@ -1,16 +1,21 @@
 package infura
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"mime/multipart"
 	"net/http"
+	"net/url"
+	"sort"
+	"strings"
 
 	"github.com/ipfs/boxo/files"
 	"github.com/wabarc/helper"
+	"github.com/wabarc/ipfs-pinner/capability"
 	"github.com/wabarc/ipfs-pinner/file"
+	"github.com/wabarc/ipfs-pinner/pinning"
 
 	httpretry "github.com/wabarc/ipfs-pinner/http"
 )
@@ -26,6 +31,18 @@ type Infura struct {
 	Secret string
 }
 
+// Capabilities describes what Infura supports.
+func (inf *Infura) Capabilities() capability.Capabilities {
+	return capability.Capabilities{
+		PinHash:   true,
+		Directory: true,
+		Metadata:  true,
+		Unpin:     true,
+		Status:    true,
+		List:      true,
+	}
+}
+
 type addEvent struct {
 	Name  string
 	Hash  string `json:",omitempty"`
@@ -42,65 +59,57 @@ func PinFile(fp string) (string, error) {
 }
 
 // PinFile pins content to Infura by providing a file path, it returns an IPFS
-// hash and an error.
-func (inf *Infura) PinFile(fp string) (string, error) {
-	mfr, err := file.NewMultiFileReader(fp, false)
+// hash and an error. The options select the entries taken from a directory,
+// and whether their mode and modification time are preserved.
+func (inf *Infura) PinFile(fp string, opts ...file.Option) (string, error) {
+	node, err := file.NewSerialFile(fp, opts...)
 	if err != nil {
 		return "", fmt.Errorf("unexpected creates multipart file: %v", err)
 	}
-	boundary := "multipart/form-data; boundary=" + mfr.Boundary()
 
-	return inf.pinFile(mfr, boundary)
+	return inf.PinNode(node)
 }
 
-// PinWithReader pins content to Infura by given io.Reader, it returns an IPFS hash and an error.
-func (inf *Infura) PinWithReader(rd io.Reader) (string, error) {
-	r, w := io.Pipe()
-	m := multipart.NewWriter(w)
-	fn := helper.RandString(6, "lower")
+// PinNode pins the entries of a Node walked by file.NewSerialFile, as
+// PinFile does, so that the walk can be reused.
+func (inf *Infura) PinNode(node *file.Node) (string, error) {
+	nd, err := node.Files()
+	if err != nil {
+		return "", fmt.Errorf("unexpected creates multipart file: %v", err)
+	}
+	fr := file.NewNodeReader(nd)
 
-	go func() {
-		defer w.Close()
-		defer m.Close()
+	// Kubo keeps the metadata sent with the files only when asked to.
+	query := url.Values{}
+	if node.PreserveMode() {
+		query.Set("preserve-mode", "true")
+	}
+	if node.PreserveMtime() {
+		query.Set("preserve-mtime", "true")
+	}
 
-		part, err := m.CreateFormFile("file", fn)
-		if err != nil {
-			return
-		}
+	return inf.pinFile(fr, fr.ContentType(), query)
+}
 
-		if _, err = io.Copy(part, rd); err != nil {
-			return
-		}
-	}()
+// PinWithReader pins content to Infura by given io.Reader, it returns an IPFS hash and an error.
+func (inf *Infura) PinWithReader(rd io.Reader) (string, error) {
+	fr := file.NewFormReader(helper.RandString(6, "lower"), rd)
 
-	return inf.pinFile(r, m.FormDataContentType())
+	return inf.pinFile(fr, fr.ContentType(), nil)
 }
 
 // PinWithBytes pins content to Infura by given byte slice, it returns an IPFS hash and an error.
 func (inf *Infura) PinWithBytes(buf []byte) (string, error) {
-	r, w := io.Pipe()
-	m := multipart.NewWriter(w)
-	fn := helper.RandString(6, "lower")
-
-	go func() {
-		defer w.Close()
-		defer m.Close()
+	fr := file.NewFormReaderWithBytes(helper.RandString(6, "lower"), buf)
 
-		part, err := m.CreateFormFile("file", fn)
-		if err != nil {
-			return
-		}
-
-		if _, err = part.Write(buf); err != nil {
-			return
-		}
-	}()
-
-	return inf.pinFile(r, m.FormDataContentType())
+	return inf.pinFile(fr, fr.ContentType(), nil)
 }
 
-func (inf *Infura) pinFile(r io.Reader, boundary string) (string, error) {
+func (inf *Infura) pinFile(r io.Reader, boundary string, query url.Values) (string, error) {
 	endpoint := api + "/api/v0/add?cid-version=1&pin=true"
+	if len(query) > 0 {
+		endpoint += "&" + query.Encode()
+	}
 	client := httpretry.NewClient(inf.Client)
 
 	req, err := http.NewRequest(http.MethodPost, endpoint, r)
@@ -121,7 +130,7 @@ func (inf *Infura) pinFile(r io.Reader, boundary string) (string, error) {
 	// It limits anonymous requests to 12 write requests/min.
 	// https://infura.io/docs/ipfs#section/Rate-Limits/API-Anonymous-Requests
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf(resp.Status)
+		return "", httpretry.NewStatusError(resp)
 	}
 
 	var out addEvent
@@ -172,7 +181,7 @@ func (inf *Infura) PinHash(hash string) (bool, error) {
 	// It limits anonymous requests to 12 write requests/min.
 	// https://infura.io/docs/ipfs#section/Rate-Limits/API-Anonymous-Requests
 	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf(resp.Status)
+		return false, httpretry.NewStatusError(resp)
 	}
 
 	data, err := ioutil.ReadAll(resp.Body)
@@ -195,8 +204,140 @@ func (inf *Infura) PinHash(hash string) (bool, error) {
 	return false, fmt.Errorf("pin hash to Infura failed")
 }
 
+// Pinned reports whether Infura holds a recursive pin of hash.
+func (inf *Infura) Pinned(hash string) (bool, error) {
+	status, err := inf.Status(context.Background(), hash)
+	return status == pinning.Pinned, err
+}
+
+// Status returns pinning.Pinned if Infura holds a recursive pin of hash,
+// and an empty status otherwise, Infura pinning synchronously.
+func (inf *Infura) Status(ctx context.Context, hash string) (pinning.Status, error) {
+	if hash == "" {
+		return "", fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v0/pin/ls?arg=%s&type=recursive", api, url.QueryEscape(hash))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	if inf.Apikey != "" && inf.Secret != "" {
+		req.SetBasicAuth(inf.Apikey, inf.Secret)
+	}
+	// Kubo answers 500 for content that is not pinned, which must not be
+	// retried.
+	client := inf.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Only the statuses carrying a pin list or a Kubo error are decoded, so
+	// that other failures are reported by their status.
+	var out struct {
+		Keys    map[string]interface{}
+		Message string
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return "", fmt.Errorf("decode pin list failed: %v", err)
+		}
+		if len(out.Keys) > 0 {
+			return pinning.Pinned, nil
+		}
+		return "", nil
+	case http.StatusInternalServerError:
+		if json.NewDecoder(resp.Body).Decode(&out) == nil && strings.Contains(out.Message, "not pinned") {
+			return "", nil
+		}
+	}
+
+	return "", httpretry.NewStatusError(resp)
+}
+
+// Unpin removes the recursive pin of hash from Infura.
+func (inf *Infura) Unpin(hash string) error {
+	if hash == "" {
+		return fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	endpoint := fmt.Sprintf("%s/api/v0/pin/rm?arg=%s", api, url.QueryEscape(hash))
+	req, err := http.NewRequest(http.MethodPost, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	if inf.Apikey != "" && inf.Secret != "" {
+		req.SetBasicAuth(inf.Apikey, inf.Secret)
+	}
+	// Kubo answers 500 for content that is not pinned, which must not be
+	// retried.
+	client := inf.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var out struct {
+			Message string
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&out); err == nil && out.Message != "" {
+			return fmt.Errorf("%w: %s", httpretry.NewStatusError(resp), out.Message)
+		}
+		return httpretry.NewStatusError(resp)
+	}
+
+	return nil
+}
+
+// List returns the recursive pins held by Infura. Infura does not record
+// names, sizes or creation times.
+func (inf *Infura) List() ([]pinning.Pin, error) {
+	req, err := http.NewRequest(http.MethodPost, api+"/api/v0/pin/ls?type=recursive", nil)
+	if err != nil {
+		return nil, err
+	}
+	if inf.Apikey != "" && inf.Secret != "" {
+		req.SetBasicAuth(inf.Apikey, inf.Secret)
+	}
+	client := httpretry.NewClient(inf.Client)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpretry.NewStatusError(resp)
+	}
+
+	var out struct {
+		Keys map[string]interface{}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode pin list failed: %v", err)
+	}
+	pins := make([]pinning.Pin, 0, len(out.Keys))
+	for hash := range out.Keys {
+		pins = append(pins, pinning.Pin{Cid: hash, Status: pinning.Pinned})
+	}
+	sort.Slice(pins, func(i, j int) bool { return pins[i].Cid < pins[j].Cid })
+
+	return pins, nil
+}
+
 // PinDir pins a directory to the Infura pinning service.
 func (inf *Infura) PinDir(mfr *files.MultiFileReader) (string, error) {
 	boundary := "multipart/form-data; boundary=" + mfr.Boundary()
-	return inf.pinFile(mfr, boundary)
+	return inf.pinFile(mfr, boundary, nil)
 }
@@ -2,6 +2,7 @@ package infura
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"io/ioutil"
 	"mime"
@@ -15,6 +16,8 @@ import (
 	"github.com/ipfs/go-cid"
 	"github.com/wabarc/helper"
 	"github.com/wabarc/ipfs-pinner/file"
+
+	httpretry "github.com/wabarc/ipfs-pinner/http"
 )
 
 var (
@@ -262,3 +265,108 @@ func TestRateLimit(t *testing.T) {
 		t.Fatalf("Invalid cid: %v", o)
 	}
 }
+
+func TestPinFileWithMetadata(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("preserve-mode") != "true" || query.Get("preserve-mtime") != "true" {
+			t.Errorf("Unexpected query %q", r.URL.RawQuery)
+		}
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		p, err := multipart.NewReader(r.Body, params["boundary"]).NextPart()
+		if err != nil {
+			t.Fatalf("Unexpected read part: %v", err)
+		}
+		_, params, _ = mime.ParseMediaType(p.Header.Get("Content-Disposition"))
+		if params["mode"] != "0640" || params["mtime"] == "" {
+			t.Errorf("Unexpected content disposition %v", params)
+		}
+		_, _ = w.Write([]byte(addJSON))
+	})
+	defer server.Close()
+
+	tmpfile, err := ioutil.TempFile("", "ipfs-pinner-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	if err := tmpfile.Chmod(0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	inf := &Infura{httpClient, apikey, secret}
+	if _, err := inf.PinFile(tmpfile.Name(), file.PreserveMode(), file.PreserveMtime()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPinned(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/api/v0/pin/ls", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte("invalid project id\n"))
+			return
+		}
+		if r.URL.Query().Get("arg") != "Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a" {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"Message":"path is not pinned","Code":0,"Type":"error"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"Keys":{"Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a":{"Type":"recursive"}}}`))
+	})
+	defer server.Close()
+
+	inf := &Infura{httpClient, apikey, secret}
+	if ok, err := inf.Pinned("Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a"); !ok || err != nil {
+		t.Errorf("Unexpected pin status %v: %v", ok, err)
+	}
+	if ok, err := inf.Pinned("QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"); ok || err != nil {
+		t.Errorf("Unexpected pin status %v: %v", ok, err)
+	}
+	// A failure without a pin list is reported by its status.
+	inf = &Infura{Client: httpClient}
+	var se *httpretry.StatusError
+	if _, err := inf.Pinned("Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a"); !errors.As(err, &se) || se.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Unexpected error of an unauthorized request: %v", err)
+	}
+}
+
+func TestUnpin(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/api/v0/pin/rm", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("arg") != "Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a" {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"Message":"not pinned or pinned indirectly","Code":0,"Type":"error"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"Pins":["Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a"]}`))
+	})
+	defer server.Close()
+
+	inf := &Infura{httpClient, apikey, secret}
+	if err := inf.Unpin("Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a"); err != nil {
+		t.Errorf("Unexpected unpin: %v", err)
+	}
+	if err := inf.Unpin("QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"); err == nil || !strings.Contains(err.Error(), "not pinned") {
+		t.Errorf("Unexpected unpin of content not pinned: %v", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/api/v0/pin/ls", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Keys":{"QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o":{"Type":"recursive"},"Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a":{"Type":"recursive"}}}`))
+	})
+	defer server.Close()
+
+	inf := &Infura{httpClient, apikey, secret}
+	pins, err := inf.List()
+	if err != nil {
+		t.Fatalf("Unexpected list pins: %v", err)
+	}
+	if len(pins) != 2 || pins[0].Cid != "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o" || pins[1].Status != "pinned" {
+		t.Errorf("Unexpected pins: %+v", pins)
+	}
+}
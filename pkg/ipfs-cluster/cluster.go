@@ -1,6 +1,366 @@
 package ipfsCluster
 
-//
-// func PinFile() {}
-//
-// func PinHash() {}
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/ipfs-pinner/capability"
+	"github.com/wabarc/ipfs-pinner/file"
+	"github.com/wabarc/ipfs-pinner/pinning"
+
+	httpretry "github.com/wabarc/ipfs-pinner/http"
+)
+
+// api is the default address of the REST API of a cluster peer.
+const api = "http://127.0.0.1:9094"
+
+// Cluster represents an IPFS Cluster configuration. Requests carry the
+// basic authentication of Apikey and Secret if both are set, or Apikey as
+// a bearer token if only it is set.
+type Cluster struct {
+	*http.Client
+
+	Apikey string
+	Secret string
+
+	// Endpoint is the base URL of the REST API of a cluster peer, such as
+	// https://cluster.example.com:9094, http://127.0.0.1:9094 if empty.
+	Endpoint string
+}
+
+// endpoint returns the base URL of the REST API, without a trailing slash.
+func (c *Cluster) endpoint() string {
+	if c.Endpoint == "" {
+		return api
+	}
+	return strings.TrimRight(c.Endpoint, "/")
+}
+
+// Capabilities describes what IPFS Cluster supports.
+func (c *Cluster) Capabilities() capability.Capabilities {
+	return capability.Capabilities{
+		PinHash:   true,
+		Directory: true,
+		Unpin:     true,
+		Status:    true,
+		List:      true,
+		Names:     true,
+	}
+}
+
+// cidValue is a CID, encoded as a string or as a link object {"/": cid}
+// depending on the version of the cluster.
+type cidValue string
+
+func (v *cidValue) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*v = cidValue(s)
+		return nil
+	}
+	var link struct {
+		Cid string `json:"/"`
+	}
+	if err := json.Unmarshal(b, &link); err != nil {
+		return err
+	}
+	*v = cidValue(link.Cid)
+	return nil
+}
+
+type addEvent struct {
+	Name string
+	Cid  cidValue
+}
+
+// PinFile pins content to IPFS Cluster by providing a file path, it returns
+// an IPFS hash and an error. The options select the entries taken from a
+// directory.
+func (c *Cluster) PinFile(fp string, opts ...file.Option) (string, error) {
+	node, err := file.NewSerialFile(fp, opts...)
+	if err != nil {
+		return "", fmt.Errorf("unexpected creates multipart file: %v", err)
+	}
+
+	return c.PinNode(node)
+}
+
+// PinNode pins the entries of a Node walked by file.NewSerialFile, as
+// PinFile does, so that the walk can be reused.
+func (c *Cluster) PinNode(node *file.Node) (string, error) {
+	nd, err := node.Files()
+	if err != nil {
+		return "", fmt.Errorf("unexpected creates multipart file: %v", err)
+	}
+	fr := file.NewNodeReader(nd)
+
+	return c.pinFile(fr, fr.ContentType())
+}
+
+// PinWithReader pins content to IPFS Cluster by given io.Reader, it returns an IPFS hash and an error.
+func (c *Cluster) PinWithReader(rd io.Reader) (string, error) {
+	fr := file.NewFormReader(helper.RandString(6, "lower"), rd)
+
+	return c.pinFile(fr, fr.ContentType())
+}
+
+// PinWithBytes pins content to IPFS Cluster by given byte slice, it returns an IPFS hash and an error.
+func (c *Cluster) PinWithBytes(buf []byte) (string, error) {
+	fr := file.NewFormReaderWithBytes(helper.RandString(6, "lower"), buf)
+
+	return c.pinFile(fr, fr.ContentType())
+}
+
+func (c *Cluster) pinFile(r io.Reader, boundary string) (string, error) {
+	req, err := http.NewRequest(http.MethodPost, c.endpoint()+"/add?cid-version=1", r)
+	if err != nil {
+		return "", err
+	}
+	c.authorize(req)
+	req.Header.Add("Content-Type", boundary)
+	resp, err := httpretry.NewClient(c.Client).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", httpretry.NewStatusError(resp)
+	}
+
+	// The added entries are streamed, the root comes last.
+	var out addEvent
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var evt addEvent
+		if err := dec.Decode(&evt); err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		out = evt
+	}
+	if out.Cid == "" {
+		return "", fmt.Errorf("add to IPFS Cluster failed")
+	}
+
+	return string(out.Cid), nil
+}
+
+// PinHash pins content to IPFS Cluster by giving an IPFS hash, it returns the result and an error.
+func (c *Cluster) PinHash(hash string) (bool, error) {
+	return c.PinHashNamed(hash, "", nil)
+}
+
+// PinHashNamed pins content to IPFS Cluster by giving an IPFS hash, with
+// the name and the metadata of the pin if not empty.
+func (c *Cluster) PinHashNamed(hash, name string, meta map[string]string) (bool, error) {
+	if hash == "" {
+		return false, fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+	for k, v := range meta {
+		query.Set("meta-"+k, v)
+	}
+	endpoint := c.endpoint() + "/pins/" + url.PathEscape(hash)
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, nil)
+	if err != nil {
+		return false, err
+	}
+	c.authorize(req)
+	resp, err := httpretry.NewClient(c.Client).Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return false, httpretry.NewStatusError(resp)
+	}
+
+	var out struct {
+		Cid cidValue
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return false, fmt.Errorf("decode pin failed: %v", err)
+	}
+
+	return string(out.Cid) == hash, nil
+}
+
+// Pinned reports whether IPFS Cluster holds a pin of hash on any peer,
+// including one still queued or in progress.
+func (c *Cluster) Pinned(hash string) (bool, error) {
+	status, err := c.Status(context.Background(), hash)
+	switch status {
+	case pinning.Queued, pinning.Pinning, pinning.Pinned:
+		return true, err
+	}
+	return false, err
+}
+
+// Status returns the most advanced status of the pin of hash on the peers
+// of IPFS Cluster, pinning.Pinned once a peer holds it, and empty if none
+// tracks it.
+func (c *Cluster) Status(ctx context.Context, hash string) (pinning.Status, error) {
+	if hash == "" {
+		return "", fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.endpoint()+"/pins/"+url.PathEscape(hash), nil)
+	if err != nil {
+		return "", err
+	}
+	c.authorize(req)
+	resp, err := httpretry.NewClient(c.Client).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", httpretry.NewStatusError(resp)
+	}
+
+	var out struct {
+		PeerMap map[string]struct {
+			Status string
+		} `json:"peer_map"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("decode pin status failed: %v", err)
+	}
+	var status pinning.Status
+	for _, peer := range out.PeerMap {
+		switch {
+		case peer.Status == "pinned":
+			return pinning.Pinned, nil
+		case peer.Status == "pinning":
+			status = pinning.Pinning
+		case peer.Status == "pin_queued" && status != pinning.Pinning:
+			status = pinning.Queued
+		case peer.Status == "pin_error" && status == "":
+			status = pinning.Failed
+		}
+	}
+
+	return status, nil
+}
+
+// Unpin removes the pin of hash from IPFS Cluster.
+func (c *Cluster) Unpin(hash string) error {
+	if hash == "" {
+		return fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, c.endpoint()+"/pins/"+url.PathEscape(hash), nil)
+	if err != nil {
+		return err
+	}
+	c.authorize(req)
+	resp, err := httpretry.NewClient(c.Client).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		return httpretry.NewStatusError(resp)
+	}
+
+	return nil
+}
+
+type pin struct {
+	Cid       cidValue
+	Name      string
+	Metadata  map[string]string
+	Timestamp time.Time
+}
+
+// List returns the pins held by IPFS Cluster. The cluster does not record
+// the size of pins, and does not tell their status in the listing.
+func (c *Cluster) List() ([]pinning.Pin, error) {
+	req, err := http.NewRequest(http.MethodGet, c.endpoint()+"/allocations?filter=pin", nil)
+	if err != nil {
+		return nil, err
+	}
+	c.authorize(req)
+	resp, err := httpretry.NewClient(c.Client).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpretry.NewStatusError(resp)
+	}
+
+	// Recent clusters stream the pins, older ones answer an array.
+	var out []pin
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("decode pin list failed: %v", err)
+		}
+		var (
+			ps  []pin
+			err error
+		)
+		if len(raw) > 0 && raw[0] == '[' {
+			err = json.Unmarshal(raw, &ps)
+		} else {
+			ps = make([]pin, 1)
+			err = json.Unmarshal(raw, &ps[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode pin list failed: %v", err)
+		}
+		out = append(out, ps...)
+	}
+
+	pins := make([]pinning.Pin, 0, len(out))
+	for _, p := range out {
+		pins = append(pins, pinning.Pin{
+			Cid:     string(p.Cid),
+			Name:    p.Name,
+			Meta:    p.Metadata,
+			Created: p.Timestamp,
+			Status:  pinning.Pinned,
+		})
+	}
+	sort.Slice(pins, func(i, j int) bool { return pins[i].Cid < pins[j].Cid })
+
+	return pins, nil
+}
+
+func (c *Cluster) authorize(req *http.Request) {
+	switch {
+	case c.Apikey != "" && c.Secret != "":
+		req.SetBasicAuth(c.Apikey, c.Secret)
+	case c.Apikey != "":
+		req.Header.Set("Authorization", "Bearer "+c.Apikey)
+	}
+}
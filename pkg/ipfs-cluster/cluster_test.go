@@ -0,0 +1,175 @@
+package ipfsCluster
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/ipfs-pinner/pinning"
+)
+
+const (
+	hash  = "bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi"
+	other = "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"
+)
+
+func handleResponse(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/add":
+			if r.URL.Query().Get("cid-version") != "1" {
+				t.Errorf("Unexpected query %s", r.URL.RawQuery)
+			}
+			_ = r.ParseMultipartForm(32 << 20)
+			_, _ = w.Write([]byte(`{"name":"a","cid":{"/":"` + other + `"}}` + "\n" + `{"name":"dir","cid":{"/":"` + hash + `"}}` + "\n"))
+		case r.URL.Path == "/pins/"+hash && r.Method == http.MethodPost:
+			q := r.URL.Query()
+			if q.Get("name") != "" && (q.Get("name") != "site" || q.Get("meta-env") != "prod") {
+				t.Errorf("Unexpected query %s", r.URL.RawQuery)
+			}
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"cid":"` + hash + `","name":"` + q.Get("name") + `"}`))
+		case r.URL.Path == "/pins/"+hash && r.Method == http.MethodGet:
+			_, _ = w.Write([]byte(`{"cid":"` + hash + `","peer_map":{"a":{"status":"pin_error"},"b":{"status":"pinned"}}}`))
+		case r.URL.Path == "/pins/"+hash && r.Method == http.MethodDelete:
+			_, _ = w.Write([]byte(`{"cid":"` + hash + `"}`))
+		case r.URL.Path == "/allocations":
+			_, _ = w.Write([]byte(`{"cid":"` + other + `","name":"b"}` + "\n" + `{"cid":{"/":"` + hash + `"},"name":"site","metadata":{"env":"prod"}}` + "\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+func TestPinFile(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", handleResponse(t))
+	defer server.Close()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a"), []byte(helper.RandString(6, "lower")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &Cluster{Client: httpClient, Apikey: "user", Secret: "pass"}
+	o, err := c.PinFile(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o != hash {
+		t.Errorf("Unexpected cid %s, the root is last", o)
+	}
+	if o, err = c.PinWithReader(strings.NewReader("ipfs-pinner")); err != nil || o != hash {
+		t.Errorf("Unexpected pin with reader %s: %v", o, err)
+	}
+	if o, err = c.PinWithBytes([]byte("ipfs-pinner")); err != nil || o != hash {
+		t.Errorf("Unexpected pin with bytes %s: %v", o, err)
+	}
+
+	c.Secret = ""
+	if _, err := c.PinWithBytes([]byte("ipfs-pinner")); err == nil {
+		t.Error("Unexpected pin without authentication")
+	}
+}
+
+func TestPinHash(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", handleResponse(t))
+	defer server.Close()
+
+	c := &Cluster{Client: httpClient, Apikey: "user", Secret: "pass"}
+	if ok, err := c.PinHash(hash); !ok || err != nil {
+		t.Errorf("Unexpected pin hash: %v", err)
+	}
+	if ok, err := c.PinHashNamed(hash, "site", map[string]string{"env": "prod"}); !ok || err != nil {
+		t.Errorf("Unexpected pin hash named: %v", err)
+	}
+	if ok, err := c.Pinned(hash); !ok || err != nil {
+		t.Errorf("Unexpected status of a pinned cid: %v", err)
+	}
+	if ok, err := c.Pinned(other); ok || err != nil {
+		t.Errorf("Unexpected status of an unknown cid: %v", err)
+	}
+	if err := c.Unpin(hash); err != nil {
+		t.Errorf("Unexpected unpin: %v", err)
+	}
+	if err := c.Unpin(other); err == nil {
+		t.Error("Unexpected unpin of an unknown cid")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	var peers string
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/pins/"+hash, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"cid":"` + hash + `","peer_map":{` + peers + `}}`))
+	})
+	defer server.Close()
+
+	c := &Cluster{Client: httpClient}
+	tests := []struct {
+		peers  string
+		status pinning.Status
+		pinned bool
+	}{
+		{`"a":{"status":"pin_error"},"b":{"status":"pinned"}`, pinning.Pinned, true},
+		{`"a":{"status":"pin_queued"},"b":{"status":"pinning"}`, pinning.Pinning, true},
+		{`"a":{"status":"pin_error"},"b":{"status":"pin_queued"}`, pinning.Queued, true},
+		{`"a":{"status":"pin_error"}`, pinning.Failed, false},
+		{`"a":{"status":"unpinned"}`, "", false},
+	}
+	for _, test := range tests {
+		peers = test.peers
+		if s, err := c.Status(context.Background(), hash); s != test.status || err != nil {
+			t.Errorf("Unexpected status %q of %s: %v", s, test.peers, err)
+		}
+		if ok, err := c.Pinned(hash); ok != test.pinned || err != nil {
+			t.Errorf("Unexpected pinned %v of %s: %v", ok, test.peers, err)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", handleResponse(t))
+	defer server.Close()
+
+	c := &Cluster{Client: httpClient, Apikey: "user", Secret: "pass"}
+	pins, err := c.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []pinning.Pin{
+		{Cid: other, Name: "b", Status: pinning.Pinned},
+		{Cid: hash, Name: "site", Meta: map[string]string{"env": "prod"}, Status: pinning.Pinned},
+	}
+	if !reflect.DeepEqual(pins, expected) {
+		t.Errorf("Unexpected pins %+v", pins)
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/cluster/", http.StripPrefix("/cluster", handleResponse(t)))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := &Cluster{Apikey: "user", Secret: "pass", Endpoint: server.URL + "/cluster/"}
+	if ok, err := c.PinHash(hash); !ok || err != nil {
+		t.Errorf("Unexpected pin hash through the endpoint: %v", err)
+	}
+	if ok, err := c.Pinned(hash); !ok || err != nil {
+		t.Errorf("Unexpected status through the endpoint: %v", err)
+	}
+}
@@ -1,2 +1,6 @@
+// IPFS Cluster orchestrates pins across a self-hosted set of IPFS peers,
+// through the REST API of a cluster peer, which listens on 127.0.0.1:9094
+// by default, Cluster.Endpoint addresses another peer. Pins carry a name
+// and key-value metadata.
 // https://cluster.ipfs.io/documentation/guides/pinning/
 package ipfsCluster
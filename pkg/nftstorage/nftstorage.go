@@ -2,14 +2,19 @@ package nftstorage
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"time"
 
+	"github.com/wabarc/ipfs-pinner/capability"
 	"github.com/wabarc/ipfs-pinner/file"
+	"github.com/wabarc/ipfs-pinner/pinning"
 
 	httpretry "github.com/wabarc/ipfs-pinner/http"
 )
@@ -23,6 +28,21 @@ type NFTStorage struct {
 	Apikey string
 }
 
+// Capabilities describes what NFTStorage supports.
+func (nft *NFTStorage) Capabilities() capability.Capabilities {
+	return capability.Capabilities{
+		Directory: true,
+		CAR:       true,
+		Metadata:  true,
+		Unpin:     true,
+		Status:    true,
+		List:      true,
+
+		MaxRequestSize: capability.DotStorageRequestSize,
+		MaxTotalSize:   capability.DotStorageTotalSize,
+	}
+}
+
 type value struct {
 	Cid     string
 	Size    int64  `json:",omitempty"`
@@ -41,31 +61,48 @@ type addEvent struct {
 }
 
 // PinFile pins content to NFTStorage by providing a file path, it returns an IPFS
-// hash and an error.
-func (nft *NFTStorage) PinFile(fp string) (string, error) {
-	fi, err := os.Stat(fp)
+// hash and an error. The options select the entries taken from a directory.
+//
+// If the mode or the modification time is preserved, the DAG is built
+// locally and uploaded as a CAR file, since a form cannot carry them.
+func (nft *NFTStorage) PinFile(fp string, opts ...file.Option) (string, error) {
+	node, err := file.NewSerialFile(fp, opts...)
 	if err != nil {
 		return "", err
 	}
 
+	return nft.PinNode(node)
+}
+
+// PinNode pins the entries of a Node walked by file.NewSerialFile, as
+// PinFile does, so that the walk can be reused.
+func (nft *NFTStorage) PinNode(node *file.Node) (string, error) {
+	if node.PreserveMetadata() {
+		nd, err := node.Files()
+		if err != nil {
+			return "", err
+		}
+		return nft.PinCAR(file.NewCARReader(nd))
+	}
+
 	// For regular file
-	if fi.Mode().IsRegular() {
-		f, err := os.Open(fp)
+	if node.Mode().IsRegular() {
+		f, err := os.Open(node.Root())
 		if err != nil {
 			return "", err
 		}
 		defer f.Close()
 
-		return nft.pinFile(f, file.MediaType(f))
-	}
+		mtype, err := file.DetectFile(f)
+		if err != nil {
+			return "", err
+		}
 
-	// For directory, or etc
-	f, err := file.NewSerialFile(fp)
-	if err != nil {
-		return "", err
+		return nft.pinFile(f, mtype)
 	}
 
-	mfr, err := file.CreateMultiForm(f, true)
+	// For directory, or etc
+	mfr, err := file.CreateMultiForm(node, true)
 	if err != nil {
 		return "", err
 	}
@@ -75,13 +112,28 @@ func (nft *NFTStorage) PinFile(fp string) (string, error) {
 }
 
 // PinWithReader pins content to NFTStorage by given io.Reader, it returns an IPFS hash and an error.
+// The media type of a *file.NamedReader replaces the detected one, its name is not uploaded.
 func (nft *NFTStorage) PinWithReader(rd io.Reader) (string, error) {
-	return nft.pinFile(rd, file.MediaType(rd))
+	if nr, ok := rd.(*file.NamedReader); ok && nr.ContentType != "" {
+		return nft.pinFile(nr, nr.ContentType)
+	}
+	mtype, r, err := file.DetectReader(rd, "")
+	if err != nil {
+		return "", err
+	}
+
+	return nft.pinFile(r, mtype)
 }
 
 // PinWithBytes pins content to NFTStorage by given byte slice, it returns an IPFS hash and an error.
 func (nft *NFTStorage) PinWithBytes(buf []byte) (string, error) {
-	return nft.pinFile(bytes.NewReader(buf), file.MediaType(buf))
+	return nft.pinFile(bytes.NewReader(buf), file.DetectBytes(buf, ""))
+}
+
+// PinCAR pins the DAG of the CAR file read from r to NFTStorage, it
+// returns the root CID and an error.
+func (nft *NFTStorage) PinCAR(r io.Reader) (string, error) {
+	return nft.pinFile(r, "application/car")
 }
 
 func (nft *NFTStorage) pinFile(r io.Reader, boundary string) (string, error) {
@@ -101,7 +153,7 @@ func (nft *NFTStorage) pinFile(r io.Reader, boundary string) (string, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf(resp.Status)
+		return "", httpretry.NewStatusError(resp)
 	}
 
 	data, err := ioutil.ReadAll(resp.Body)
@@ -123,11 +175,147 @@ func (nft *NFTStorage) pinFile(r io.Reader, boundary string) (string, error) {
 // PinHash pins content to NFTStorage by giving an IPFS hash, it returns the result and an error.
 // Note: unsupported
 func (nft *NFTStorage) PinHash(hash string) (bool, error) {
-	return false, fmt.Errorf("not yet supported")
+	return false, fmt.Errorf("pin hash: %w", capability.ErrUnsupported)
+}
+
+// Pinned reports whether NFT.Storage holds a pin of hash, including one still
+// queued or in progress.
+func (nft *NFTStorage) Pinned(hash string) (bool, error) {
+	status, err := nft.Status(context.Background(), hash)
+	switch status {
+	case pinning.Queued, pinning.Pinning, pinning.Pinned:
+		return true, err
+	}
+	return false, err
+}
+
+// Status returns the status of the pin of hash on NFT.Storage, empty if it
+// holds none.
+func (nft *NFTStorage) Status(ctx context.Context, hash string) (pinning.Status, error) {
+	if hash == "" {
+		return "", fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, api+"/check/"+url.PathEscape(hash), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Authorization", "Bearer "+nft.Apikey)
+	client := httpretry.NewClient(nft.Client)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", httpretry.NewStatusError(resp)
+	}
+
+	var out struct {
+		Value struct {
+			Pin struct {
+				Status string
+			}
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("decode pin status failed: %v", err)
+	}
+	switch status := pinning.Status(out.Value.Pin.Status); status {
+	case pinning.Queued, pinning.Pinning, pinning.Pinned, pinning.Failed:
+		return status, nil
+	}
+
+	return "", nil
+}
+
+// Unpin removes the upload of hash from NFT.Storage.
+func (nft *NFTStorage) Unpin(hash string) error {
+	if hash == "" {
+		return fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, api+"/"+url.PathEscape(hash), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", "Bearer "+nft.Apikey)
+	client := httpretry.NewClient(nft.Client)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpretry.NewStatusError(resp)
+	}
+
+	return nil
+}
+
+// listPageSize is the largest page of uploads NFT.Storage returns.
+const listPageSize = 1000
+
+// List returns the uploads of the NFT.Storage account, newest first.
+func (nft *NFTStorage) List() ([]pinning.Pin, error) {
+	var pins []pinning.Pin
+	before := time.Now().UTC()
+	for {
+		endpoint := fmt.Sprintf("%s/?limit=%d&before=%s", api, listPageSize, url.QueryEscape(before.Format(time.RFC3339Nano)))
+		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Authorization", "Bearer "+nft.Apikey)
+		client := httpretry.NewClient(nft.Client)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var out struct {
+			Value []struct {
+				Cid     string
+				Size    int64
+				Created time.Time
+				Pin     struct {
+					Name   string
+					Status string
+				}
+			}
+		}
+		err = json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, httpretry.NewStatusError(resp)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode upload list failed: %v", err)
+		}
+
+		for _, v := range out.Value {
+			pins = append(pins, pinning.Pin{
+				Cid:     v.Cid,
+				Name:    v.Pin.Name,
+				Size:    v.Size,
+				Created: v.Created,
+				Status:  pinning.Status(v.Pin.Status),
+			})
+		}
+		if len(out.Value) < listPageSize {
+			return pins, nil
+		}
+		before = out.Value[len(out.Value)-1].Created
+	}
 }
 
 // PinDir pins a directory to the NFT.Storage pinning service.
 // It alias to PinFile.
-func (nft *NFTStorage) PinDir(name string) (string, error) {
-	return nft.PinFile(name)
+func (nft *NFTStorage) PinDir(name string, opts ...file.Option) (string, error) {
+	return nft.PinFile(name, opts...)
 }
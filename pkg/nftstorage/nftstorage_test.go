@@ -8,11 +8,14 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/ipfs/go-cid"
 	"github.com/wabarc/helper"
+	"github.com/wabarc/ipfs-pinner/file"
+	"github.com/wabarc/ipfs-pinner/unixfs"
 )
 
 var (
@@ -165,6 +168,32 @@ func TestPinWithReader(t *testing.T) {
 	}
 }
 
+func TestPinWithReaderUploadsWholeContent(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	defer server.Close()
+
+	content := helper.RandString(10000, "lower")
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != content {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(badRequestJSON))
+			return
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(badRequestJSON))
+			return
+		}
+		_, _ = w.Write([]byte(uploadJSON))
+	})
+
+	nft := &NFTStorage{Apikey: "fake-nft-storage-apikey", Client: httpClient}
+	if _, err := nft.PinWithReader(strings.NewReader(content)); err != nil {
+		t.Fatal(err)
+	}
+}
+
 func TestPinWithBytes(t *testing.T) {
 	httpClient, mux, server := helper.MockServer()
 	mux.HandleFunc("/", handleResponse)
@@ -235,3 +264,107 @@ func TestPinHash(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestPinFileWithMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfs-pinner-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := []file.Option{file.PreserveMode(), file.PreserveMtime()}
+	node, err := file.NewSerialFile(dir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, err := node.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := unixfs.Sum(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/upload" || r.Header.Get("Content-Type") != "application/car" {
+			t.Errorf("Unexpected upload to %s as %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if !bytes.Contains(body, root.Bytes()) {
+			t.Errorf("Unexpected car without the root %s", root)
+		}
+		_, _ = w.Write([]byte(uploadJSON))
+	})
+	defer server.Close()
+
+	nft := &NFTStorage{httpClient, "fake-api-key"}
+	if _, err := nft.PinFile(dir, opts...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPinned(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/check/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/check/bafkreidivzimqfqtoqxkrpge6bjyhlvxqs3rhe73owtmdulaxr5do5in7u" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"value":{"cid":"x","pin":{"status":"pinned"}}}`))
+	})
+	defer server.Close()
+
+	pinner := &NFTStorage{httpClient, "fake-api-key"}
+	if ok, err := pinner.Pinned("bafkreidivzimqfqtoqxkrpge6bjyhlvxqs3rhe73owtmdulaxr5do5in7u"); !ok || err != nil {
+		t.Errorf("Unexpected pin status %v: %v", ok, err)
+	}
+	if ok, err := pinner.Pinned("QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"); ok || err != nil {
+		t.Errorf("Unexpected pin status %v: %v", ok, err)
+	}
+}
+
+func TestUnpin(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.Path != "/bafkreidivzimqfqtoqxkrpge6bjyhlvxqs3rhe73owtmdulaxr5do5in7u" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	})
+	defer server.Close()
+
+	pinner := &NFTStorage{httpClient, "fake-api-key"}
+	if err := pinner.Unpin("bafkreidivzimqfqtoqxkrpge6bjyhlvxqs3rhe73owtmdulaxr5do5in7u"); err != nil {
+		t.Errorf("Unexpected unpin: %v", err)
+	}
+	if err := pinner.Unpin("QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"); err == nil {
+		t.Error("Unexpected unpin of content not uploaded")
+	}
+}
+
+func TestList(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("limit") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"ok":true,"value":[{"cid":"bafkreidivzimqfqtoqxkrpge6bjyhlvxqs3rhe73owtmdulaxr5do5in7u","size":5,"created":"2023-01-02T03:04:05.000Z","pin":{"name":"hello","status":"queued"}}]}`))
+	})
+	defer server.Close()
+
+	pinner := &NFTStorage{httpClient, "fake-api-key"}
+	pins, err := pinner.List()
+	if err != nil {
+		t.Fatalf("Unexpected list pins: %v", err)
+	}
+	if len(pins) != 1 || pins[0].Name != "hello" || pins[0].Status != "queued" || pins[0].Size != 5 {
+		t.Errorf("Unexpected pins: %+v", pins)
+	}
+}
@@ -2,16 +2,21 @@ package pinata
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"mime/multipart"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"time"
 
 	"github.com/wabarc/helper"
+	"github.com/wabarc/ipfs-pinner/capability"
 	"github.com/wabarc/ipfs-pinner/file"
+	"github.com/wabarc/ipfs-pinner/pinning"
 
 	httpretry "github.com/wabarc/ipfs-pinner/http"
 )
@@ -19,8 +24,47 @@ import (
 const (
 	PIN_FILE_URL = "https://api.pinata.cloud/pinning/pinFileToIPFS"
 	PIN_HASH_URL = "https://api.pinata.cloud/pinning/pinByHash"
+	PIN_LIST_URL = "https://api.pinata.cloud/data/pinList"
+	PIN_JOBS_URL = "https://api.pinata.cloud/pinning/pinJobs"
+	UNPIN_URL    = "https://api.pinata.cloud/pinning/unpin"
 )
 
+// ErrPinJobFailed is returned, wrapped, when the pin job of a hash ends
+// without pinning it, such as when the content is not found in time.
+var ErrPinJobFailed = errors.New("pin job failed")
+
+// PinJob is a pin by hash queued by Pinata, which searches the content on
+// the network before pinning it. The job is gone once the hash is pinned.
+type PinJob struct {
+	ID     string    `json:"id"`
+	Cid    string    `json:"ipfs_pin_hash"`
+	Name   string    `json:"name"`
+	Status string    `json:"status"`
+	Queued time.Time `json:"date_queued"`
+}
+
+// Failed reports whether the job ended without pinning its hash.
+func (j PinJob) Failed() bool {
+	switch j.Status {
+	case "expired", "over_free_limit", "over_max_size", "invalid_object", "bad_host_node":
+		return true
+	}
+	return false
+}
+
+// PinStatus returns the status of the pin of the job, pinning.Failed if
+// it failed, pinning.Pinning once the content is being retrieved, and
+// pinning.Queued before.
+func (j PinJob) PinStatus() pinning.Status {
+	switch {
+	case j.Failed():
+		return pinning.Failed
+	case j.Status == "retrieving":
+		return pinning.Pinning
+	}
+	return pinning.Queued
+}
+
 // Pinata represents a Pinata configuration.
 type Pinata struct {
 	*http.Client
@@ -29,6 +73,18 @@ type Pinata struct {
 	Secret string
 }
 
+// Capabilities describes what Pinata supports.
+func (p *Pinata) Capabilities() capability.Capabilities {
+	return capability.Capabilities{
+		PinHash:   true,
+		Directory: true,
+		Unpin:     true,
+		Status:    true,
+		List:      true,
+		Names:     true,
+	}
+}
+
 type addEvent struct {
 	IpfsHash  string
 	PinSize   int64  `json:",omitempty"`
@@ -36,13 +92,24 @@ type addEvent struct {
 }
 
 // PinFile pins content to Pinata by providing a file path, it returns an IPFS
-// hash and an error.
-func (p *Pinata) PinFile(fp string) (string, error) {
-	f, err := file.NewSerialFile(fp)
+// hash and an error. The options select the entries taken from a directory.
+func (p *Pinata) PinFile(fp string, opts ...file.Option) (string, error) {
+	f, err := file.NewSerialFile(fp, opts...)
 	if err != nil {
 		return "", err
 	}
-	f.MapDirectory(filepath.Base(fp))
+
+	return p.PinNode(f)
+}
+
+// PinNode pins the entries of a Node walked by file.NewSerialFile, as
+// PinFile does, so that the walk can be reused. A directory is uploaded
+// under the base name of its root.
+func (p *Pinata) PinNode(f *file.Node) (string, error) {
+	if f.PreserveMetadata() {
+		return "", fmt.Errorf("preserving mode and mtime: %w", capability.ErrUnsupported)
+	}
+	f.MapDirectory(filepath.Base(f.Root()))
 
 	mfr, err := file.CreateMultiForm(f, true)
 	if err != nil {
@@ -55,49 +122,16 @@ func (p *Pinata) PinFile(fp string) (string, error) {
 
 // PinWithReader pins content to Pinata by given io.Reader, it returns an IPFS hash and an error.
 func (p *Pinata) PinWithReader(rd io.Reader) (string, error) {
-	r, w := io.Pipe()
-	m := multipart.NewWriter(w)
-	fn := helper.RandString(6, "lower")
-
-	go func() {
-		defer w.Close()
-		defer m.Close()
-
-		part, err := m.CreateFormFile("file", fn)
-		if err != nil {
-			return
-		}
-
-		if _, err = io.Copy(part, rd); err != nil {
-			return
-		}
-	}()
+	fr := file.NewFormReader(helper.RandString(6, "lower"), rd)
 
-	return p.pinFile(r, m.FormDataContentType())
+	return p.pinFile(fr, fr.ContentType())
 }
 
 // PinWithBytes pins content to Infura by given byte slice, it returns an IPFS hash and an error.
 func (p *Pinata) PinWithBytes(buf []byte) (string, error) {
-	r, w := io.Pipe()
-	m := multipart.NewWriter(w)
-	fn := helper.RandString(6, "lower")
+	fr := file.NewFormReaderWithBytes(helper.RandString(6, "lower"), buf)
 
-	go func() {
-		defer w.Close()
-		defer m.Close()
-
-		// m.WriteField("pinataOptions", `{cidVersion: 1}`)
-		part, err := m.CreateFormFile("file", fn)
-		if err != nil {
-			return
-		}
-
-		if _, err = part.Write(buf); err != nil {
-			return
-		}
-	}()
-
-	return p.pinFile(r, m.FormDataContentType())
+	return p.pinFile(fr, fr.ContentType())
 }
 
 func (p *Pinata) pinFile(r io.Reader, boundary string) (string, error) {
@@ -136,7 +170,7 @@ func (p *Pinata) pinFile(r io.Reader, boundary string) (string, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf(resp.Status)
+		return "", httpretry.NewStatusError(resp)
 	}
 
 	data, err := ioutil.ReadAll(resp.Body)
@@ -157,15 +191,44 @@ func (p *Pinata) pinFile(r io.Reader, boundary string) (string, error) {
 
 // PinHash pins content to Pinata by giving an IPFS hash, it returns the result and an error.
 func (p *Pinata) PinHash(hash string) (bool, error) {
+	return p.PinHashNamed(hash, "", nil)
+}
+
+// PinHashNamed pins content to Pinata by giving an IPFS hash, with the name
+// and the key-values of the pin if not empty. It reports whether the pin
+// job was queued, see PinHashJob.
+func (p *Pinata) PinHashNamed(hash, name string, meta map[string]string) (bool, error) {
+	job, err := p.PinHashJob(hash, name, meta)
+	if err != nil {
+		return false, err
+	}
+	return job.Cid == hash, nil
+}
+
+// PinHashJob queues the pin of an IPFS hash like PinHashNamed, and returns
+// its pin job. The hash is only pinned once the job finds the content, use
+// WaitPinned to wait for it.
+func (p *Pinata) PinHashJob(hash, name string, meta map[string]string) (PinJob, error) {
 	if hash == "" {
-		return false, fmt.Errorf("invalid hash: %s", hash)
+		return PinJob{}, fmt.Errorf("invalid hash: %s", hash)
 	}
 
-	jsonValue, _ := json.Marshal(map[string]string{"hashToPin": hash})
+	type metadata struct {
+		Name      string            `json:"name,omitempty"`
+		KeyValues map[string]string `json:"keyvalues,omitempty"`
+	}
+	body := struct {
+		HashToPin string    `json:"hashToPin"`
+		Metadata  *metadata `json:"pinataMetadata,omitempty"`
+	}{HashToPin: hash}
+	if name != "" || len(meta) > 0 {
+		body.Metadata = &metadata{Name: name, KeyValues: meta}
+	}
+	jsonValue, _ := json.Marshal(body)
 
 	req, err := http.NewRequest(http.MethodPost, PIN_HASH_URL, bytes.NewBuffer(jsonValue))
 	if err != nil {
-		return false, err
+		return PinJob{}, err
 	}
 	req.Header.Set("Content-Type", "application/json")
 	if p.Secret != "" && p.Apikey != "" {
@@ -178,36 +241,300 @@ func (p *Pinata) PinHash(hash string) (bool, error) {
 	client := httpretry.NewClient(p.Client)
 	resp, err := client.Do(req)
 	if err != nil {
-		return false, err
+		return PinJob{}, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return false, fmt.Errorf(resp.Status)
+		return PinJob{}, httpretry.NewStatusError(resp)
 	}
 
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return false, err
+		return PinJob{}, err
 	}
 
-	var dat map[string]interface{}
-	if err := json.Unmarshal(data, &dat); err != nil {
+	// Older responses only echo the hash.
+	var out struct {
+		ID        string `json:"id"`
+		IpfsHash  string `json:"ipfsHash"`
+		HashToPin string `json:"hashToPin"`
+		Name      string `json:"name"`
+		Status    string `json:"status"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
 		if e, ok := err.(*json.SyntaxError); ok {
-			return false, fmt.Errorf("json syntax error at byte offset %d", e.Offset)
+			return PinJob{}, fmt.Errorf("json syntax error at byte offset %d", e.Offset)
 		}
+		return PinJob{}, err
+	}
+
+	job := PinJob{ID: out.ID, Cid: out.IpfsHash, Name: out.Name, Status: out.Status}
+	if job.Cid == "" {
+		job.Cid = out.HashToPin
+	}
+	if job.Cid == "" {
+		return PinJob{}, fmt.Errorf("pin hash to Pinata failed")
+	}
+	return job, nil
+}
+
+// Pinned reports whether Pinata holds a pin of hash.
+func (p *Pinata) Pinned(hash string) (bool, error) {
+	return p.pinned(context.Background(), hash)
+}
+
+func (p *Pinata) pinned(ctx context.Context, hash string) (bool, error) {
+	if hash == "" {
+		return false, fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	endpoint := fmt.Sprintf("%s?status=pinned&hashContains=%s", PIN_LIST_URL, url.QueryEscape(hash))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
 		return false, err
 	}
+	if p.Secret != "" && p.Apikey != "" {
+		req.Header.Add("pinata_secret_api_key", p.Secret)
+		req.Header.Add("pinata_api_key", p.Apikey)
+	} else {
+		req.Header.Add("Authorization", "Bearer "+p.Apikey)
+	}
 
-	if h, ok := dat["hashToPin"].(string); ok {
-		return h == hash, nil
+	client := httpretry.NewClient(p.Client)
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, httpretry.NewStatusError(resp)
+	}
+
+	var out struct {
+		Rows []struct {
+			IpfsPinHash string `json:"ipfs_pin_hash"`
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return false, fmt.Errorf("decode pin list failed: %v", err)
+	}
+	for _, row := range out.Rows {
+		if row.IpfsPinHash == hash {
+			return true, nil
+		}
 	}
 
-	return false, fmt.Errorf("pin hash to Pinata failed")
+	return false, nil
+}
+
+// Status returns pinning.Pinned if Pinata holds a pin of hash, else the
+// status of its latest pin job, empty if there is none.
+func (p *Pinata) Status(ctx context.Context, hash string) (pinning.Status, error) {
+	pinned, err := p.pinned(ctx, hash)
+	if err != nil {
+		return "", err
+	}
+	if pinned {
+		return pinning.Pinned, nil
+	}
+	jobs, err := p.pinJobs(ctx, hash)
+	if err != nil || len(jobs) == 0 {
+		return "", err
+	}
+	return jobs[len(jobs)-1].PinStatus(), nil
+}
+
+// PinJobs returns the pending pin jobs of hash, oldest first.
+func (p *Pinata) PinJobs(hash string) ([]PinJob, error) {
+	return p.pinJobs(context.Background(), hash)
+}
+
+func (p *Pinata) pinJobs(ctx context.Context, hash string) ([]PinJob, error) {
+	if hash == "" {
+		return nil, fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	endpoint := fmt.Sprintf("%s?sort=ASC&ipfs_pin_hash=%s", PIN_JOBS_URL, url.QueryEscape(hash))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.Secret != "" && p.Apikey != "" {
+		req.Header.Add("pinata_secret_api_key", p.Secret)
+		req.Header.Add("pinata_api_key", p.Apikey)
+	} else {
+		req.Header.Add("Authorization", "Bearer "+p.Apikey)
+	}
+
+	client := httpretry.NewClient(p.Client)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, httpretry.NewStatusError(resp)
+	}
+
+	var out struct {
+		Rows []PinJob
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("decode pin jobs failed: %v", err)
+	}
+	jobs := out.Rows[:0]
+	for _, job := range out.Rows {
+		if job.Cid == hash {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs, nil
+}
+
+// WaitPinned polls Pinata until hash is pinned, its pin job fails, or ctx
+// is done. A failed job is reported by an error wrapping ErrPinJobFailed,
+// and the end of ctx by an error wrapping its error, including during a
+// request.
+func (p *Pinata) WaitPinned(ctx context.Context, hash string) error {
+	status := "not queued"
+	// fail reports the end of ctx in place of the error of a request it
+	// interrupted.
+	fail := func(err error) error {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s not pinned, pin job %s: %w", hash, status, ctx.Err())
+		}
+		return err
+	}
+	for {
+		pinned, err := p.pinned(ctx, hash)
+		if err != nil {
+			return fail(err)
+		}
+		if pinned {
+			return nil
+		}
+		jobs, err := p.pinJobs(ctx, hash)
+		if err != nil {
+			return fail(err)
+		}
+		for _, job := range jobs {
+			if job.Failed() {
+				return fmt.Errorf("%s: %w: %s", hash, ErrPinJobFailed, job.Status)
+			}
+			status = job.Status
+		}
+
+		select {
+		case <-ctx.Done():
+			return fail(ctx.Err())
+		case <-time.After(pinning.PollInterval):
+		}
+	}
+}
+
+// Unpin removes the pin of hash from Pinata.
+func (p *Pinata) Unpin(hash string) error {
+	if hash == "" {
+		return fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, UNPIN_URL+"/"+url.PathEscape(hash), nil)
+	if err != nil {
+		return err
+	}
+	if p.Secret != "" && p.Apikey != "" {
+		req.Header.Add("pinata_secret_api_key", p.Secret)
+		req.Header.Add("pinata_api_key", p.Apikey)
+	} else {
+		req.Header.Add("Authorization", "Bearer "+p.Apikey)
+	}
+
+	client := httpretry.NewClient(p.Client)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpretry.NewStatusError(resp)
+	}
+
+	return nil
+}
+
+// listPageSize is the largest page of the pin list Pinata returns.
+const listPageSize = 1000
+
+// List returns the pins held by the Pinata account, page by page.
+func (p *Pinata) List() ([]pinning.Pin, error) {
+	var pins []pinning.Pin
+	for offset := 0; ; offset += listPageSize {
+		endpoint := fmt.Sprintf("%s?status=pinned&pageLimit=%d&pageOffset=%d", PIN_LIST_URL, listPageSize, offset)
+		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		if p.Secret != "" && p.Apikey != "" {
+			req.Header.Add("pinata_secret_api_key", p.Secret)
+			req.Header.Add("pinata_api_key", p.Apikey)
+		} else {
+			req.Header.Add("Authorization", "Bearer "+p.Apikey)
+		}
+
+		client := httpretry.NewClient(p.Client)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var out struct {
+			Rows []struct {
+				IpfsPinHash string    `json:"ipfs_pin_hash"`
+				Size        int64     `json:"size"`
+				DatePinned  time.Time `json:"date_pinned"`
+				Metadata    struct {
+					Name      string
+					KeyValues map[string]interface{} `json:"keyvalues"`
+				}
+			}
+		}
+		err = json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, httpretry.NewStatusError(resp)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode pin list failed: %v", err)
+		}
+
+		for _, row := range out.Rows {
+			var meta map[string]string
+			for k, v := range row.Metadata.KeyValues {
+				if meta == nil {
+					meta = make(map[string]string, len(row.Metadata.KeyValues))
+				}
+				meta[k] = fmt.Sprint(v)
+			}
+			pins = append(pins, pinning.Pin{
+				Cid:     row.IpfsPinHash,
+				Name:    row.Metadata.Name,
+				Meta:    meta,
+				Size:    row.Size,
+				Created: row.DatePinned,
+				Status:  pinning.Pinned,
+			})
+		}
+		if len(out.Rows) < listPageSize {
+			return pins, nil
+		}
+	}
 }
 
 // PinDir pins a directory to the Pinata pinning service.
 // It alias to PinFile.
-func (p *Pinata) PinDir(name string) (string, error) {
-	return p.PinFile(name)
+func (p *Pinata) PinDir(name string, opts ...file.Option) (string, error) {
+	return p.PinFile(name, opts...)
 }
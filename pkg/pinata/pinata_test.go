@@ -2,17 +2,26 @@ package pinata
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"io"
 	"io/ioutil"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"os"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/wabarc/helper"
+	"github.com/wabarc/ipfs-pinner/capability"
+	"github.com/wabarc/ipfs-pinner/file"
+	"github.com/wabarc/ipfs-pinner/pinning"
 )
 
 var (
@@ -219,3 +228,200 @@ func TestPinHash(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestPinFileWithMetadata(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "ipfs-pinner-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+
+	pinata := &Pinata{Apikey: pinataKey, Secret: pinataSec}
+	if _, err := pinata.PinFile(tmpfile.Name(), file.PreserveMtime()); !errors.Is(err, capability.ErrUnsupported) {
+		t.Fatalf("Unexpected pin with metadata: %v", err)
+	}
+}
+
+func TestPinned(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/data/pinList", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("hashContains") != "Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a" {
+			_, _ = w.Write([]byte(`{"count":0,"rows":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"count":1,"rows":[{"ipfs_pin_hash":"Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a"}]}`))
+	})
+	defer server.Close()
+
+	pinata := &Pinata{httpClient, pinataKey, pinataSec}
+	if ok, err := pinata.Pinned("Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a"); !ok || err != nil {
+		t.Errorf("Unexpected pin status %v: %v", ok, err)
+	}
+	if ok, err := pinata.Pinned("QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"); ok || err != nil {
+		t.Errorf("Unexpected pin status %v: %v", ok, err)
+	}
+}
+
+func TestUnpin(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/pinning/unpin/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.Path != "/pinning/unpin/Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`OK`))
+	})
+	defer server.Close()
+
+	pinata := &Pinata{httpClient, pinataKey, pinataSec}
+	if err := pinata.Unpin("Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a"); err != nil {
+		t.Errorf("Unexpected unpin: %v", err)
+	}
+	if err := pinata.Unpin("QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"); err == nil {
+		t.Error("Unexpected unpin of content not pinned")
+	}
+}
+
+func TestList(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/data/pinList", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("pageOffset") != "0" {
+			_, _ = w.Write([]byte(`{"count":1,"rows":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"count":1,"rows":[{"ipfs_pin_hash":"Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a","size":1234,"date_pinned":"2023-01-02T03:04:05.000Z","metadata":{"name":"site","keyvalues":{"source":"wayback","version":2}}}]}`))
+	})
+	defer server.Close()
+
+	pinata := &Pinata{httpClient, pinataKey, pinataSec}
+	pins, err := pinata.List()
+	if err != nil {
+		t.Fatalf("Unexpected list pins: %v", err)
+	}
+	if len(pins) != 1 || pins[0].Name != "site" || pins[0].Size != 1234 || pins[0].Created.Year() != 2023 {
+		t.Errorf("Unexpected pins: %+v", pins)
+	}
+	if !reflect.DeepEqual(pins[0].Meta, map[string]string{"source": "wayback", "version": "2"}) {
+		t.Errorf("Unexpected metadata: %v", pins[0].Meta)
+	}
+}
+
+func TestPinHashNamed(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/pinning/pinByHash", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			HashToPin string `json:"hashToPin"`
+			Metadata  struct {
+				Name      string            `json:"name"`
+				KeyValues map[string]string `json:"keyvalues"`
+			} `json:"pinataMetadata"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Metadata.Name != "site" || body.Metadata.KeyValues["source"] != "wayback" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"hashToPin":"` + body.HashToPin + `"}`))
+	})
+	defer server.Close()
+
+	pinata := &Pinata{httpClient, pinataKey, pinataSec}
+	ok, err := pinata.PinHashNamed("Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a", "site", map[string]string{"source": "wayback"})
+	if !ok || err != nil {
+		t.Errorf("Unexpected pin hash with a name %v: %v", ok, err)
+	}
+}
+
+func TestPinHashJob(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/pinning/pinByHash", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"id":"8c2bd5b6","ipfsHash":"Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a","status":"prechecking","name":"site"}`))
+	})
+	defer server.Close()
+
+	pinata := &Pinata{httpClient, pinataKey, pinataSec}
+	job, err := pinata.PinHashJob("Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a", "site", nil)
+	if err != nil || job.ID != "8c2bd5b6" || job.Status != "prechecking" || job.Name != "site" || job.Failed() {
+		t.Errorf("Unexpected job %+v: %v", job, err)
+	}
+	if ok, err := pinata.PinHash("Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a"); !ok || err != nil {
+		t.Errorf("Unexpected pin hash %v: %v", ok, err)
+	}
+}
+
+func TestWaitPinned(t *testing.T) {
+	defer func(d time.Duration) { pinning.PollInterval = d }(pinning.PollInterval)
+	pinning.PollInterval = time.Millisecond
+
+	const hash = "Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a"
+	var (
+		polls  int32
+		status = "retrieving"
+	)
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/data/pinList", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&polls, 1) < 3 || status != "pinned" {
+			_, _ = w.Write([]byte(`{"count":0,"rows":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"count":1,"rows":[{"ipfs_pin_hash":"` + hash + `"}]}`))
+	})
+	mux.HandleFunc("/pinning/pinJobs", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("ipfs_pin_hash") != hash || status == "pinned" {
+			_, _ = w.Write([]byte(`{"count":0,"rows":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"count":1,"rows":[{"id":"8c2bd5b6","ipfs_pin_hash":"` + hash + `","status":"` + status + `","date_queued":"2023-05-01T10:00:00.000Z"}]}`))
+	})
+	defer server.Close()
+	pinata := &Pinata{httpClient, pinataKey, pinataSec}
+
+	jobs, err := pinata.PinJobs(hash)
+	if err != nil || len(jobs) != 1 || jobs[0].ID != "8c2bd5b6" || jobs[0].Queued.IsZero() {
+		t.Errorf("Unexpected jobs %+v: %v", jobs, err)
+	}
+
+	if s, err := pinata.Status(context.Background(), hash); s != pinning.Pinning || err != nil {
+		t.Errorf("Unexpected status %q of a retrieving job: %v", s, err)
+	}
+
+	// The content is not found in time.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pinata.WaitPinned(ctx, hash); !errors.Is(err, context.DeadlineExceeded) || !strings.Contains(err.Error(), "retrieving") {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	status = "expired"
+	if err := pinata.WaitPinned(context.Background(), hash); !errors.Is(err, ErrPinJobFailed) {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if s, err := pinata.Status(context.Background(), hash); s != pinning.Failed || err != nil {
+		t.Errorf("Unexpected status %q of an expired job: %v", s, err)
+	}
+
+	status = "pinned"
+	atomic.StoreInt32(&polls, 0)
+	if err := pinata.WaitPinned(context.Background(), hash); err != nil || atomic.LoadInt32(&polls) != 3 {
+		t.Errorf("Unexpected wait of %d polls: %v", atomic.LoadInt32(&polls), err)
+	}
+}
+
+func TestWaitPinnedRetrying(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/data/pinList", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer server.Close()
+	pinata := &Pinata{httpClient, pinataKey, pinataSec}
+
+	// The deadline interrupts the backoff of the retried requests.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := pinata.WaitPinned(ctx, "Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Unexpected wait of %v past the deadline", elapsed)
+	}
+}
@@ -1,15 +1,19 @@
 package web3storage
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"mime/multipart"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/wabarc/helper"
+	"github.com/wabarc/ipfs-pinner/capability"
 	"github.com/wabarc/ipfs-pinner/file"
+	"github.com/wabarc/ipfs-pinner/pinning"
 
 	httpretry "github.com/wabarc/ipfs-pinner/http"
 )
@@ -23,17 +27,49 @@ type Web3Storage struct {
 	Apikey string
 }
 
+// Capabilities describes what Web3Storage supports.
+func (web3 *Web3Storage) Capabilities() capability.Capabilities {
+	return capability.Capabilities{
+		Directory: true,
+		CAR:       true,
+		Metadata:  true,
+		Unpin:     true,
+		Status:    true,
+		List:      true,
+
+		MaxRequestSize: capability.DotStorageRequestSize,
+		MaxTotalSize:   capability.DotStorageTotalSize,
+	}
+}
+
 type addEvent struct {
 	Cid string
 }
 
 // PinFile pins content to Web3Storage by providing a file path, it returns an IPFS
-// hash and an error.
-func (web3 *Web3Storage) PinFile(fp string) (string, error) {
-	f, err := file.NewSerialFile(fp)
+// hash and an error. The options select the entries taken from a directory.
+//
+// If the mode or the modification time is preserved, the DAG is built
+// locally and uploaded as a CAR file, since a form cannot carry them.
+func (web3 *Web3Storage) PinFile(fp string, opts ...file.Option) (string, error) {
+	f, err := file.NewSerialFile(fp, opts...)
 	if err != nil {
 		return "", err
 	}
+
+	return web3.PinNode(f)
+}
+
+// PinNode pins the entries of a Node walked by file.NewSerialFile, as
+// PinFile does, so that the walk can be reused.
+func (web3 *Web3Storage) PinNode(f *file.Node) (string, error) {
+	if f.PreserveMetadata() {
+		nd, err := f.Files()
+		if err != nil {
+			return "", err
+		}
+		return web3.PinCAR(file.NewCARReader(nd))
+	}
 	f.MapDirectory(helper.RandString(32, "lower"))
 
 	mfr, err := file.CreateMultiForm(f, true)
@@ -47,52 +83,29 @@ func (web3 *Web3Storage) PinFile(fp string) (string, error) {
 
 // PinWithReader pins content to Web3Storage by given io.Reader, it returns an IPFS hash and an error.
 func (web3 *Web3Storage) PinWithReader(rd io.Reader) (string, error) {
-	r, w := io.Pipe()
-	m := multipart.NewWriter(w)
-	fn := helper.RandString(6, "lower")
-
-	go func() {
-		defer w.Close()
-		defer m.Close()
+	fr := file.NewFormReader(helper.RandString(6, "lower"), rd)
 
-		part, err := m.CreateFormFile("file", fn)
-		if err != nil {
-			return
-		}
-
-		if _, err = io.Copy(part, rd); err != nil {
-			return
-		}
-	}()
-
-	return web3.pinFile(r, m.FormDataContentType())
+	return web3.pinFile(fr, fr.ContentType())
 }
 
 // PinWithBytes pins content to Web3Storage by given byte slice, it returns an IPFS hash and an error.
 func (web3 *Web3Storage) PinWithBytes(buf []byte) (string, error) {
-	r, w := io.Pipe()
-	m := multipart.NewWriter(w)
-	fn := helper.RandString(6, "lower")
+	fr := file.NewFormReaderWithBytes(helper.RandString(6, "lower"), buf)
 
-	go func() {
-		defer w.Close()
-		defer m.Close()
-
-		part, err := m.CreateFormFile("file", fn)
-		if err != nil {
-			return
-		}
+	return web3.pinFile(fr, fr.ContentType())
+}
 
-		if _, err = part.Write(buf); err != nil {
-			return
-		}
-	}()
+func (web3 *Web3Storage) pinFile(r io.Reader, boundary string) (string, error) {
+	return web3.post(api+"/upload", r, boundary)
+}
 
-	return web3.pinFile(r, m.FormDataContentType())
+// PinCAR pins the DAG of the CAR file read from r to Web3Storage, it
+// returns the root CID and an error.
+func (web3 *Web3Storage) PinCAR(r io.Reader) (string, error) {
+	return web3.post(api+"/car", r, "application/vnd.ipld.car")
 }
 
-func (web3 *Web3Storage) pinFile(r io.Reader, boundary string) (string, error) {
-	endpoint := api + "/upload"
+func (web3 *Web3Storage) post(endpoint string, r io.Reader, boundary string) (string, error) {
 
 	req, err := http.NewRequest(http.MethodPost, endpoint, r)
 	if err != nil {
@@ -108,7 +121,7 @@ func (web3 *Web3Storage) pinFile(r io.Reader, boundary string) (string, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf(resp.Status)
+		return "", httpretry.NewStatusError(resp)
 	}
 
 	data, err := ioutil.ReadAll(resp.Body)
@@ -130,11 +143,164 @@ func (web3 *Web3Storage) pinFile(r io.Reader, boundary string) (string, error) {
 // PinHash pins content to Web3Storage by giving an IPFS hash, it returns the result and an error.
 // Note: unsupported
 func (web3 *Web3Storage) PinHash(hash string) (bool, error) {
-	return false, fmt.Errorf("not yet supported")
+	return false, fmt.Errorf("pin hash: %w", capability.ErrUnsupported)
+}
+
+// Pinned reports whether Web3.Storage holds a pin of hash, including one still
+// queued or in progress.
+func (web3 *Web3Storage) Pinned(hash string) (bool, error) {
+	status, err := web3.Status(context.Background(), hash)
+	switch status {
+	case pinning.Queued, pinning.Pinning, pinning.Pinned:
+		return true, err
+	}
+	return false, err
+}
+
+// Status returns the most advanced status of the pins of hash on
+// Web3.Storage, empty if it holds none.
+func (web3 *Web3Storage) Status(ctx context.Context, hash string) (pinning.Status, error) {
+	if hash == "" {
+		return "", fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, api+"/status/"+url.PathEscape(hash), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Authorization", "Bearer "+web3.Apikey)
+	client := httpretry.NewClient(web3.Client)
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", httpretry.NewStatusError(resp)
+	}
+
+	var out struct {
+		Pins []struct {
+			Status string
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("decode pin status failed: %v", err)
+	}
+	var status pinning.Status
+	for _, pin := range out.Pins {
+		switch {
+		case pin.Status == "Pinned":
+			return pinning.Pinned, nil
+		case pin.Status == "Pinning":
+			status = pinning.Pinning
+		case pin.Status == "PinQueued" && status != pinning.Pinning:
+			status = pinning.Queued
+		case pin.Status == "PinError" && status == "":
+			status = pinning.Failed
+		}
+	}
+
+	return status, nil
+}
+
+// Unpin removes the upload of hash from the Web3.Storage account.
+func (web3 *Web3Storage) Unpin(hash string) error {
+	if hash == "" {
+		return fmt.Errorf("invalid hash: %s", hash)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, api+"/user/uploads/"+url.PathEscape(hash), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("Authorization", "Bearer "+web3.Apikey)
+	client := httpretry.NewClient(web3.Client)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return httpretry.NewStatusError(resp)
+	}
+
+	return nil
+}
+
+// listPageSize is the largest page of uploads Web3.Storage returns.
+const listPageSize = 1000
+
+// List returns the uploads of the Web3.Storage account, newest first.
+func (web3 *Web3Storage) List() ([]pinning.Pin, error) {
+	var pins []pinning.Pin
+	before := time.Now().UTC()
+	for {
+		endpoint := fmt.Sprintf("%s/user/uploads?size=%d&before=%s", api, listPageSize, url.QueryEscape(before.Format(time.RFC3339Nano)))
+		req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Authorization", "Bearer "+web3.Apikey)
+		client := httpretry.NewClient(web3.Client)
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		var out []struct {
+			Cid     string
+			Name    string
+			Created time.Time
+			DagSize int64
+			Pins    []struct {
+				Status string
+			}
+		}
+		err = json.NewDecoder(resp.Body).Decode(&out)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, httpretry.NewStatusError(resp)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode upload list failed: %v", err)
+		}
+
+		for _, v := range out {
+			// The upload takes the most advanced status of its pins.
+			status := pinning.Failed
+			for _, pin := range v.Pins {
+				switch {
+				case pin.Status == "Pinned":
+					status = pinning.Pinned
+				case pin.Status == "Pinning" && status != pinning.Pinned:
+					status = pinning.Pinning
+				case pin.Status == "PinQueued" && status == pinning.Failed:
+					status = pinning.Queued
+				}
+			}
+			pins = append(pins, pinning.Pin{
+				Cid:     v.Cid,
+				Name:    v.Name,
+				Size:    v.DagSize,
+				Created: v.Created,
+				Status:  status,
+			})
+		}
+		if len(out) < listPageSize {
+			return pins, nil
+		}
+		before = out[len(out)-1].Created
+	}
 }
 
 // PinDir pins a directory to the Pinata pinning service.
 // It alias to PinFile.
-func (web3 *Web3Storage) PinDir(name string) (string, error) {
-	return web3.PinFile(name)
+func (web3 *Web3Storage) PinDir(name string, opts ...file.Option) (string, error) {
+	return web3.PinFile(name, opts...)
 }
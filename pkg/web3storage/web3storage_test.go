@@ -8,11 +8,14 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/ipfs/go-cid"
 	"github.com/wabarc/helper"
+	"github.com/wabarc/ipfs-pinner/file"
+	"github.com/wabarc/ipfs-pinner/unixfs"
 )
 
 var (
@@ -192,3 +195,103 @@ func TestPinHash(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestPinFileWithMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfs-pinner-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o640); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := []file.Option{file.PreserveMode(), file.PreserveMtime()}
+	node, err := file.NewSerialFile(dir, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nd, err := node.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := unixfs.Sum(nd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/car" || r.Header.Get("Content-Type") != "application/vnd.ipld.car" {
+			t.Errorf("Unexpected upload to %s as %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if !bytes.Contains(body, root.Bytes()) {
+			t.Errorf("Unexpected car without the root %s", root)
+		}
+		_, _ = w.Write([]byte(uploadJSON))
+	})
+	defer server.Close()
+
+	web3 := &Web3Storage{httpClient, "fake-api-key"}
+	if _, err := web3.PinFile(dir, opts...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPinned(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/status/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status/bafkreidivzimqfqtoqxkrpge6bjyhlvxqs3rhe73owtmdulaxr5do5in7u" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"cid":"x","pins":[{"status":"Pinned"}]}`))
+	})
+	defer server.Close()
+
+	pinner := &Web3Storage{httpClient, "fake-api-key"}
+	if ok, err := pinner.Pinned("bafkreidivzimqfqtoqxkrpge6bjyhlvxqs3rhe73owtmdulaxr5do5in7u"); !ok || err != nil {
+		t.Errorf("Unexpected pin status %v: %v", ok, err)
+	}
+	if ok, err := pinner.Pinned("QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"); ok || err != nil {
+		t.Errorf("Unexpected pin status %v: %v", ok, err)
+	}
+}
+
+func TestUnpin(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/user/uploads/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.URL.Path != "/user/uploads/bafkreidivzimqfqtoqxkrpge6bjyhlvxqs3rhe73owtmdulaxr5do5in7u" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	})
+	defer server.Close()
+
+	pinner := &Web3Storage{httpClient, "fake-api-key"}
+	if err := pinner.Unpin("bafkreidivzimqfqtoqxkrpge6bjyhlvxqs3rhe73owtmdulaxr5do5in7u"); err != nil {
+		t.Errorf("Unexpected unpin: %v", err)
+	}
+	if err := pinner.Unpin("QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"); err == nil {
+		t.Error("Unexpected unpin of content not uploaded")
+	}
+}
+
+func TestList(t *testing.T) {
+	httpClient, mux, server := helper.MockServer()
+	mux.HandleFunc("/user/uploads", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`[{"cid":"bafkreidivzimqfqtoqxkrpge6bjyhlvxqs3rhe73owtmdulaxr5do5in7u","name":"hello","created":"2023-01-02T03:04:05.000Z","dagSize":5,"pins":[{"status":"PinQueued"},{"status":"Pinned"}]}]`))
+	})
+	defer server.Close()
+
+	pinner := &Web3Storage{httpClient, "fake-api-key"}
+	pins, err := pinner.List()
+	if err != nil {
+		t.Fatalf("Unexpected list pins: %v", err)
+	}
+	if len(pins) != 1 || pins[0].Name != "hello" || pins[0].Status != "pinned" || pins[0].Size != 5 {
+		t.Errorf("Unexpected pins: %+v", pins)
+	}
+}
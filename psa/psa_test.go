@@ -0,0 +1,293 @@
+package psa
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wabarc/helper"
+	"github.com/wabarc/ipfs-pinner/pinning"
+
+	pinner "github.com/wabarc/ipfs-pinner"
+)
+
+const (
+	cidA = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+	cidB = "QmTBpqbvJLZaq3hTMUhxX5hyJaSCeWe6Q5FRctQbsD6EsE"
+	cidC = "Qmaisz6NMhDB51cCvNWa1GMS7LU1pAxdF4Ld6Ft9kZEP2a"
+)
+
+// upstream mocks the Infura API, failing the pins of cidC and recording
+// the unpinned CIDs.
+func upstream(t *testing.T) (*pinner.Config, func() []string) {
+	client, mux, server := helper.MockServer()
+	t.Cleanup(server.Close)
+
+	var (
+		mu       sync.Mutex
+		unpinned []string
+	)
+	mux.HandleFunc("/api/v0/pin/add", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("arg") == cidC {
+			http.Error(w, `{"Message":"not found","Code":0}`, http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`{"Pins":["` + r.URL.Query().Get("arg") + `"]}`))
+	})
+	mux.HandleFunc("/api/v0/pin/rm", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		unpinned = append(unpinned, r.URL.Query().Get("arg"))
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"Pins":["` + r.URL.Query().Get("arg") + `"]}`))
+	})
+
+	cfg := &pinner.Config{Pinner: pinner.Infura, Apikey: "apikey-apikey", Secret: "secret"}
+	return cfg.WithClient(client), func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), unpinned...)
+	}
+}
+
+func call(t *testing.T, s *Server, method, path, body string, out interface{}) int {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer token")
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("Unexpected response %q to %s %s: %v", rec.Body, method, path, err)
+		}
+	}
+	return rec.Code
+}
+
+func TestServer(t *testing.T) {
+	cfg, unpinned := upstream(t)
+	store, err := Open(filepath.Join(t.TempDir(), "pins.jsonl"))
+	if err != nil {
+		t.Fatalf("Unexpected open store: %v", err)
+	}
+	defer store.Close()
+	s := &Server{Config: cfg, Store: store, Token: "token", Delegates: []string{"/dnsaddr/node.example"}}
+
+	var a, c pinStatus
+	if code := call(t, s, http.MethodPost, "/pins", `{"cid":"`+cidA+`","name":"site.warc","meta":{"app":"wayback"}}`, &a); code != http.StatusAccepted || a.Status != pinning.Queued || a.RequestID == "" || len(a.Delegates) != 1 {
+		t.Fatalf("Unexpected create %d %+v", code, a)
+	}
+	if code := call(t, s, http.MethodPost, "/pins", `{"cid":"`+cidC+`"}`, &c); code != http.StatusAccepted {
+		t.Fatalf("Unexpected create %d %+v", code, c)
+	}
+	s.Wait()
+
+	if code := call(t, s, http.MethodGet, "/pins/"+a.RequestID, "", &a); code != http.StatusOK || a.Status != pinning.Pinned {
+		t.Errorf("Unexpected get %d %+v", code, a)
+	}
+	if call(t, s, http.MethodGet, "/pins/"+c.RequestID, "", &c); c.Status != pinning.Failed || c.Info["status_details"] == "" {
+		t.Errorf("Unexpected failed request %+v", c)
+	}
+
+	var list struct {
+		Count   int         `json:"count"`
+		Results []pinStatus `json:"results"`
+	}
+	tests := map[string]int{
+		"/pins":                                 1,
+		"/pins?status=pinned,failed":            2,
+		"/pins?status=failed&cid=" + cidA:       0,
+		"/pins?name=SITE&match=ipartial":        1,
+		"/pins?name=site&match=exact":           0,
+		`/pins?meta={"app":"wayback"}`:          1,
+		"/pins?status=pinned,failed&limit=1":    2,
+		"/pins?before=2000-01-01T00:00:00Z":     0,
+		"/pins?cid=" + cidA + "," + cidB:        1,
+		"/pins?status=queued,pinning,pinned":    1,
+		"/pins?after=2000-01-01T00:00:00Z&cid=": 1,
+	}
+	for query, count := range tests {
+		if code := call(t, s, http.MethodGet, query, "", &list); code != http.StatusOK || list.Count != count {
+			t.Errorf("Unexpected list %s, %d with %d results instead of %d", query, code, list.Count, count)
+		}
+	}
+	if call(t, s, http.MethodGet, "/pins?status=pinned,failed&limit=1", "", &list); len(list.Results) != 1 {
+		t.Errorf("Unexpected results beyond the limit %+v", list.Results)
+	}
+
+	// Replacing a request unpins its CID once the new one is pinned.
+	var b pinStatus
+	if code := call(t, s, http.MethodPost, "/pins/"+a.RequestID, `{"cid":"`+cidB+`"}`, &b); code != http.StatusAccepted || b.RequestID == a.RequestID {
+		t.Fatalf("Unexpected replace %d %+v", code, b)
+	}
+	s.Wait()
+	if code := call(t, s, http.MethodGet, "/pins/"+a.RequestID, "", nil); code != http.StatusNotFound {
+		t.Errorf("Unexpected status %d of a replaced request", code)
+	}
+	if got := unpinned(); len(got) != 1 || got[0] != cidA {
+		t.Errorf("Unexpected unpinned %v", got)
+	}
+
+	if code := call(t, s, http.MethodDelete, "/pins/"+b.RequestID, "", nil); code != http.StatusAccepted {
+		t.Errorf("Unexpected delete %d", code)
+	}
+	s.Wait()
+	if got := unpinned(); len(got) != 2 || got[1] != cidB {
+		t.Errorf("Unexpected unpinned %v", got)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	cfg, _ := upstream(t)
+	store, err := Open(filepath.Join(t.TempDir(), "pins.jsonl"))
+	if err != nil {
+		t.Fatalf("Unexpected open store: %v", err)
+	}
+	defer store.Close()
+	s := &Server{Config: cfg, Store: store, Token: "token"}
+
+	tests := []struct {
+		method, path, body string
+		code               int
+	}{
+		{http.MethodPost, "/pins", `{"cid":"nope"}`, http.StatusBadRequest},
+		{http.MethodPost, "/pins", `nope`, http.StatusBadRequest},
+		{http.MethodGet, "/pins/missing", "", http.StatusNotFound},
+		{http.MethodGet, "/pins?status=done", "", http.StatusBadRequest},
+		{http.MethodGet, "/pins?limit=1001", "", http.StatusBadRequest},
+		{http.MethodGet, "/pins?match=fuzzy", "", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		var res struct {
+			Error apiError `json:"error"`
+		}
+		if code := call(t, s, test.method, test.path, test.body, &res); code != test.code || res.Error.Reason == "" {
+			t.Errorf("Unexpected response %d %+v to %s %s", code, res, test.method, test.path)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/pins", nil)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Unexpected status %d without token", rec.Code)
+	}
+}
+
+func TestStoreResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pins.jsonl")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected open store: %v", err)
+	}
+	for _, r := range []Request{{ID: "a", Status: pinning.Pinning, Pin: Pin{Cid: cidA}}, {ID: "b", Status: pinning.Queued, Pin: Pin{Cid: cidB}}, {ID: "c", Status: pinning.Queued, Pin: Pin{Cid: cidC}}} {
+		if err := store.Put(r); err != nil {
+			t.Fatalf("Unexpected put: %v", err)
+		}
+	}
+	if err := store.Delete("c"); err != nil {
+		t.Fatalf("Unexpected delete: %v", err)
+	}
+	store.Close()
+
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected reopen store: %v", err)
+	}
+	defer store.Close()
+	if n := len(store.Requests()); n != 2 {
+		t.Fatalf("Unexpected %d requests", n)
+	}
+
+	cfg, _ := upstream(t)
+	s := &Server{Config: cfg, Store: store}
+	s.Resume()
+	s.Wait()
+	for _, id := range []string{"a", "b"} {
+		if r, _ := store.Get(id); r.Status != pinning.Pinned {
+			t.Errorf("Unexpected resumed request %+v", r)
+		}
+	}
+}
+
+func TestServerQueuedPin(t *testing.T) {
+	defer func(d time.Duration) { pinning.PollInterval = d }(pinning.PollInterval)
+	pinning.PollInterval = time.Millisecond
+
+	// Pinata queues a job searching the content, pinned once found, and
+	// expires the jobs of cidC.
+	var found int32
+	names := make(chan string, 2)
+	client, mux, server := helper.MockServer()
+	t.Cleanup(server.Close)
+	mux.HandleFunc("/pinning/pinByHash", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			HashToPin      string `json:"hashToPin"`
+			PinataMetadata struct {
+				Name      string            `json:"name"`
+				KeyValues map[string]string `json:"keyvalues"`
+			} `json:"pinataMetadata"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		names <- body.PinataMetadata.Name + " " + body.PinataMetadata.KeyValues["app"]
+		_, _ = w.Write([]byte(`{"id":"8c2bd5b6","ipfsHash":"` + body.HashToPin + `","status":"prechecking"}`))
+	})
+	mux.HandleFunc("/data/pinList", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&found) == 0 || !strings.Contains(r.URL.RawQuery, cidA) {
+			_, _ = w.Write([]byte(`{"count":0,"rows":[]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"count":1,"rows":[{"ipfs_pin_hash":"` + cidA + `"}]}`))
+	})
+	mux.HandleFunc("/pinning/pinJobs", func(w http.ResponseWriter, r *http.Request) {
+		hash, status := r.URL.Query().Get("ipfs_pin_hash"), "searching"
+		if hash == cidC {
+			status = "expired"
+		}
+		_, _ = w.Write([]byte(`{"count":1,"rows":[{"id":"8c2bd5b6","ipfs_pin_hash":"` + hash + `","status":"` + status + `"}]}`))
+	})
+	cfg := (&pinner.Config{Pinner: pinner.Pinata, Apikey: "apikey", Secret: "secret"}).WithClient(client)
+
+	store, err := Open(filepath.Join(t.TempDir(), "pins.jsonl"))
+	if err != nil {
+		t.Fatalf("Unexpected open store: %v", err)
+	}
+	defer store.Close()
+	s := &Server{Config: cfg, Store: store, Token: "token"}
+
+	var a, c pinStatus
+	call(t, s, http.MethodPost, "/pins", `{"cid":"`+cidA+`","name":"site.warc","meta":{"app":"wayback"}}`, &a)
+	if got := <-names; got != "site.warc wayback" {
+		t.Errorf("Unexpected name and meta %q given to the pinner", got)
+	}
+	call(t, s, http.MethodPost, "/pins", `{"cid":"`+cidC+`"}`, &c)
+	<-names
+
+	// The request is pinning while the job searches the content.
+	time.Sleep(20 * time.Millisecond)
+	if call(t, s, http.MethodGet, "/pins/"+a.RequestID, "", &a); a.Status != pinning.Pinning {
+		t.Errorf("Unexpected status of a queued job %+v", a)
+	}
+	atomic.StoreInt32(&found, 1)
+	s.Wait()
+	if call(t, s, http.MethodGet, "/pins/"+a.RequestID, "", &a); a.Status != pinning.Pinned {
+		t.Errorf("Unexpected status of a found pin %+v", a)
+	}
+	if call(t, s, http.MethodGet, "/pins/"+c.RequestID, "", &c); c.Status != pinning.Failed || c.Info["status_details"] == "" {
+		t.Errorf("Unexpected status of an expired job %+v", c)
+	}
+
+	// A request still pinning on shutdown is left pinning, to resume.
+	atomic.StoreInt32(&found, 0)
+	var b pinStatus
+	call(t, s, http.MethodPost, "/pins", `{"cid":"`+cidB+`"}`, &b)
+	<-names
+	s.Shutdown()
+	if r, _ := store.Get(b.RequestID); r.Status != pinning.Pinning {
+		t.Errorf("Unexpected request after shutdown %+v", r)
+	}
+}
@@ -0,0 +1,446 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package psa serves the IPFS Pinning Services API on top of any pinner
+supporting pins by CID, so that tools speaking the API, such as
+`ipfs pin remote`, can use pinners without a native implementation.
+
+Pin requests are tracked in a local store, and pinned in the background:
+a request is queued when created, pinning while the pinner is asked to
+pin its CID and until it reports the pin done, then pinned or failed.
+Requests left queued or pinning by a stopped server are resumed when it
+starts again.
+
+See https://ipfs.github.io/pinning-services-api-spec/.
+*/
+package psa // import "github.com/wabarc/ipfs-pinner/psa"
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/wabarc/ipfs-pinner/pinning"
+
+	pinner "github.com/wabarc/ipfs-pinner"
+)
+
+// DefaultJobs is the number of requests pinned at once by default.
+const DefaultJobs = 4
+
+// DefaultPinTimeout is the time given to the pinner to pin a request by
+// default.
+const DefaultPinTimeout = 24 * time.Hour
+
+// Limits of the API.
+const (
+	defaultLimit = 10
+	maxLimit     = 1000
+	maxCids      = 10
+)
+
+// Server is an http.Handler serving the /pins endpoints of the API.
+type Server struct {
+	Config *pinner.Config
+	Store  *Store
+	// Token, if set, is the bearer token required by every request.
+	Token string
+	// Delegates are the multiaddrs of the IPFS nodes of the pinner, given
+	// to clients to connect to.
+	Delegates []string
+	// Jobs is the number of requests pinned at once. Zero means
+	// DefaultJobs.
+	Jobs int
+	// PinTimeout is the time given to the pinner to report a request
+	// pinned once asked to pin it, the request fails past it. Zero means
+	// DefaultPinTimeout.
+	PinTimeout time.Duration
+	// Logf, if set, is called with a line for every failure of the pinner.
+	Logf func(format string, a ...interface{})
+
+	once   sync.Once
+	slots  chan struct{}
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// pinStatus is a request in the form of the API.
+type pinStatus struct {
+	RequestID string            `json:"requestid"`
+	Status    pinning.Status    `json:"status"`
+	Created   time.Time         `json:"created"`
+	Pin       Pin               `json:"pin"`
+	Delegates []string          `json:"delegates"`
+	Info      map[string]string `json:"info,omitempty"`
+}
+
+func (s *Server) status(r Request) pinStatus {
+	ps := pinStatus{RequestID: r.ID, Status: r.Status, Created: r.Created, Pin: r.Pin, Delegates: s.Delegates}
+	if ps.Delegates == nil {
+		ps.Delegates = []string{}
+	}
+	if r.Error != "" {
+		ps.Info = map[string]string{"status_details": r.Error}
+	}
+	return ps
+}
+
+func (s *Server) init() {
+	jobs := s.Jobs
+	if jobs <= 0 {
+		jobs = DefaultJobs
+	}
+	s.slots = make(chan struct{}, jobs)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+}
+
+// Resume pins the requests of the store left queued or pinning.
+func (s *Server) Resume() {
+	s.once.Do(s.init)
+	for _, r := range s.Store.Requests() {
+		if r.Status == pinning.Queued || r.Status == pinning.Pinning {
+			s.enqueue(r.ID)
+		}
+	}
+}
+
+// Wait waits for the requests being pinned.
+func (s *Server) Wait() {
+	s.wg.Wait()
+}
+
+// Shutdown stops pinning requests and waits for the ones being pinned.
+// The requests left queued or pinning are resumed by the next Resume.
+func (s *Server) Shutdown() {
+	s.once.Do(s.init)
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *Server) enqueue(id string) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.process(id)
+	}()
+}
+
+// process pins the CID of a request, waits for the pinner to report the
+// pin done, and unpins the CID it replaces once pinned. The pinner is
+// asked to pin at most Jobs CIDs at once, the waits do not count.
+func (s *Server) process(id string) {
+	s.slots <- struct{}{}
+	if s.ctx.Err() != nil {
+		<-s.slots
+		return
+	}
+	r, ok, err := s.Store.Update(id, func(r *Request) { r.Status = pinning.Pinning })
+	if err != nil {
+		s.logf("request %s: %v", id, err)
+	}
+	if !ok || err != nil {
+		<-s.slots
+		return
+	}
+
+	c := r.Pin.Cid
+	_, status, err := s.Config.PinHashStatus(c, r.Pin.Name, r.Pin.Meta)
+	<-s.slots
+	if err == nil && status != pinning.Pinned {
+		timeout := s.PinTimeout
+		if timeout <= 0 {
+			timeout = DefaultPinTimeout
+		}
+		ctx, cancel := context.WithTimeout(s.ctx, timeout)
+		err = s.Config.WaitPinned(ctx, c)
+		cancel()
+		if s.ctx.Err() != nil {
+			// Left pinning, to resume.
+			return
+		}
+	}
+	r, ok, uerr := s.Store.Update(id, func(r *Request) {
+		r.Status, r.Error = pinning.Pinned, ""
+		if err != nil {
+			r.Status, r.Error = pinning.Failed, err.Error()
+		}
+	})
+	switch {
+	case uerr != nil:
+		s.logf("request %s: %v", id, uerr)
+	case err != nil:
+		s.logf("request %s: pin %s: %v", id, c, err)
+	case !ok:
+		// Deleted while pinning.
+		s.unpin(c)
+	case r.Replaces != "" && r.Replaces != r.Pin.Cid:
+		s.unpin(r.Replaces)
+	}
+}
+
+// unpin unpins cid unless another request holds it.
+func (s *Server) unpin(c string) {
+	for _, r := range s.Store.Requests() {
+		if r.Pin.Cid == c {
+			return
+		}
+	}
+	if err := s.Config.Unpin(c); err != nil {
+		s.logf("unpin %s: %v", c, err)
+	}
+}
+
+func (s *Server) logf(format string, a ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, a...)
+	}
+}
+
+// apiError is an error response of the API.
+type apiError struct {
+	status  int
+	Reason  string `json:"reason"`
+	Details string `json:"details,omitempty"`
+}
+
+func failure(status int, reason, format string, a ...interface{}) *apiError {
+	return &apiError{status: status, Reason: reason, Details: fmt.Sprintf(format, a...)}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.once.Do(s.init)
+
+	status, body, err := s.serve(r)
+	if err != nil {
+		status, body = err.status, struct {
+			Error *apiError `json:"error"`
+		}{err}
+	}
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="ipfs-pinner"`)
+	}
+	if body == nil {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func (s *Server) serve(r *http.Request) (int, interface{}, *apiError) {
+	if !s.authorized(r) {
+		return 0, nil, failure(http.StatusUnauthorized, "UNAUTHORIZED", "missing or invalid bearer token")
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	switch {
+	case path == "pins" && r.Method == http.MethodGet:
+		return s.list(r)
+	case path == "pins" && r.Method == http.MethodPost:
+		return s.create(r, "")
+	case strings.HasPrefix(path, "pins/") && !strings.Contains(path[len("pins/"):], "/"):
+		id := path[len("pins/"):]
+		req, ok := s.Store.Get(id)
+		if !ok {
+			return 0, nil, failure(http.StatusNotFound, "NOT_FOUND", "request %s not found", id)
+		}
+		switch r.Method {
+		case http.MethodGet:
+			return http.StatusOK, s.status(req), nil
+		case http.MethodPost:
+			return s.create(r, id)
+		case http.MethodDelete:
+			if err := s.Store.Delete(id); err != nil {
+				return 0, nil, failure(http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", "%v", err)
+			}
+			// A request being pinned is unpinned once done.
+			if req.Status == pinning.Pinned {
+				s.wg.Add(1)
+				go func() {
+					defer s.wg.Done()
+					s.unpin(req.Pin.Cid)
+				}()
+			}
+			return http.StatusAccepted, nil, nil
+		}
+		return 0, nil, failure(http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "%s %s", r.Method, r.URL.Path)
+	}
+	return 0, nil, failure(http.StatusNotFound, "NOT_FOUND", "%s not found", r.URL.Path)
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(s.Token)) == 1
+}
+
+// create records a pin request, replacing the request of the given ID if
+// not empty, and queues it.
+func (s *Server) create(r *http.Request, replace string) (int, interface{}, *apiError) {
+	var pin Pin
+	if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20)).Decode(&pin); err != nil {
+		return 0, nil, failure(http.StatusBadRequest, "BAD_REQUEST", "invalid pin: %v", err)
+	}
+	if _, err := cid.Parse(pin.Cid); err != nil {
+		return 0, nil, failure(http.StatusBadRequest, "BAD_REQUEST", "invalid cid %q", pin.Cid)
+	}
+	if caps, err := s.Config.Capabilities(); err != nil || !caps.PinHash {
+		return 0, nil, failure(http.StatusBadRequest, "UNSUPPORTED_PINNER", "%s cannot pin by CID", s.Config.Pinner)
+	}
+
+	req := Request{ID: newID(), Status: pinning.Queued, Created: time.Now().UTC(), Pin: pin}
+	if replace != "" {
+		old, ok := s.Store.Get(replace)
+		if !ok {
+			return 0, nil, failure(http.StatusNotFound, "NOT_FOUND", "request %s not found", replace)
+		}
+		req.Replaces = old.Pin.Cid
+		if err := s.Store.Delete(replace); err != nil {
+			return 0, nil, failure(http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", "%v", err)
+		}
+	}
+	if err := s.Store.Put(req); err != nil {
+		return 0, nil, failure(http.StatusInternalServerError, "INTERNAL_SERVER_ERROR", "%v", err)
+	}
+	s.enqueue(req.ID)
+
+	return http.StatusAccepted, s.status(req), nil
+}
+
+// list returns the requests matching the filters of the query, by default
+// the pinned ones.
+func (s *Server) list(r *http.Request) (int, interface{}, *apiError) {
+	q := r.URL.Query()
+	var (
+		cids     map[string]bool
+		statuses = map[pinning.Status]bool{pinning.Pinned: true}
+		before   time.Time
+		after    time.Time
+		meta     map[string]string
+		limit    = defaultLimit
+	)
+	if v := q.Get("cid"); v != "" {
+		list := strings.Split(v, ",")
+		if len(list) > maxCids {
+			return 0, nil, failure(http.StatusBadRequest, "BAD_REQUEST", "more than %d cids", maxCids)
+		}
+		cids = make(map[string]bool, len(list))
+		for _, c := range list {
+			cids[c] = true
+		}
+	}
+	if v := q.Get("status"); v != "" {
+		statuses = make(map[pinning.Status]bool)
+		for _, st := range strings.Split(v, ",") {
+			switch status := pinning.Status(st); status {
+			case pinning.Queued, pinning.Pinning, pinning.Pinned, pinning.Failed:
+				statuses[status] = true
+			default:
+				return 0, nil, failure(http.StatusBadRequest, "BAD_REQUEST", "invalid status %q", st)
+			}
+		}
+	}
+	for name, t := range map[string]*time.Time{"before": &before, "after": &after} {
+		if v := q.Get(name); v != "" {
+			var err error
+			if *t, err = time.Parse(time.RFC3339Nano, v); err != nil {
+				return 0, nil, failure(http.StatusBadRequest, "BAD_REQUEST", "invalid %s %q", name, v)
+			}
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLimit {
+			return 0, nil, failure(http.StatusBadRequest, "BAD_REQUEST", "invalid limit %q", v)
+		}
+		limit = n
+	}
+	if v := q.Get("meta"); v != "" {
+		if err := json.Unmarshal([]byte(v), &meta); err != nil {
+			return 0, nil, failure(http.StatusBadRequest, "BAD_REQUEST", "invalid meta: %v", err)
+		}
+	}
+	name, match := q.Get("name"), q.Get("match")
+	if match == "" {
+		match = "exact"
+	}
+	nameMatches, ok := matcher(match, name)
+	if !ok {
+		return 0, nil, failure(http.StatusBadRequest, "BAD_REQUEST", "invalid match %q", match)
+	}
+
+	results := []pinStatus{}
+	count := 0
+	for _, req := range s.Store.Requests() {
+		switch {
+		case cids != nil && !cids[req.Pin.Cid],
+			!statuses[req.Status],
+			!before.IsZero() && !req.Created.Before(before),
+			!after.IsZero() && !req.Created.After(after),
+			name != "" && !nameMatches(req.Pin.Name),
+			!hasMeta(req.Pin.Meta, meta):
+			continue
+		}
+		count++
+		if len(results) < limit {
+			results = append(results, s.status(req))
+		}
+	}
+
+	return http.StatusOK, struct {
+		Count   int         `json:"count"`
+		Results []pinStatus `json:"results"`
+	}{count, results}, nil
+}
+
+// matcher returns the function matching names with the text matching
+// strategy of the API.
+func matcher(match, name string) (func(string) bool, bool) {
+	switch match {
+	case "exact":
+		return func(s string) bool { return s == name }, true
+	case "iexact":
+		return func(s string) bool { return strings.EqualFold(s, name) }, true
+	case "partial":
+		return func(s string) bool { return strings.Contains(s, name) }, true
+	case "ipartial":
+		lower := strings.ToLower(name)
+		return func(s string) bool { return strings.Contains(strings.ToLower(s), lower) }, true
+	}
+	return nil, false
+}
+
+func hasMeta(meta, want map[string]string) bool {
+	for k, v := range want {
+		if meta[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,242 @@
+package psa
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wabarc/ipfs-pinner/pinning"
+)
+
+// Pin is the object of a pin request.
+type Pin struct {
+	Cid     string            `json:"cid"`
+	Name    string            `json:"name,omitempty"`
+	Origins []string          `json:"origins,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// Request is a pin request tracked by the store.
+type Request struct {
+	ID      string         `json:"requestid"`
+	Status  pinning.Status `json:"status"`
+	Created time.Time      `json:"created"`
+	Pin     Pin            `json:"pin"`
+	// Error is why the request failed.
+	Error string `json:"error,omitempty"`
+	// Replaces is the CID of the request this one replaced, unpinned once
+	// this one is pinned.
+	Replaces string `json:"replaces,omitempty"`
+
+	// Deleted marks a removed request in the file.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+// Store is a local store of pin requests, safe for concurrent use. It is
+// an append-only file of JSON lines, loaded in memory when opened, where a
+// later line replaces an earlier one with the same ID.
+type Store struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	requests map[string]Request
+	// lines is the number of lines of the file.
+	lines int
+}
+
+// Open opens the store at path, creating it if it does not exist.
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, requests: make(map[string]Request)}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	// Rewrite the file once it holds more replaced lines than requests.
+	if s.lines > 2*len(s.requests)+64 {
+		if err := s.compact(); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open store failed: %w", err)
+	}
+	s.file = f
+
+	return s, nil
+}
+
+func (s *Store) load() error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open store failed: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 4096), 1<<20)
+	for sc.Scan() {
+		s.lines++
+		var r Request
+		// A line left incomplete by an interrupted write is skipped.
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			continue
+		}
+		if r.Deleted {
+			delete(s.requests, r.ID)
+			continue
+		}
+		s.requests[r.ID] = r
+	}
+	if err := sc.Err(); err != nil {
+		return fmt.Errorf("read store failed: %w", err)
+	}
+
+	return nil
+}
+
+// compact rewrites the file with the current requests only.
+func (s *Store) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return fmt.Errorf("compact store failed: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, r := range s.requests {
+		if err := enc.Encode(r); err != nil {
+			tmp.Close()
+			return fmt.Errorf("compact store failed: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("compact store failed: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("compact store failed: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("compact store failed: %w", err)
+	}
+	s.lines = len(s.requests)
+
+	return nil
+}
+
+// Get returns the request of the given ID.
+func (s *Store) Get(id string) (Request, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.requests[id]
+	return r, ok
+}
+
+// Put records r, replacing the request with the same ID.
+func (s *Store) Put(r Request) error {
+	r.Deleted = false
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(r); err != nil {
+		return err
+	}
+	s.requests[r.ID] = r
+
+	return nil
+}
+
+// Update calls fn with the request of the given ID, and records it as
+// changed by fn. It reports whether the request exists.
+func (s *Store) Update(id string, fn func(r *Request)) (Request, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.requests[id]
+	if !ok {
+		return Request{}, false, nil
+	}
+	fn(&r)
+	if err := s.append(r); err != nil {
+		return Request{}, true, err
+	}
+	s.requests[id] = r
+
+	return r, true, nil
+}
+
+// Delete removes the request of the given ID.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.requests[id]; !ok {
+		return nil
+	}
+	if err := s.append(Request{ID: id, Deleted: true}); err != nil {
+		return err
+	}
+	delete(s.requests, id)
+
+	return nil
+}
+
+// Requests returns the requests, newest first.
+func (s *Store) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests := make([]Request, 0, len(s.requests))
+	for _, r := range s.requests {
+		requests = append(requests, r)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if !requests[i].Created.Equal(requests[j].Created) {
+			return requests[i].Created.After(requests[j].Created)
+		}
+		return requests[i].ID < requests[j].ID
+	})
+	return requests
+}
+
+func (s *Store) append(r Request) error {
+	if s.file == nil {
+		return fmt.Errorf("store is closed")
+	}
+	buf, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	// A single write of a whole line keeps lines from interleaving.
+	if _, err := s.file.Write(append(buf, '\n')); err != nil {
+		return fmt.Errorf("write store failed: %w", err)
+	}
+	s.lines++
+
+	return nil
+}
+
+// Close closes the store file.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
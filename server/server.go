@@ -0,0 +1,261 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package server exposes a pinner as a REST service, for programs which
+cannot use the Go package:
+
+	POST   /pin          pins the body, a multipart form file or raw content
+	POST   /pin/{cid}    pins content already on IPFS by its CID
+	DELETE /pin/{cid}    removes a pin
+	GET    /status/{cid} tells whether the pinner holds a pin
+
+Responses are JSON objects, with an error member on failure. Uploads are
+streamed to the pinner as they are received, without being buffered, so a
+failed upload is not retried: the body cannot be read again.
+*/
+package server // import "github.com/wabarc/ipfs-pinner/server"
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/wabarc/ipfs-pinner/capability"
+	"github.com/wabarc/ipfs-pinner/file"
+
+	pinner "github.com/wabarc/ipfs-pinner"
+	httpretry "github.com/wabarc/ipfs-pinner/http"
+)
+
+// Server is an http.Handler serving the pinner of Config.
+type Server struct {
+	Config *pinner.Config
+	// Token, if set, is the bearer token required by every request.
+	Token string
+	// MaxBodySize, if positive, is the maximum size of the body of an
+	// upload in bytes, including the encoding of a multipart form.
+	MaxBodySize int64
+	// Logf, if set, is called with a line for every request.
+	Logf func(format string, a ...interface{})
+}
+
+// Response is the body of a response.
+type Response struct {
+	Cid      string `json:"cid,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	// Pinned is set by status requests.
+	Pinned *bool  `json:"pinned,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// statusWriter records the status of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	res, status := s.serve(r)
+	if s.Logf != nil {
+		defer func() {
+			s.Logf("%s %s %d %s %s", r.Method, r.URL.Path, sw.status, res.Cid, time.Since(start).Round(time.Millisecond))
+		}()
+	}
+
+	if status == http.StatusUnauthorized {
+		sw.Header().Set("WWW-Authenticate", `Bearer realm="ipfs-pinner"`)
+	}
+	if status == http.StatusNoContent {
+		sw.WriteHeader(status)
+		return
+	}
+	sw.Header().Set("Content-Type", "application/json")
+	sw.WriteHeader(status)
+	_ = json.NewEncoder(sw).Encode(res)
+}
+
+// serve handles a request, and returns the response and its status.
+func (s *Server) serve(r *http.Request) (Response, int) {
+	if !s.authorized(r) {
+		return Response{Error: "unauthorized"}, http.StatusUnauthorized
+	}
+
+	var resource, arg string
+	switch path := strings.Trim(r.URL.Path, "/"); {
+	case path == "pin":
+		resource = path
+	case strings.HasPrefix(path, "pin/"), strings.HasPrefix(path, "status/"):
+		resource, arg = path[:strings.Index(path, "/")], path[strings.Index(path, "/")+1:]
+		if _, err := cid.Parse(arg); err != nil {
+			return Response{Error: fmt.Sprintf("invalid cid %s", arg)}, http.StatusBadRequest
+		}
+	default:
+		return Response{Error: "not found"}, http.StatusNotFound
+	}
+
+	res := Response{Cid: arg, Provider: s.Config.Pinner}
+	var err error
+	switch {
+	case resource == "pin" && arg == "" && r.Method == http.MethodPost:
+		res.Cid, err = s.pin(r)
+	case resource == "pin" && arg != "" && r.Method == http.MethodPost:
+		res.Cid, err = s.Config.PinHash(arg)
+	case resource == "pin" && arg != "" && r.Method == http.MethodDelete:
+		if err = s.Config.Unpin(arg); err == nil {
+			return res, http.StatusNoContent
+		}
+	case resource == "status" && r.Method == http.MethodGet:
+		var ok bool
+		ok, err = s.Config.Pinned(arg)
+		res.Pinned = &ok
+	default:
+		return Response{Error: "method not allowed"}, http.StatusMethodNotAllowed
+	}
+	if err != nil {
+		return Response{Cid: arg, Provider: s.Config.Pinner, Error: err.Error()}, statusOf(err)
+	}
+
+	return res, http.StatusOK
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(s.Token)) == 1
+}
+
+// errTooLarge is returned for uploads larger than MaxBodySize.
+var errTooLarge = errors.New("request body too large")
+
+// pin pins the body of r, the first file of a multipart form or the raw
+// body, named by the name query parameter.
+func (s *Server) pin(r *http.Request) (string, error) {
+	var body io.Reader = r.Body
+	if s.MaxBodySize > 0 {
+		if r.ContentLength > s.MaxBodySize {
+			return "", errTooLarge
+		}
+		body = &limitedReader{r: body, n: s.MaxBodySize}
+	}
+
+	// The retrying client would read the whole body in memory, to send it
+	// again on failure.
+	cfg := *s.Config
+	cfg.Client = httpretry.WithRetries(cfg.Client, 0)
+
+	mtype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mtype != "multipart/form-data" {
+		if mtype == "application/octet-stream" {
+			mtype = ""
+		}
+		return cfg.Pin(&file.NamedReader{Reader: body, Name: r.URL.Query().Get("name"), ContentType: mtype})
+	}
+
+	r.Body = io.NopCloser(body)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return "", &requestError{err}
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return "", &requestError{errors.New("no file in form")}
+		}
+		if err != nil {
+			return "", &requestError{err}
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		ctype := part.Header.Get("Content-Type")
+		if ctype == "application/octet-stream" {
+			ctype = ""
+		}
+		return cfg.Pin(&file.NamedReader{Reader: part, Name: part.FileName(), ContentType: ctype})
+	}
+}
+
+// limitedReader fails with errTooLarge once more than n bytes are read.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		return n, errTooLarge
+	}
+	return n, err
+}
+
+// requestError is an invalid request.
+type requestError struct {
+	err error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// statusOf returns the status of a response failing with err. Errors of
+// the pinner are reported as a bad gateway, but rate limiting is passed
+// through for clients to slow down.
+func statusOf(err error) int {
+	var (
+		re *requestError
+		se *httpretry.StatusError
+		ue *url.Error
+		ne net.Error
+	)
+	switch {
+	case errors.Is(err, errTooLarge), errors.Is(err, capability.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, capability.ErrUnsupported):
+		return http.StatusNotImplemented
+	case errors.As(err, &re):
+		return http.StatusBadRequest
+	case errors.As(err, &se):
+		if se.StatusCode == http.StatusTooManyRequests {
+			return http.StatusTooManyRequests
+		}
+		return http.StatusBadGateway
+	case errors.As(err, &ue), errors.As(err, &ne):
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wabarc/helper"
+
+	pinner "github.com/wabarc/ipfs-pinner"
+)
+
+const hash = "QmYwAPJzv5CZsnA625s3Xf2nemtYgPpHdWEz79ojWnPbdG"
+
+// upstream mocks the Infura API, recording the uploads.
+func upstream(t *testing.T) (*pinner.Config, *[]string) {
+	client, mux, server := helper.MockServer()
+	t.Cleanup(server.Close)
+
+	var uploads []string
+	mux.HandleFunc("/api/v0/add", func(w http.ResponseWriter, r *http.Request) {
+		f, h, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(f)
+		uploads = append(uploads, h.Filename+" "+h.Header.Get("Content-Type")+" "+string(data))
+		_, _ = w.Write([]byte(`{"Hash":"` + hash + `","Name":"` + h.Filename + `","Size":"1"}`))
+	})
+	mux.HandleFunc("/api/v0/pin/add", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Pins":["` + r.URL.Query().Get("arg") + `"]}`))
+	})
+	mux.HandleFunc("/api/v0/pin/ls", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Keys":{"` + r.URL.Query().Get("arg") + `":{"Type":"recursive"}}}`))
+	})
+	mux.HandleFunc("/api/v0/pin/rm", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"Message":"not pinned","Code":0,"Type":"error"}`, http.StatusTooManyRequests)
+	})
+
+	cfg := &pinner.Config{Pinner: pinner.Infura, Apikey: "apikey-apikey", Secret: "secret"}
+	return cfg.WithClient(client), &uploads
+}
+
+func do(t *testing.T, h http.Handler, req *http.Request) (int, Response) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var res Response
+	if rec.Body.Len() > 0 {
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("Unexpected response %q: %v", rec.Body, err)
+		}
+	}
+	return rec.Code, res
+}
+
+func TestServePin(t *testing.T) {
+	cfg, uploads := upstream(t)
+	s := &Server{Config: cfg, Token: "token", MaxBodySize: 512}
+
+	req := httptest.NewRequest(http.MethodPost, "/pin?name=a.txt", strings.NewReader("raw"))
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Content-Type", "text/plain")
+	if code, res := do(t, s, req); code != http.StatusOK || res.Cid != hash || res.Provider != pinner.Infura {
+		t.Errorf("Unexpected raw upload %d %+v", code, res)
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("file", "b.txt")
+	_, _ = fw.Write([]byte("form"))
+	mw.Close()
+	req = httptest.NewRequest(http.MethodPost, "/pin", &body)
+	req.Header.Set("Authorization", "Bearer token")
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if code, res := do(t, s, req); code != http.StatusOK || res.Cid != hash {
+		t.Errorf("Unexpected form upload %d %+v", code, res)
+	}
+
+	expected := []string{"a.txt text/plain raw", "b.txt application/octet-stream form"}
+	if strings.Join(*uploads, "|") != strings.Join(expected, "|") {
+		t.Errorf("Unexpected uploads %q", *uploads)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/pin", strings.NewReader(strings.Repeat("x", 513)))
+	req.Header.Set("Authorization", "Bearer token")
+	if code, _ := do(t, s, req); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Unexpected status %d of a large upload", code)
+	}
+	// Without length, the body is cut while streamed.
+	req = httptest.NewRequest(http.MethodPost, "/pin", io.MultiReader(strings.NewReader(strings.Repeat("x", 513))))
+	req.ContentLength = -1
+	req.Header.Set("Authorization", "Bearer token")
+	if code, _ := do(t, s, req); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Unexpected status %d of a large streamed upload", code)
+	}
+}
+
+func TestServeCid(t *testing.T) {
+	cfg, _ := upstream(t)
+	s := &Server{Config: cfg}
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{http.MethodPost, "/pin/" + hash, http.StatusOK},
+		{http.MethodGet, "/status/" + hash, http.StatusOK},
+		{http.MethodDelete, "/pin/" + hash, http.StatusTooManyRequests},
+		{http.MethodGet, "/pin/" + hash, http.StatusMethodNotAllowed},
+		{http.MethodPost, "/pin/nope", http.StatusBadRequest},
+		{http.MethodGet, "/pins", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		code, res := do(t, s, httptest.NewRequest(test.method, test.path, nil))
+		if code != test.code {
+			t.Errorf("Unexpected status of %s %s, got %d instead of %d: %+v", test.method, test.path, code, test.code, res)
+		}
+	}
+
+	_, res := do(t, s, httptest.NewRequest(http.MethodGet, "/status/"+hash, nil))
+	if res.Pinned == nil || !*res.Pinned {
+		t.Errorf("Unexpected status %+v", res)
+	}
+}
+
+func TestServeUnauthorized(t *testing.T) {
+	cfg, _ := upstream(t)
+	s := &Server{Config: cfg, Token: "token"}
+
+	for _, auth := range []string{"", "Bearer nope", "token"} {
+		req := httptest.NewRequest(http.MethodGet, "/status/"+hash, nil)
+		req.Header.Set("Authorization", auth)
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Unexpected response %d to authorization %q", rec.Code, auth)
+		}
+	}
+}
+
+func TestServePinStreams(t *testing.T) {
+	const (
+		chunk = 1 << 20
+		size  = 64 * chunk
+	)
+	client, mux, server := helper.MockServer()
+	defer server.Close()
+
+	// received is closed once the pinner gets the first bytes.
+	received := make(chan struct{})
+	var n int64
+	mux.HandleFunc("/api/v0/add", func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		part, err := mr.NextPart()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		buf := make([]byte, 32<<10)
+		for {
+			m, err := part.Read(buf)
+			if n == 0 && m > 0 {
+				close(received)
+			}
+			n += int64(m)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		_, _ = w.Write([]byte(`{"Hash":"` + hash + `","Name":"big.bin","Size":"1"}`))
+	})
+
+	cfg := &pinner.Config{Pinner: pinner.Infura, Apikey: "apikey-apikey", Secret: "secret"}
+	s := &Server{Config: cfg.WithClient(client)}
+
+	// The rest of the body is only written once the pinner received its
+	// start, which never happens if the upload is held in memory first.
+	pr, pw := io.Pipe()
+	go func() {
+		data := bytes.Repeat([]byte("a"), chunk)
+		_, _ = pw.Write(data)
+		select {
+		case <-received:
+		case <-time.After(10 * time.Second):
+			_ = pw.CloseWithError(errors.New("upload buffered before reaching the pinner"))
+			return
+		}
+		for i := 1; i < size/chunk; i++ {
+			if _, err := pw.Write(data); err != nil {
+				return
+			}
+		}
+		_ = pw.Close()
+	}()
+
+	req := httptest.NewRequest(http.MethodPost, "/pin?name=big.bin", pr)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if code, res := do(t, s, req); code != http.StatusOK || res.Cid != hash {
+		t.Fatalf("Unexpected upload %d %+v", code, res)
+	}
+	if n != size {
+		t.Errorf("Unexpected %d bytes received instead of %d", n, size)
+	}
+}
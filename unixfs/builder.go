@@ -0,0 +1,289 @@
+package unixfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	// DefaultChunkSize is the size of the chunks files are split into,
+	// the same as the default chunker of `ipfs add`.
+	DefaultChunkSize = 256 << 10
+
+	// DefaultLinksPerBlock is the maximum number of links of a file node,
+	// the same as the balanced layout of `ipfs add`.
+	DefaultLinksPerBlock = 174
+)
+
+// Block is an encoded node of a DAG.
+type Block struct {
+	Cid  cid.Cid
+	Data []byte
+}
+
+// Link points to the root of a DAG built by a Builder. Size is the
+// cumulative size of the encoded nodes of the DAG, the Tsize of dag-pb.
+type Link struct {
+	Cid  cid.Cid
+	Size uint64
+}
+
+// Option configures a Builder.
+type Option func(*Builder)
+
+// CidV0 builds DAGs with CIDv0 and dag-pb leaves, the same as
+// `ipfs add --cid-version=0`. By default, CIDv1 and raw leaves are used,
+// the same as `ipfs add --cid-version=1`.
+func CidV0() Option {
+	return func(b *Builder) {
+		b.version = 0
+		b.rawLeaves = false
+	}
+}
+
+// ChunkSize sets the size of the chunks files are split into.
+func ChunkSize(size int) Option {
+	return func(b *Builder) {
+		b.chunkSize = size
+	}
+}
+
+// OnBlock calls fn with every block of the DAG, children before their
+// parents. It allows storing the blocks, such as in a CAR file.
+func OnBlock(fn func(Block) error) Option {
+	return func(b *Builder) {
+		b.onBlock = fn
+	}
+}
+
+// Builder builds UnixFS DAGs with the balanced layout and fixed size
+// chunks. Directories are not sharded, so a directory holding many
+// thousands of entries does not yield the same CID as Kubo, which shards
+// them automatically.
+type Builder struct {
+	version   uint64
+	rawLeaves bool
+	chunkSize int
+	onBlock   func(Block) error
+}
+
+// NewBuilder returns a Builder using the given options.
+func NewBuilder(opts ...Option) *Builder {
+	b := &Builder{
+		version:   1,
+		rawLeaves: true,
+		chunkSize: DefaultChunkSize,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Sum returns the root CID of the DAG of nd, built with the given options.
+func Sum(nd files.Node, opts ...Option) (cid.Cid, error) {
+	l, err := NewBuilder(opts...).Add(nd)
+	return l.Cid, err
+}
+
+// Add builds the DAG of nd, which is a file, a directory or a symlink,
+// and returns a link to its root. Files and directories implementing
+// Metadata keep their mode and modification time.
+func (b *Builder) Add(nd files.Node) (Link, error) {
+	switch n := nd.(type) {
+	case *files.Symlink:
+		return b.addSymlink(n)
+	case files.File:
+		return b.addFile(n)
+	case files.Directory:
+		return b.addDirectory(n)
+	}
+	return Link{}, fmt.Errorf("unsupported node type %T", nd)
+}
+
+func (b *Builder) put(codec uint64, data []byte) (Link, error) {
+	mh, err := multihash.Sum(data, multihash.SHA2_256, -1)
+	if err != nil {
+		return Link{}, err
+	}
+	var c cid.Cid
+	if b.version == 0 {
+		c = cid.NewCidV0(mh)
+	} else {
+		c = cid.NewCidV1(codec, mh)
+	}
+	if b.onBlock != nil {
+		if err := b.onBlock(Block{Cid: c, Data: data}); err != nil {
+			return Link{}, err
+		}
+	}
+	return Link{Cid: c, Size: uint64(len(data))}, nil
+}
+
+func (b *Builder) putNode(nd *pbNode) (Link, error) {
+	l, err := b.put(cid.DagProtobuf, nd.marshal())
+	if err != nil {
+		return l, err
+	}
+	for _, child := range nd.links {
+		l.Size += child.tsize
+	}
+	return l, nil
+}
+
+// fileNode is a node of a file DAG being built.
+type fileNode struct {
+	link     Link
+	filesize uint64
+}
+
+// addLeaf adds a leaf holding chunk. A leaf carrying metadata is always a
+// dag-pb node.
+func (b *Builder) addLeaf(chunk []byte, meta *data) (fileNode, error) {
+	size := uint64(len(chunk))
+	if b.rawLeaves && meta == nil {
+		l, err := b.put(cid.Raw, chunk)
+		return fileNode{link: l, filesize: size}, err
+	}
+	d := &data{typ: typeFile, data: chunk, filesize: &size}
+	if meta != nil {
+		d.mode, d.mtime = meta.mode, meta.mtime
+	}
+	l, err := b.putNode(&pbNode{data: d.marshal()})
+	return fileNode{link: l, filesize: size}, err
+}
+
+func (b *Builder) addFile(f files.File) (Link, error) {
+	defer f.Close()
+
+	var meta *data
+	if d := new(data); withMetadata(f, d) {
+		meta = d
+	}
+
+	// A chunk becomes a leaf once the next one is read, so that the last
+	// chunk of a single chunk file can carry the metadata.
+	var level []fileNode
+	var last []byte // nil for an empty file, which has no data
+	buf := make([]byte, b.chunkSize)
+	for {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 && len(last) > 0 {
+			leaf, err := b.addLeaf(last, nil)
+			if err != nil {
+				return Link{}, err
+			}
+			level = append(level, leaf)
+		}
+		if n > 0 {
+			last = append(last[:0], buf[:n]...)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return Link{}, err
+		}
+	}
+	if len(level) == 0 {
+		// A raw leaf cannot carry metadata, it is wrapped in a file node.
+		if b.rawLeaves && meta != nil {
+			leaf, err := b.addLeaf(last, nil)
+			if err != nil {
+				return Link{}, err
+			}
+			root, err := b.addFileNode([]fileNode{leaf}, meta)
+			return root.link, err
+		}
+		leaf, err := b.addLeaf(last, meta)
+		return leaf.link, err
+	}
+	leaf, err := b.addLeaf(last, nil)
+	if err != nil {
+		return Link{}, err
+	}
+	level = append(level, leaf)
+
+	// The balanced layout fills every node with the maximum number of
+	// links before starting the next one, so the tree is built bottom up
+	// by grouping the nodes of each level. Only the root carries the
+	// metadata.
+	for len(level) > 1 {
+		var parents []fileNode
+		root := len(level) <= DefaultLinksPerBlock
+		for len(level) > 0 {
+			n := DefaultLinksPerBlock
+			if len(level) < n {
+				n = len(level)
+			}
+			var m *data
+			if root {
+				m = meta
+			}
+			parent, err := b.addFileNode(level[:n], m)
+			if err != nil {
+				return Link{}, err
+			}
+			parents = append(parents, parent)
+			level = level[n:]
+		}
+		level = parents
+	}
+
+	return level[0].link, nil
+}
+
+func (b *Builder) addFileNode(children []fileNode, meta *data) (fileNode, error) {
+	d := &data{typ: typeFile}
+	if meta != nil {
+		d.mode, d.mtime = meta.mode, meta.mtime
+	}
+	nd := &pbNode{}
+	var filesize uint64
+	for _, child := range children {
+		filesize += child.filesize
+		d.blocksizes = append(d.blocksizes, child.filesize)
+		nd.links = append(nd.links, pbLink{hash: child.link.Cid.Bytes(), tsize: child.link.Size})
+	}
+	d.filesize = &filesize
+	nd.data = d.marshal()
+
+	l, err := b.putNode(nd)
+	return fileNode{link: l, filesize: filesize}, err
+}
+
+func (b *Builder) addSymlink(s *files.Symlink) (Link, error) {
+	d := &data{typ: typeSymlink, data: []byte(s.Target)}
+	return b.putNode(&pbNode{data: d.marshal()})
+}
+
+func (b *Builder) addDirectory(dir files.Directory) (Link, error) {
+	defer dir.Close()
+
+	nd := &pbNode{}
+	it := dir.Entries()
+	for it.Next() {
+		l, err := b.Add(it.Node())
+		if err != nil {
+			return Link{}, err
+		}
+		nd.links = append(nd.links, pbLink{hash: l.Cid.Bytes(), name: it.Name(), tsize: l.Size})
+	}
+	if err := it.Err(); err != nil {
+		return Link{}, err
+	}
+	sort.SliceStable(nd.links, func(i, j int) bool {
+		return nd.links[i].name < nd.links[j].name
+	})
+
+	d := &data{typ: typeDirectory}
+	withMetadata(dir, d)
+	nd.data = d.marshal()
+	return b.putNode(nd)
+}
@@ -0,0 +1,166 @@
+package unixfs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	chunker "github.com/ipfs/boxo/chunker"
+	"github.com/ipfs/boxo/files"
+	ipld "github.com/ipfs/boxo/ipld/merkledag"
+	mdtest "github.com/ipfs/boxo/ipld/merkledag/test"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	"github.com/ipfs/boxo/ipld/unixfs/importer/balanced"
+	h "github.com/ipfs/boxo/ipld/unixfs/importer/helpers"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/multiformats/go-multihash"
+)
+
+// kuboAdd builds the DAG of nd with the importer used by Kubo, the
+// reference the Builder must agree with.
+func kuboAdd(t *testing.T, nd files.Node, v0 bool) format.Node {
+	ctx := context.Background()
+	ds := mdtest.Mock()
+	var prefix cid.Builder = cid.V1Builder{Codec: cid.DagProtobuf, MhType: multihash.SHA2_256}
+	if v0 {
+		prefix = ipld.V0CidPrefix()
+	}
+
+	var add func(nd files.Node) format.Node
+	add = func(nd files.Node) format.Node {
+		switch n := nd.(type) {
+		case *files.Symlink:
+			data, err := ft.SymlinkData(n.Target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pn := ipld.NodeWithData(data)
+			_ = pn.SetCidBuilder(prefix)
+			return pn
+		case files.File:
+			params := h.DagBuilderParams{Dagserv: ds, Maxlinks: h.DefaultLinksPerBlock, RawLeaves: !v0, CidBuilder: prefix}
+			db, err := params.New(chunker.NewSizeSplitter(n, DefaultChunkSize))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fn, err := balanced.Layout(db)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return fn
+		case files.Directory:
+			dir := uio.NewDirectory(ds)
+			dir.SetCidBuilder(prefix)
+			it := n.Entries()
+			for it.Next() {
+				if err := dir.AddChild(ctx, it.Name(), add(it.Node())); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dn, err := dir.GetNode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return dn
+		}
+		t.Fatalf("Unexpected node type %T", nd)
+		return nil
+	}
+
+	return add(nd)
+}
+
+func tree() files.Node {
+	return files.NewMapDirectory(map[string]files.Node{
+		"index.html": files.NewBytesFile([]byte("<html></html>")),
+		"empty":      files.NewMapDirectory(nil),
+		"link":       files.NewLinkFile("index.html", nil),
+		"sub": files.NewMapDirectory(map[string]files.Node{
+			"large.bin": files.NewBytesFile(bytes.Repeat([]byte("a"), 3*DefaultChunkSize+7)),
+			"void":      files.NewBytesFile(nil),
+			"nested":    files.NewMapDirectory(map[string]files.Node{}),
+		}),
+	})
+}
+
+func TestSumKnownCids(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     files.Node
+		opts     []Option
+		expected string
+	}{
+		{"empty directory v0", files.NewMapDirectory(nil), []Option{CidV0()}, "QmUNLLsPACCz1vLxQVkXqqLX5R1X345qqfHbsf67hvA3Nn"},
+		{"empty directory v1", files.NewMapDirectory(nil), nil, "bafybeiczsscdsbs7ffqz55asqdf3smv6klcw3gofszvwlyarci47bgf354"},
+		{"empty file v0", files.NewBytesFile(nil), []Option{CidV0()}, "QmbFMke1KXqnYyBBWxB74N4c5SBnJMVAiMNRcGu6x1AwQH"},
+		{"empty file v1", files.NewBytesFile(nil), nil, "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku"},
+		{"hello world v0", files.NewBytesFile([]byte("hello world\n")), []Option{CidV0()}, "QmT78zSuBmuS4z925WZfrqQ1qHaJ56DQaTfyMUF7F8ff5o"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c, err := Sum(test.node, test.opts...)
+			if err != nil {
+				t.Fatalf("Unexpected sum: %v", err)
+			}
+			if c.String() != test.expected {
+				t.Errorf("Unexpected cid, got %s instead of %s", c, test.expected)
+			}
+		})
+	}
+}
+
+func TestBuilderMatchesKubo(t *testing.T) {
+	sizes := []int{0, 12, DefaultChunkSize, DefaultChunkSize + 1, DefaultLinksPerBlock*DefaultChunkSize + 5}
+	for _, v0 := range []bool{false, true} {
+		var opts []Option
+		if v0 {
+			opts = append(opts, CidV0())
+		}
+		for _, size := range sizes {
+			content := bytes.Repeat([]byte("a"), size)
+			expected := kuboAdd(t, files.NewBytesFile(content), v0)
+			l, err := NewBuilder(opts...).Add(files.NewBytesFile(content))
+			if err != nil {
+				t.Fatalf("Unexpected add file: %v", err)
+			}
+			tsize, _ := expected.Size()
+			if !l.Cid.Equals(expected.Cid()) || l.Size != tsize {
+				t.Errorf("Unexpected file of %d bytes (v0=%v), got %s (%d) instead of %s (%d)", size, v0, l.Cid, l.Size, expected.Cid(), tsize)
+			}
+		}
+
+		expected := kuboAdd(t, tree(), v0)
+		l, err := NewBuilder(opts...).Add(tree())
+		if err != nil {
+			t.Fatalf("Unexpected add directory: %v", err)
+		}
+		tsize, _ := expected.Size()
+		if !l.Cid.Equals(expected.Cid()) || l.Size != tsize {
+			t.Errorf("Unexpected directory (v0=%v), got %s (%d) instead of %s (%d)", v0, l.Cid, l.Size, expected.Cid(), tsize)
+		}
+	}
+}
+
+func TestOnBlock(t *testing.T) {
+	blocks := make(map[string][]byte)
+	l, err := NewBuilder(OnBlock(func(b Block) error {
+		blocks[b.Cid.KeyString()] = b.Data
+		return nil
+	})).Add(tree())
+	if err != nil {
+		t.Fatalf("Unexpected add directory: %v", err)
+	}
+	if _, ok := blocks[l.Cid.KeyString()]; !ok {
+		t.Fatal("Unexpected root block missing")
+	}
+	for k, data := range blocks {
+		c, _ := cid.Cast([]byte(k))
+		sum, err := c.Prefix().Sum(data)
+		if err != nil || !sum.Equals(c) {
+			t.Errorf("Unexpected block %s not matching its data", c)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package unixfs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/go-cid"
+)
+
+// WriteCAR builds the DAG of nd and writes it to w as a CARv1 archive,
+// with the root of the DAG as its only root. Blocks appearing several
+// times in the DAG are written once. It returns the root CID.
+func WriteCAR(w io.Writer, nd files.Node, opts ...Option) (cid.Cid, error) {
+	// The root is only known once the DAG is built, while the header
+	// holding it comes first, so the blocks are staged in a temporary file.
+	tmp, err := os.CreateTemp("", "ipfs-pinner-*.car")
+	if err != nil {
+		return cid.Undef, fmt.Errorf("create temporary file failed: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	bw := bufio.NewWriter(tmp)
+	seen := make(map[cid.Cid]bool)
+	onBlock := func(blk Block) error {
+		if seen[blk.Cid] {
+			return nil
+		}
+		seen[blk.Cid] = true
+		return writeSection(bw, blk.Cid.Bytes(), blk.Data)
+	}
+	root, err := Sum(nd, append(opts, OnBlock(onBlock))...)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if err := bw.Flush(); err != nil {
+		return cid.Undef, fmt.Errorf("write temporary file failed: %w", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return cid.Undef, err
+	}
+
+	if err := writeSection(w, carHeader(root)); err != nil {
+		return cid.Undef, err
+	}
+	if _, err := io.Copy(w, tmp); err != nil {
+		return cid.Undef, err
+	}
+
+	return root, nil
+}
+
+// writeSection writes the concatenation of parts prefixed by its length.
+func writeSection(w io.Writer, parts ...[]byte) error {
+	var n int
+	for _, p := range parts {
+		n += len(p)
+	}
+	if _, err := w.Write(binary.AppendUvarint(nil, uint64(n))); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if _, err := w.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// carHeader returns the DAG-CBOR encoded header of a CARv1 archive,
+// {"roots": [root], "version": 1}.
+func carHeader(root cid.Cid) []byte {
+	// A CID is encoded as tag 42 over a byte string holding the CID
+	// prefixed with the identity multibase.
+	link := append([]byte{0x00}, root.Bytes()...)
+
+	b := []byte{0xa2} // map(2)
+	b = append(b, 0x65)
+	b = append(b, "roots"...)
+	b = append(b, 0x81)       // array(1)
+	b = append(b, 0xd8, 0x2a) // tag(42)
+	b = appendCborHead(b, 2, uint64(len(link)))
+	b = append(b, link...)
+	b = append(b, 0x67)
+	b = append(b, "version"...)
+	return append(b, 0x01)
+}
+
+// appendCborHead appends the head of a CBOR item of the given major type
+// and argument.
+func appendCborHead(b []byte, major byte, v uint64) []byte {
+	m := major << 5
+	switch {
+	case v < 24:
+		return append(b, m|byte(v))
+	case v <= 0xff:
+		return append(b, m|24, byte(v))
+	case v <= 0xffff:
+		return binary.BigEndian.AppendUint16(append(b, m|25), uint16(v))
+	case v <= 0xffffffff:
+		return binary.BigEndian.AppendUint32(append(b, m|26), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, m|27), v)
+}
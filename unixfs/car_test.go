@@ -0,0 +1,168 @@
+package unixfs
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/go-cid"
+	cbor "github.com/ipfs/go-ipld-cbor"
+)
+
+// readSection reads a section of a CAR file, prefixed by its length.
+func readSection(t *testing.T, r *bufio.Reader) ([]byte, bool) {
+	t.Helper()
+
+	n, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		return nil, false
+	}
+	if err != nil {
+		t.Fatalf("Unexpected read section length: %v", err)
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatalf("Unexpected read section: %v", err)
+	}
+	return buf, true
+}
+
+func TestWriteCAR(t *testing.T) {
+	for _, opts := range [][]Option{nil, {CidV0()}} {
+		var buf bytes.Buffer
+		root, err := WriteCAR(&buf, tree(), opts...)
+		if err != nil {
+			t.Fatalf("Unexpected write car: %v", err)
+		}
+		expected, _ := Sum(tree(), opts...)
+		if !root.Equals(expected) {
+			t.Errorf("Unexpected root, got %s instead of %s", root, expected)
+		}
+
+		r := bufio.NewReader(&buf)
+		raw, _ := readSection(t, r)
+		var header map[string]interface{}
+		if err := cbor.DecodeInto(raw, &header); err != nil {
+			t.Fatalf("Unexpected decode header: %v", err)
+		}
+		roots, _ := header["roots"].([]interface{})
+		if len(roots) != 1 || roots[0] != root || fmt.Sprint(header["version"]) != "1" {
+			t.Errorf("Unexpected header %v", header)
+		}
+
+		seen := make(map[cid.Cid]bool)
+		for {
+			section, ok := readSection(t, r)
+			if !ok {
+				break
+			}
+			n, c, err := cid.CidFromBytes(section)
+			if err != nil {
+				t.Fatalf("Unexpected cid: %v", err)
+			}
+			if seen[c] {
+				t.Errorf("Unexpected duplicate block %s", c)
+			}
+			seen[c] = true
+			sum, err := c.Prefix().Sum(section[n:])
+			if err != nil || !sum.Equals(c) {
+				t.Errorf("Unexpected block %s not matching its data", c)
+			}
+		}
+		if !seen[root] {
+			t.Error("Unexpected root block missing")
+		}
+	}
+}
+
+func TestWriteCARError(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := WriteCAR(&buf, files.NewReaderFile(failingReader{}))
+	if err == nil {
+		t.Fatal("Unexpected write car of a failing file succeeded")
+	}
+	if buf.Len() > 0 {
+		t.Errorf("Unexpected %d bytes written", buf.Len())
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, io.ErrClosedPipe
+}
+
+func TestCARReader(t *testing.T) {
+	var buf bytes.Buffer
+	root, err := WriteCAR(&buf, tree())
+	if err != nil {
+		t.Fatalf("Unexpected write car: %v", err)
+	}
+	archive := buf.Bytes()
+
+	cr, err := NewCARReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatalf("Unexpected read car header: %v", err)
+	}
+	if len(cr.Roots) != 1 || !cr.Roots[0].Equals(root) {
+		t.Fatalf("Unexpected roots %v", cr.Roots)
+	}
+	blocks := make(map[cid.Cid]Block)
+	for {
+		blk, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected read block: %v", err)
+		}
+		blocks[blk.Cid] = blk
+	}
+
+	// Every link of the DAG points to a block of the archive.
+	reached := map[cid.Cid]bool{root: true}
+	queue := []cid.Cid{root}
+	for len(queue) > 0 {
+		blk, ok := blocks[queue[0]]
+		if !ok {
+			t.Fatalf("Unexpected missing block %s", queue[0])
+		}
+		queue = queue[1:]
+		links, err := Links(blk)
+		if err != nil {
+			t.Fatalf("Unexpected links of %s: %v", blk.Cid, err)
+		}
+		for _, l := range links {
+			if !reached[l] {
+				reached[l] = true
+				queue = append(queue, l)
+			}
+		}
+	}
+	if len(reached) != len(blocks) {
+		t.Errorf("Unexpected %d blocks reached of %d", len(reached), len(blocks))
+	}
+
+	// A block altered by a byte does not match its CID.
+	altered := append([]byte(nil), archive...)
+	altered[len(altered)-1] ^= 0xff
+	cr, err = NewCARReader(bytes.NewReader(altered))
+	if err != nil {
+		t.Fatalf("Unexpected read car header: %v", err)
+	}
+	for err == nil {
+		_, err = cr.Next()
+	}
+	if !errors.Is(err, ErrMismatch) {
+		t.Errorf("Unexpected error reading an altered block: %v", err)
+	}
+
+	if _, err := NewCARReader(bytes.NewReader(nil)); err == nil {
+		t.Error("Unexpected empty archive read without error")
+	}
+}
@@ -0,0 +1,86 @@
+package unixfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car/v2"
+)
+
+// maxSection is the maximum size of a section of a CAR archive read by a
+// CARReader, above the size of any block exchanged on IPFS.
+const maxSection = 4 << 20
+
+// ErrMismatch is returned for a block whose data does not hash to its CID.
+var ErrMismatch = errors.New("block does not match its cid")
+
+// CARReader reads the blocks of a CAR archive, checking that each block
+// hashes to its CID.
+type CARReader struct {
+	// Roots are the roots of the archive, read from its header.
+	Roots []cid.Cid
+
+	br *car.BlockReader
+}
+
+// NewCARReader reads the header of the CAR archive of r, and returns a
+// reader of its blocks.
+func NewCARReader(r io.Reader) (*CARReader, error) {
+	// Blocks are checked by Next, to report ErrMismatch.
+	br, err := car.NewBlockReader(r, car.MaxAllowedSectionSize(maxSection), car.WithTrustedCAR(true))
+	if err != nil {
+		return nil, fmt.Errorf("read car header failed: %w", err)
+	}
+	return &CARReader{Roots: br.Roots, br: br}, nil
+}
+
+// Next returns the next block of the archive, or io.EOF after the last one.
+// It returns ErrMismatch, wrapped, if the block does not hash to its CID.
+func (cr *CARReader) Next() (Block, error) {
+	b, err := cr.br.Next()
+	if err != nil {
+		return Block{}, err
+	}
+	blk := Block{Cid: b.Cid(), Data: b.RawData()}
+	if err := Check(blk); err != nil {
+		return Block{}, err
+	}
+	return blk, nil
+}
+
+// Check checks that the data of blk hashes to its CID.
+func Check(blk Block) error {
+	sum, err := blk.Cid.Prefix().Sum(blk.Data)
+	if err != nil {
+		return fmt.Errorf("hash block %s failed: %w", blk.Cid, err)
+	}
+	if !sum.Equals(blk.Cid) {
+		return fmt.Errorf("%s: %w", blk.Cid, ErrMismatch)
+	}
+	return nil
+}
+
+// Links returns the CIDs a block links to. Raw blocks have no links, and
+// blocks of codecs other than dag-pb and raw are not supported.
+func Links(blk Block) ([]cid.Cid, error) {
+	switch blk.Cid.Type() {
+	case cid.Raw:
+		return nil, nil
+	case cid.DagProtobuf:
+	default:
+		return nil, fmt.Errorf("unsupported codec 0x%x of %s", blk.Cid.Type(), blk.Cid)
+	}
+
+	nd, err := merkledag.DecodeProtobuf(blk.Data)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s failed: %w", blk.Cid, err)
+	}
+	links := make([]cid.Cid, 0, len(nd.Links()))
+	for _, l := range nd.Links() {
+		links = append(links, l.Cid)
+	}
+	return links, nil
+}
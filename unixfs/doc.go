@@ -0,0 +1,20 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package unixfs builds UnixFS DAGs locally, the same way as
+`ipfs add --cid-version=1` does, to compute the CID of content before or
+without uploading it. That is CIDv1 with raw leaves; `ipfs add` without
+options yields CIDv0, which the CidV0 option builds.
+
+Nodes are encoded by the package rather than by the importer of boxo v0.9,
+which cannot carry the mode and modification time of UnixFS 1.5. Its output
+is checked against that importer.
+
+It also reads UnixFS DAGs back from the verified blocks of a CAR archive,
+as a file reader, a read-only fs.FS, or extracted to disk. Archives are read
+with go-car, and DAGs with the merkledag and unixfs packages of boxo; only
+the UnixFS 1.5 metadata, which boxo does not decode, is decoded here.
+*/
+package unixfs // import "github.com/wabarc/ipfs-pinner/unixfs"
@@ -0,0 +1,60 @@
+package unixfs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipfs/boxo/blockservice"
+	"github.com/ipfs/boxo/exchange/offline"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipld/go-car/v2/blockstore"
+)
+
+// ErrNotFile is returned when reading the content of a DAG which is not a
+// UnixFS file, such as a directory.
+var ErrNotFile = errors.New("not a unixfs file")
+
+// IndexCAR indexes the blocks of the CARv1 archive of r, of size bytes, and
+// returns its roots and a DAG service of its blocks read from r. Blocks are
+// checked against their CID while indexed, and looked up by multihash.
+// Identity CIDs are resolved without block.
+func IndexCAR(r io.ReaderAt, size int64) ([]cid.Cid, ipld.DAGService, error) {
+	cr, err := NewCARReader(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return nil, nil, err
+	}
+	for {
+		_, err := cr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	bs, err := blockstore.NewReadOnly(io.NewSectionReader(r, 0, size), nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("index car failed: %w", err)
+	}
+	dag := merkledag.NewDAGService(blockservice.New(bs, offline.Exchange(bs)))
+	return cr.Roots, dag, nil
+}
+
+// NewFileReader returns a reader of the content of the UnixFS file root,
+// read from dag. Blocks are only fetched as the content is read. It returns
+// ErrNotFile, wrapped, if root is not a file.
+func NewFileReader(root cid.Cid, dag ipld.DAGService) (io.Reader, error) {
+	fsys := &dagFS{root: root, dag: dag}
+	nd, err := fsys.load(root, ".")
+	if err != nil {
+		return nil, err
+	}
+	if !nd.mode.IsRegular() {
+		return nil, fmt.Errorf("%s: %w", root, ErrNotFile)
+	}
+	return fsys.reader(nd)
+}
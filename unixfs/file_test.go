@@ -0,0 +1,69 @@
+package unixfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/ipfs/boxo/files"
+)
+
+func TestFileReader(t *testing.T) {
+	content := bytes.Repeat([]byte("ipfs-pinner"), 1000)
+	tests := []struct {
+		name string
+		node files.Node
+		opts []Option
+	}{
+		{"single block", files.NewBytesFile([]byte("hello world\n")), nil},
+		{"empty", files.NewBytesFile(nil), nil},
+		{"chunked v1", files.NewBytesFile(content), []Option{ChunkSize(1024)}},
+		{"chunked v0", files.NewBytesFile(content), []Option{CidV0(), ChunkSize(1024)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected, _ := io.ReadAll(test.node.(files.File))
+			test.node.(files.File).Seek(0, io.SeekStart) //nolint:errcheck
+
+			var buf bytes.Buffer
+			root, err := WriteCAR(&buf, test.node, test.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			roots, dag, err := IndexCAR(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil || len(roots) != 1 || !roots[0].Equals(root) {
+				t.Fatalf("Unexpected index %v: %v", roots, err)
+			}
+			r, err := NewFileReader(root, dag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, expected) {
+				t.Errorf("Unexpected content of %d bytes instead of %d: %v", len(got), len(expected), err)
+			}
+		})
+	}
+}
+
+func TestFileReaderNotFile(t *testing.T) {
+	var buf bytes.Buffer
+	root, err := WriteCAR(&buf, tree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, dag, err := IndexCAR(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileReader(root, dag); !errors.Is(err, ErrNotFile) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	// A truncated archive is not indexed.
+	truncated := buf.Bytes()[:buf.Len()-10]
+	if _, _, err := IndexCAR(bytes.NewReader(truncated), int64(len(truncated))); err == nil {
+		t.Error("Unexpected index of a truncated archive")
+	}
+}
@@ -0,0 +1,347 @@
+package unixfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	ft "github.com/ipfs/boxo/ipld/unixfs"
+	unixfile "github.com/ipfs/boxo/ipld/unixfs/file"
+	uio "github.com/ipfs/boxo/ipld/unixfs/io"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// NewFS returns a read-only file system of the UnixFS DAG of root, read
+// from dag. If root is a directory, its entries are named by their path
+// from it; if it is a file or a symlink, it is opened as ".". Symlinks are
+// opened as files holding their target.
+func NewFS(root cid.Cid, dag ipld.DAGService) fs.FS {
+	return &dagFS{root: root, dag: dag}
+}
+
+// Extract writes the UnixFS DAG of root, read from dag, to the path p: a
+// directory with its entries, a file or a symlink. The permission bits and
+// modification time carried as metadata are applied, the setuid, setgid
+// and sticky bits of untrusted DAGs are not. Entry names are checked not
+// to escape p.
+func Extract(root cid.Cid, dag ipld.DAGService, p string) error {
+	fsys := &dagFS{root: root, dag: dag}
+	nd, err := fsys.load(root, filepath.Base(p))
+	if err != nil {
+		return err
+	}
+	if nd.mode.IsDir() {
+		if err := os.MkdirAll(p, 0o755); err != nil {
+			return err
+		}
+	}
+	return fsys.extract(nd, p)
+}
+
+type dagFS struct {
+	root cid.Cid
+	dag  ipld.DAGService
+}
+
+// dagNode is a decoded UnixFS node.
+type dagNode struct {
+	node  ipld.Node
+	name  string
+	size  int64
+	mode  fs.FileMode
+	mtime time.Time
+	// meta reports whether mode was set by metadata.
+	meta bool
+	// target is the target of a symlink.
+	target []byte
+}
+
+// load fetches and decodes the node of c, named name in its parent.
+func (fsys *dagFS) load(c cid.Cid, name string) (*dagNode, error) {
+	n, err := fsys.dag.Get(context.Background(), c)
+	if err != nil {
+		return nil, err
+	}
+	return decodeNode(n, name)
+}
+
+// decodeNode decodes the UnixFS node n, named name in its parent.
+func decodeNode(n ipld.Node, name string) (*dagNode, error) {
+	nd := &dagNode{node: n, name: name}
+	var pn *merkledag.ProtoNode
+	switch n := n.(type) {
+	case *merkledag.RawNode:
+		nd.size, nd.mode = int64(len(n.RawData())), 0o644
+		return nd, nil
+	case *merkledag.ProtoNode:
+		pn = n
+	default:
+		return nil, fmt.Errorf("unsupported codec 0x%x of %s", n.Cid().Type(), n.Cid())
+	}
+
+	fsn, err := ft.FSNodeFromBytes(pn.Data())
+	if err != nil {
+		return nil, fmt.Errorf("decode %s failed: %w", n.Cid(), err)
+	}
+	switch fsn.Type() {
+	case ft.TRaw, ft.TFile:
+		nd.mode, nd.size = 0o644, int64(fsn.FileSize())
+	case ft.TDirectory, ft.THAMTShard:
+		nd.mode = fs.ModeDir | 0o755
+	case ft.TSymlink:
+		nd.mode, nd.target = fs.ModeSymlink|0o777, fsn.Data()
+		nd.size = int64(len(nd.target))
+	default:
+		return nil, fmt.Errorf("%s: unsupported unixfs type %d", n.Cid(), fsn.Type())
+	}
+
+	mode, mtime, err := unmarshalMetadata(pn.Data())
+	if err != nil {
+		return nil, fmt.Errorf("decode %s failed: %w", n.Cid(), err)
+	}
+	if mode != nil && nd.mode&fs.ModeSymlink == 0 {
+		nd.mode, nd.meta = nd.mode&fs.ModeType|fileMode(*mode), true
+	}
+	if mtime != nil {
+		nd.mtime = time.Unix(mtime.seconds, int64(mtime.nsecs))
+	}
+	return nd, nil
+}
+
+// fileMode is the inverse of UnixMode.
+func fileMode(mode uint32) fs.FileMode {
+	m := fs.FileMode(mode & 0o777)
+	if mode&0o4000 != 0 {
+		m |= fs.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		m |= fs.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		m |= fs.ModeSticky
+	}
+	return m
+}
+
+// dir returns the directory, basic or sharded, of the node nd.
+func (fsys *dagFS) dir(nd *dagNode) (uio.Directory, error) {
+	dir, err := uio.NewDirectoryFromNode(fsys.dag, nd.node)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s failed: %w", nd.node.Cid(), err)
+	}
+	return dir, nil
+}
+
+// child returns the entry name of the directory nd.
+func (fsys *dagFS) child(nd *dagNode, name string) (*dagNode, error) {
+	dir, err := fsys.dir(nd)
+	if err != nil {
+		return nil, err
+	}
+	n, err := dir.Find(context.Background(), name)
+	if err != nil {
+		return nil, err
+	}
+	return decodeNode(n, name)
+}
+
+// entries returns the entries of the directory nd, rejecting names which
+// are not a single path element, and duplicates.
+func (fsys *dagFS) entries(nd *dagNode) ([]*dagNode, error) {
+	dir, err := fsys.dir(nd)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var entries []*dagNode
+	err = dir.ForEachLink(context.Background(), func(l *ipld.Link) error {
+		if l.Name == "" || l.Name == "." || l.Name == ".." || strings.ContainsAny(l.Name, `/\`) {
+			return fmt.Errorf("%s: invalid entry name %q", nd.node.Cid(), l.Name)
+		}
+		if seen[l.Name] {
+			return fmt.Errorf("%s: duplicate entry %q", nd.node.Cid(), l.Name)
+		}
+		seen[l.Name] = true
+		child, err := fsys.load(l.Cid, l.Name)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, child)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// reader returns a reader of the content of the file or symlink nd.
+func (fsys *dagFS) reader(nd *dagNode) (io.Reader, error) {
+	if nd.mode&fs.ModeSymlink != 0 {
+		return bytes.NewReader(nd.target), nil
+	}
+	f, err := unixfile.NewUnixfsFile(context.Background(), fsys.dag, nd.node)
+	if err != nil {
+		return nil, err
+	}
+	r, ok := f.(files.File)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", nd.node.Cid(), ErrNotFile)
+	}
+	return r, nil
+}
+
+func (fsys *dagFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	nd, err := fsys.load(fsys.root, ".")
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	if name != "." {
+		for _, elem := range strings.Split(name, "/") {
+			if !nd.mode.IsDir() {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+			}
+			if nd, err = fsys.child(nd, elem); err != nil {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+			}
+		}
+	}
+	if nd.mode.IsDir() {
+		return &dagDir{fsys: fsys, node: nd}, nil
+	}
+	r, err := fsys.reader(nd)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &dagFile{node: nd, r: r}, nil
+}
+
+func (fsys *dagFS) extract(nd *dagNode, p string) error {
+	switch {
+	case nd.mode.IsDir():
+		entries, err := fsys.entries(nd)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			ep := filepath.Join(p, e.name)
+			if e.mode.IsDir() {
+				if err := os.Mkdir(ep, 0o755); err != nil && !errors.Is(err, fs.ErrExist) {
+					return err
+				}
+				if fi, err := os.Lstat(ep); err != nil || !fi.IsDir() {
+					return fmt.Errorf("%s is not a directory", ep)
+				}
+			}
+			if err := fsys.extract(e, ep); err != nil {
+				return err
+			}
+		}
+	case nd.mode&fs.ModeSymlink != 0:
+		// Symlinks carry no metadata applied on disk.
+		return os.Symlink(string(nd.target), p)
+	default:
+		// An existing symlink is replaced rather than written through.
+		if fi, err := os.Lstat(p); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+			if err := os.Remove(p); err != nil {
+				return err
+			}
+		}
+		r, err := fsys.reader(nd)
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(p, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(f, r)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if nd.meta {
+		if err := os.Chmod(p, nd.mode.Perm()); err != nil {
+			return err
+		}
+	}
+	if !nd.mtime.IsZero() {
+		return os.Chtimes(p, nd.mtime, nd.mtime)
+	}
+	return nil
+}
+
+// info is the fs.FileInfo of a node.
+type info struct{ node *dagNode }
+
+func (i info) Name() string       { return i.node.name }
+func (i info) Size() int64        { return i.node.size }
+func (i info) Mode() fs.FileMode  { return i.node.mode }
+func (i info) ModTime() time.Time { return i.node.mtime }
+func (i info) IsDir() bool        { return i.node.mode.IsDir() }
+func (i info) Sys() interface{}   { return nil }
+
+// dagFile is an open file or symlink.
+type dagFile struct {
+	node *dagNode
+	r    io.Reader
+}
+
+func (f *dagFile) Stat() (fs.FileInfo, error) { return info{f.node}, nil }
+func (f *dagFile) Read(p []byte) (int, error) { return f.r.Read(p) }
+func (f *dagFile) Close() error               { return nil }
+
+// dagDir is an open directory, its entries loaded on the first ReadDir.
+type dagDir struct {
+	fsys    *dagFS
+	node    *dagNode
+	entries []*dagNode
+	read    bool
+}
+
+func (d *dagDir) Stat() (fs.FileInfo, error) { return info{d.node}, nil }
+func (d *dagDir) Close() error               { return nil }
+
+func (d *dagDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: errors.New("is a directory")}
+}
+
+func (d *dagDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		entries, err := d.fsys.entries(d.node)
+		if err != nil {
+			return nil, err
+		}
+		d.entries, d.read = entries, true
+	}
+	count := len(d.entries)
+	if n > 0 && n < count {
+		count = n
+	}
+	if n > 0 && count == 0 {
+		return nil, io.EOF
+	}
+	list := make([]fs.DirEntry, count)
+	for i := range list {
+		list[i] = fs.FileInfoToDirEntry(info{d.entries[i]})
+	}
+	d.entries = d.entries[count:]
+	return list, nil
+}
@@ -0,0 +1,137 @@
+package unixfs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/ipfs/boxo/files"
+	"github.com/ipfs/boxo/ipld/merkledag"
+	mdtest "github.com/ipfs/boxo/ipld/merkledag/test"
+	"github.com/ipfs/boxo/ipld/unixfs/hamt"
+	"github.com/ipfs/go-cid"
+	ipld "github.com/ipfs/go-ipld-format"
+)
+
+// index returns the root of the DAG of nd and a DAG service of its blocks.
+func index(t *testing.T, nd files.Node, opts ...Option) (cid.Cid, ipld.DAGService) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	root, err := WriteCAR(&buf, nd, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, dag, err := IndexCAR(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, dag
+}
+
+func TestFS(t *testing.T) {
+	for _, opts := range [][]Option{nil, {CidV0()}} {
+		fsys := NewFS(index(t, tree(), opts...))
+		if err := fstest.TestFS(fsys, "index.html", "empty", "link", "sub/large.bin", "sub/void", "sub/nested"); err != nil {
+			t.Fatal(err)
+		}
+		b, err := fs.ReadFile(fsys, "sub/large.bin")
+		if err != nil || !bytes.Equal(b, bytes.Repeat([]byte("a"), 3*DefaultChunkSize+7)) {
+			t.Errorf("Unexpected content of %d bytes: %v", len(b), err)
+		}
+		fi, err := fs.Stat(fsys, "link")
+		if err != nil || fi.Mode()&fs.ModeSymlink == 0 {
+			t.Errorf("Unexpected symlink %v: %v", fi, err)
+		}
+		if _, err := fs.Stat(fsys, "index.html/x"); err == nil {
+			t.Error("Unexpected entry below a file")
+		}
+	}
+
+	// A file is opened as the root.
+	fsys := NewFS(index(t, files.NewBytesFile([]byte("hello world\n"))))
+	if b, err := fs.ReadFile(fsys, "."); err != nil || string(b) != "hello world\n" {
+		t.Errorf("Unexpected content %q: %v", b, err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	mtime := time.Unix(1600000000, 0)
+	dir := t.TempDir()
+	nd := files.NewMapDirectory(map[string]files.Node{
+		"link": files.NewLinkFile("sub/script.sh", nil),
+		"sub": files.NewMapDirectory(map[string]files.Node{
+			"script.sh": &metaFile{File: files.NewBytesFile([]byte("#!/bin/sh\n")), mode: 0o755, mtime: mtime},
+			"setuid":    &metaFile{File: files.NewBytesFile([]byte("#!/bin/sh\n")), mode: 0o755 | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky},
+		}),
+	})
+
+	out := filepath.Join(dir, "out")
+	root, dag := index(t, nd)
+	if err := Extract(root, dag, out); err != nil {
+		t.Fatalf("Unexpected extract: %v", err)
+	}
+	fi, err := os.Stat(filepath.Join(out, "sub", "script.sh"))
+	if err != nil || fi.Mode().Perm() != 0o755 || !fi.ModTime().Equal(mtime) {
+		t.Errorf("Unexpected file %v: %v", fi, err)
+	}
+	// The special bits of the DAG are dropped.
+	fi, err = os.Stat(filepath.Join(out, "sub", "setuid"))
+	if err != nil || fi.Mode() != 0o755 {
+		t.Errorf("Unexpected mode %v of a setuid file: %v", fi.Mode(), err)
+	}
+	if target, err := os.Readlink(filepath.Join(out, "link")); err != nil || target != "sub/script.sh" {
+		t.Errorf("Unexpected symlink %s: %v", target, err)
+	}
+
+	// A file root is written at the path.
+	root, dag = index(t, files.NewBytesFile([]byte("hello world\n")))
+	if err := Extract(root, dag, filepath.Join(dir, "hello.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dir, "hello.txt")); err != nil || string(b) != "hello world\n" {
+		t.Errorf("Unexpected content %q: %v", b, err)
+	}
+}
+
+func TestFSShardedDirectory(t *testing.T) {
+	ctx := context.Background()
+	dag := mdtest.Mock()
+	shard, err := hamt.NewShard(dag, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, 300)
+	for i := 0; i < 300; i++ {
+		name := fmt.Sprintf("file-%03d", i)
+		nd := merkledag.NewRawNode([]byte(name))
+		if err := dag.Add(ctx, nd); err != nil {
+			t.Fatal(err)
+		}
+		if err := shard.Set(ctx, name, nd); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	root, err := shard.Node()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dag.Add(ctx, root); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := NewFS(root.Cid(), dag)
+	if err := fstest.TestFS(fsys, names...); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := fs.ReadFile(fsys, "file-042"); err != nil || string(b) != "file-042" {
+		t.Errorf("Unexpected content %q: %v", b, err)
+	}
+}
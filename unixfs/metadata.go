@@ -0,0 +1,48 @@
+package unixfs
+
+import (
+	"os"
+	"time"
+
+	"github.com/ipfs/boxo/files"
+)
+
+// Metadata is implemented by the nodes carrying UnixFS 1.5 metadata. A
+// zero mode or modification time is left out.
+type Metadata interface {
+	Mode() os.FileMode
+	ModTime() time.Time
+}
+
+// UnixMode returns the POSIX permission bits of m, as stored in the
+// UnixFS mode field.
+func UnixMode(m os.FileMode) uint32 {
+	mode := uint32(m.Perm())
+	if m&os.ModeSetuid != 0 {
+		mode |= 0o4000
+	}
+	if m&os.ModeSetgid != 0 {
+		mode |= 0o2000
+	}
+	if m&os.ModeSticky != 0 {
+		mode |= 0o1000
+	}
+	return mode
+}
+
+// withMetadata sets the metadata carried by nd on d, and reports whether
+// there is any.
+func withMetadata(nd files.Node, d *data) bool {
+	m, ok := nd.(Metadata)
+	if !ok {
+		return false
+	}
+	if mode := m.Mode(); mode != 0 {
+		v := UnixMode(mode)
+		d.mode = &v
+	}
+	if mtime := m.ModTime(); !mtime.IsZero() {
+		d.mtime = &unixTime{seconds: mtime.Unix(), nsecs: uint32(mtime.Nanosecond())}
+	}
+	return d.mode != nil || d.mtime != nil
+}
@@ -0,0 +1,212 @@
+package unixfs
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ipfs/boxo/files"
+	ipld "github.com/ipfs/boxo/ipld/merkledag"
+	"github.com/ipfs/go-cid"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type metaFile struct {
+	files.File
+	mode  os.FileMode
+	mtime time.Time
+}
+
+func (f *metaFile) Mode() os.FileMode  { return f.mode }
+func (f *metaFile) ModTime() time.Time { return f.mtime }
+
+type metaDir struct {
+	files.Directory
+	mode  os.FileMode
+	mtime time.Time
+}
+
+func (d *metaDir) Mode() os.FileMode  { return d.mode }
+func (d *metaDir) ModTime() time.Time { return d.mtime }
+
+var mtime = time.Date(2023, 4, 1, 12, 30, 0, 500, time.UTC)
+
+// unixfsData holds the fields of a UnixFS Data message the tests check.
+type unixfsData struct {
+	typ      uint64
+	data     []byte
+	mode     *uint64
+	seconds  *uint64
+	nsecs    *uint32
+	children int
+}
+
+// decode decodes the UnixFS data of the dag-pb block raw.
+func decode(t *testing.T, raw []byte) unixfsData {
+	t.Helper()
+
+	nd, err := ipld.DecodeProtobuf(raw)
+	if err != nil {
+		t.Fatalf("Unexpected decode dag-pb: %v", err)
+	}
+	out := unixfsData{children: len(nd.Links())}
+	b := nd.Data()
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		b = b[n:]
+		switch {
+		case num == 1:
+			v, n := protowire.ConsumeVarint(b)
+			out.typ, b = v, b[n:]
+		case num == 2:
+			v, n := protowire.ConsumeBytes(b)
+			out.data, b = v, b[n:]
+		case num == 7:
+			v, n := protowire.ConsumeVarint(b)
+			out.mode, b = &v, b[n:]
+		case num == 8:
+			v, n := protowire.ConsumeBytes(b)
+			b = b[n:]
+			for len(v) > 0 {
+				num, _, n := protowire.ConsumeTag(v)
+				v = v[n:]
+				if num == 1 {
+					s, n := protowire.ConsumeVarint(v)
+					out.seconds, v = &s, v[n:]
+				} else {
+					ns, n := protowire.ConsumeFixed32(v)
+					out.nsecs, v = &ns, v[n:]
+				}
+			}
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			b = b[n:]
+		}
+	}
+	return out
+}
+
+// build builds nd and returns its root link and blocks.
+func build(t *testing.T, nd files.Node, opts ...Option) (Link, map[cid.Cid][]byte) {
+	t.Helper()
+
+	blocks := make(map[cid.Cid][]byte)
+	l, err := NewBuilder(append(opts, OnBlock(func(b Block) error {
+		blocks[b.Cid] = b.Data
+		return nil
+	}))...).Add(nd)
+	if err != nil {
+		t.Fatalf("Unexpected add: %v", err)
+	}
+	return l, blocks
+}
+
+func checkMetadata(t *testing.T, d unixfsData, mode uint64) {
+	t.Helper()
+
+	if d.mode == nil || *d.mode != mode {
+		t.Errorf("Unexpected mode, got %v instead of %#o", d.mode, mode)
+	}
+	if d.seconds == nil || *d.seconds != uint64(mtime.Unix()) {
+		t.Errorf("Unexpected mtime seconds, got %v instead of %d", d.seconds, mtime.Unix())
+	}
+	if d.nsecs == nil || *d.nsecs != uint32(mtime.Nanosecond()) {
+		t.Errorf("Unexpected mtime nsecs, got %v instead of %d", d.nsecs, mtime.Nanosecond())
+	}
+}
+
+func TestMetadataSingleChunk(t *testing.T) {
+	content := []byte("hello world\n")
+	newFile := func() files.Node {
+		return &metaFile{File: files.NewBytesFile(content), mode: 0o640, mtime: mtime}
+	}
+
+	// A raw leaf cannot carry metadata, so the root is a file node linking
+	// to it.
+	l, blocks := build(t, newFile())
+	if l.Cid.Type() != cid.DagProtobuf {
+		t.Fatalf("Unexpected root codec %x", l.Cid.Type())
+	}
+	root := decode(t, blocks[l.Cid])
+	if root.typ != typeFile || root.children != 1 || root.data != nil {
+		t.Errorf("Unexpected root %+v", root)
+	}
+	checkMetadata(t, root, 0o640)
+
+	// With dag-pb leaves, the only leaf carries the metadata.
+	l, blocks = build(t, newFile(), CidV0())
+	root = decode(t, blocks[l.Cid])
+	if root.typ != typeFile || root.children != 0 || !bytes.Equal(root.data, content) {
+		t.Errorf("Unexpected root %+v", root)
+	}
+	checkMetadata(t, root, 0o640)
+
+	plain, _ := Sum(files.NewBytesFile(content), CidV0())
+	if l.Cid.Equals(plain) {
+		t.Error("Unexpected metadata not changing the cid")
+	}
+}
+
+func TestMetadataMultipleChunks(t *testing.T) {
+	content := bytes.Repeat([]byte("a"), 3*1024+1)
+	nd := &metaFile{File: files.NewBytesFile(content), mode: 0o755, mtime: mtime}
+
+	l, blocks := build(t, nd, ChunkSize(1024))
+	root := decode(t, blocks[l.Cid])
+	if root.children != 4 {
+		t.Errorf("Unexpected root with %d children", root.children)
+	}
+	checkMetadata(t, root, 0o755)
+	for c, raw := range blocks {
+		if c.Equals(l.Cid) || c.Type() != cid.DagProtobuf {
+			continue
+		}
+		if d := decode(t, raw); d.mode != nil || d.seconds != nil {
+			t.Errorf("Unexpected metadata on inner node %s", c)
+		}
+	}
+}
+
+func TestMetadataDirectory(t *testing.T) {
+	dir := &metaDir{
+		Directory: files.NewMapDirectory(map[string]files.Node{"a": files.NewBytesFile([]byte("a"))}),
+		mode:      os.ModeDir | os.ModeSticky | 0o777,
+		mtime:     mtime,
+	}
+	l, blocks := build(t, dir)
+	root := decode(t, blocks[l.Cid])
+	if root.typ != typeDirectory {
+		t.Errorf("Unexpected root type %d", root.typ)
+	}
+	checkMetadata(t, root, 0o1777)
+}
+
+func TestMetadataZeroValues(t *testing.T) {
+	content := []byte("hello world\n")
+	expected, _ := Sum(files.NewBytesFile(content))
+	c, err := Sum(&metaFile{File: files.NewBytesFile(content)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Equals(expected) {
+		t.Errorf("Unexpected cid, got %s instead of %s", c, expected)
+	}
+}
+
+func TestUnixMode(t *testing.T) {
+	tests := []struct {
+		mode     os.FileMode
+		expected uint32
+	}{
+		{0o644, 0o644},
+		{os.ModeDir | 0o755, 0o755},
+		{os.ModeSetuid | os.ModeSetgid | 0o755, 0o6755},
+		{os.ModeSticky | 0o777, 0o1777},
+	}
+	for _, test := range tests {
+		if got := UnixMode(test.mode); got != test.expected {
+			t.Errorf("Unexpected mode of %v, got %#o instead of %#o", test.mode, got, test.expected)
+		}
+	}
+}
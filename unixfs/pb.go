@@ -0,0 +1,179 @@
+package unixfs
+
+import (
+	"encoding/binary"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// UnixFS data types, see https://github.com/ipfs/specs/blob/main/UNIXFS.md
+const (
+	typeDirectory = 1
+	typeFile      = 2
+	typeSymlink   = 4
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendTag(b []byte, field, wire int) []byte {
+	return binary.AppendUvarint(b, uint64(field<<3|wire))
+}
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	b = appendTag(b, field, wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendBytes(b []byte, field int, v []byte) []byte {
+	b = appendTag(b, field, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendFixed32(b []byte, field int, v uint32) []byte {
+	b = appendTag(b, field, wireFixed32)
+	return binary.LittleEndian.AppendUint32(b, v)
+}
+
+// unixTime is the UnixFS 1.5 UnixTime message.
+type unixTime struct {
+	seconds int64
+	nsecs   uint32
+}
+
+func (t *unixTime) marshal() []byte {
+	b := appendVarint(nil, 1, uint64(t.seconds))
+	if t.nsecs != 0 {
+		b = appendFixed32(b, 2, t.nsecs)
+	}
+	return b
+}
+
+// data is the UnixFS Data message.
+type data struct {
+	typ        uint64
+	data       []byte
+	filesize   *uint64
+	blocksizes []uint64
+	mode       *uint32
+	mtime      *unixTime
+}
+
+func (d *data) marshal() []byte {
+	b := appendVarint(nil, 1, d.typ)
+	if d.data != nil {
+		b = appendBytes(b, 2, d.data)
+	}
+	if d.filesize != nil {
+		b = appendVarint(b, 3, *d.filesize)
+	}
+	for _, size := range d.blocksizes {
+		b = appendVarint(b, 4, size)
+	}
+	if d.mode != nil {
+		b = appendVarint(b, 7, uint64(*d.mode))
+	}
+	if d.mtime != nil {
+		b = appendBytes(b, 8, d.mtime.marshal())
+	}
+	return b
+}
+
+// pbLink is the dag-pb PBLink message.
+type pbLink struct {
+	hash  []byte
+	name  string
+	tsize uint64
+}
+
+// pbNode is the dag-pb PBNode message. Links are encoded before Data, as
+// required by the canonical dag-pb form.
+type pbNode struct {
+	links []pbLink
+	data  []byte
+}
+
+func (n *pbNode) marshal() []byte {
+	var b []byte
+	for _, l := range n.links {
+		lb := appendBytes(nil, 1, l.hash)
+		lb = appendBytes(lb, 2, []byte(l.name))
+		lb = appendVarint(lb, 3, l.tsize)
+		b = appendBytes(b, 2, lb)
+	}
+	if n.data != nil {
+		b = appendBytes(b, 1, n.data)
+	}
+	return b
+}
+
+// unmarshalMetadata decodes the UnixFS 1.5 mode and modification time of
+// a UnixFS Data message, which the decoder of boxo v0.9 drops.
+func unmarshalMetadata(b []byte) (mode *uint32, mtime *unixTime, err error) {
+	err = consumeFields(b, func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error {
+		switch {
+		case num == 7 && typ == protowire.VarintType:
+			m := uint32(x)
+			mode = &m
+		case num == 8 && typ == protowire.BytesType:
+			t := &unixTime{}
+			err := consumeFields(v, func(num protowire.Number, typ protowire.Type, _ []byte, x uint64) error {
+				switch {
+				case num == 1 && typ == protowire.VarintType:
+					t.seconds = int64(x)
+				case num == 2 && typ == protowire.Fixed32Type:
+					t.nsecs = uint32(x)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			mtime = t
+		}
+		return nil
+	})
+	return mode, mtime, err
+}
+
+// consumeFields calls fn with every field of a protobuf message, with the
+// value of bytes fields, or of varint and fixed32 fields. Other fields are
+// skipped.
+func consumeFields(b []byte, fn func(num protowire.Number, typ protowire.Type, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var (
+			v []byte
+			x uint64
+		)
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			x, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed32Type:
+			var v32 uint32
+			v32, n = protowire.ConsumeFixed32(b)
+			x = uint64(v32)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		if err := fn(num, typ, v, x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package version holds the build information of ipfs-pinner, set by the
+linker flags of the Makefile.
+*/
+package version // import "github.com/wabarc/ipfs-pinner/version"
+
+// These variables are populated via the Go linker.
+var (
+	Version   = "dev"
+	Commit    = "unknown"
+	BuildDate = "unknown"
+)
@@ -0,0 +1,45 @@
+//go:build linux
+
+package watch
+
+import (
+	"os"
+	"syscall"
+)
+
+// notify returns a channel receiving a value when an entry of dir is
+// created, written, moved or removed, and a function releasing the
+// inotify instance.
+func notify(dir string) (<-chan struct{}, func(), error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, nil, os.NewSyscallError("inotify_init1", err)
+	}
+	const mask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_ATTRIB | syscall.IN_CLOSE_WRITE |
+		syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE
+	if _, err := syscall.InotifyAddWatch(fd, dir, mask); err != nil {
+		syscall.Close(fd)
+		return nil, nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+	// The descriptor is non-blocking, so that reads wait in the runtime
+	// poller and return once the file is closed.
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	events := make(chan struct{}, 1)
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			// The events only wake the watcher, which scans the
+			// directory, so they are not decoded.
+			if _, err := f.Read(buf); err != nil {
+				return
+			}
+			select {
+			case events <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return events, func() { f.Close() }, nil
+}
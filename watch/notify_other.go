@@ -0,0 +1,12 @@
+//go:build !linux
+
+package watch
+
+import (
+	"errors"
+)
+
+// notify is not supported, the directory is polled.
+func notify(dir string) (<-chan struct{}, func(), error) {
+	return nil, nil, errors.New("inotify is not supported")
+}
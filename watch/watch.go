@@ -0,0 +1,202 @@
+// Copyright 2023 Wayback Archiver. All rights reserved.
+// Use of this source code is governed by the GNU GPL v3
+// license that can be found in the LICENSE file.
+
+/*
+Package watch reports the files of a directory once they are complete, so
+that files dropped into a spool directory can be pinned as they arrive.
+
+A file is complete once its size and modification time have not changed
+for a quiet period. The directory is watched with inotify on Linux, and
+scanned at an interval elsewhere or when inotify is not available.
+*/
+package watch // import "github.com/wabarc/ipfs-pinner/watch"
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Defaults of a Watcher.
+const (
+	DefaultQuiet      = 5 * time.Second
+	DefaultInterval   = 2 * time.Second
+	DefaultRetryDelay = time.Minute
+)
+
+// Watcher watches the regular files directly in a directory. Hidden files,
+// such as the temporary files of many writers, and directories are skipped.
+type Watcher struct {
+	Dir string
+	// Match, if set, is a pattern the names of the files must match, see
+	// filepath.Match.
+	Match string
+	// Quiet is the time a file must stay unchanged before it is reported.
+	// Zero means DefaultQuiet.
+	Quiet time.Duration
+	// Interval is the time between two scans of the directory when it is
+	// polled. Zero means DefaultInterval.
+	Interval time.Duration
+	// RetryDelay is the time after which a file whose handling failed is
+	// reported again. Zero means DefaultRetryDelay.
+	RetryDelay time.Duration
+	// Poll scans the directory at Interval instead of using inotify, for
+	// file systems not reporting changes, such as network file systems.
+	Poll bool
+}
+
+// state is what is known of a file.
+type state struct {
+	size  int64
+	mtime time.Time
+	// since is when the file was first seen with its size and mtime.
+	since time.Time
+	// done reports whether the file was handled with its size and mtime.
+	done bool
+	// retry is when a file whose handling failed is reported again.
+	retry time.Time
+}
+
+// Run watches the directory until ctx is done, and calls fn with the path
+// of every file once it is complete, including the files present when it
+// starts. A file changing after fn succeeded is reported again once
+// complete, a file for which fn failed is reported again after
+// RetryDelay. Run returns nil once ctx is done, or the error of reading
+// the directory.
+func (w *Watcher) Run(ctx context.Context, fn func(path string) error) error {
+	if _, err := os.ReadDir(w.Dir); err != nil {
+		return err
+	}
+	events, stop := w.events()
+	defer stop()
+
+	files := make(map[string]*state)
+	for {
+		next, err := w.scan(files, time.Now(), fn)
+		if err != nil {
+			return err
+		}
+
+		var timer <-chan time.Time
+		switch {
+		case events == nil:
+			timer = time.After(w.interval())
+		case !next.IsZero():
+			timer = time.After(time.Until(next))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-events:
+		case <-timer:
+		}
+	}
+}
+
+// events returns a channel receiving a value when the directory changes,
+// or nil if it must be polled.
+func (w *Watcher) events() (<-chan struct{}, func()) {
+	if w.Poll {
+		return nil, func() {}
+	}
+	events, stop, err := notify(w.Dir)
+	if err != nil {
+		return nil, func() {}
+	}
+	return events, stop
+}
+
+// scan updates the states of the files, calls fn with the complete ones,
+// and returns when the next file becomes complete, zero if none will
+// unless changed.
+func (w *Watcher) scan(files map[string]*state, now time.Time, fn func(path string) error) (next time.Time, err error) {
+	entries, err := os.ReadDir(w.Dir)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	seen := make(map[string]bool, len(entries))
+	var ready []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || !entry.Type().IsRegular() {
+			continue
+		}
+		if w.Match != "" {
+			if ok, _ := filepath.Match(w.Match, name); !ok {
+				continue
+			}
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// Removed since read.
+			continue
+		}
+		seen[name] = true
+
+		s, ok := files[name]
+		if !ok || s.size != info.Size() || !s.mtime.Equal(info.ModTime()) {
+			s = &state{size: info.Size(), mtime: info.ModTime(), since: now}
+			files[name] = s
+		}
+		if s.done {
+			continue
+		}
+		at := s.since.Add(w.quiet())
+		if s.retry.After(at) {
+			at = s.retry
+		}
+		if !at.After(now) {
+			ready = append(ready, name)
+			continue
+		}
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	for name := range files {
+		if !seen[name] {
+			delete(files, name)
+		}
+	}
+
+	sort.Strings(ready)
+	for _, name := range ready {
+		s := files[name]
+		if err := fn(filepath.Join(w.Dir, name)); err != nil {
+			s.retry = now.Add(w.retryDelay())
+			if next.IsZero() || s.retry.Before(next) {
+				next = s.retry
+			}
+			continue
+		}
+		s.done = true
+	}
+
+	return next, nil
+}
+
+func (w *Watcher) quiet() time.Duration {
+	if w.Quiet > 0 {
+		return w.Quiet
+	}
+	return DefaultQuiet
+}
+
+func (w *Watcher) interval() time.Duration {
+	if w.Interval > 0 {
+		return w.Interval
+	}
+	return DefaultInterval
+}
+
+func (w *Watcher) retryDelay() time.Duration {
+	if w.RetryDelay > 0 {
+		return w.RetryDelay
+	}
+	return DefaultRetryDelay
+}
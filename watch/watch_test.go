@@ -0,0 +1,105 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.warc", "a")
+	write(".b.warc.open", "b")
+	write("c.txt", "c")
+	if err := os.Mkdir(filepath.Join(dir, "done"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	fail := false
+	fn := func(path string) error {
+		got = append(got, filepath.Base(path))
+		if fail {
+			return errors.New("failed")
+		}
+		return nil
+	}
+	w := &Watcher{Dir: dir, Match: "*.warc", Quiet: time.Minute, RetryDelay: time.Hour}
+	files := make(map[string]*state)
+	start := time.Now()
+
+	// Files are reported once quiet.
+	next, err := w.scan(files, start, fn)
+	if err != nil || len(got) != 0 || !next.Equal(start.Add(time.Minute)) {
+		t.Fatalf("Unexpected first scan, next %v, got %v: %v", next, got, err)
+	}
+	if _, err := w.scan(files, next, fn); err != nil || !reflect.DeepEqual(got, []string{"a.warc"}) {
+		t.Fatalf("Unexpected scan once quiet, got %v: %v", got, err)
+	}
+
+	// A changed file is reported again, a failed one after the delay.
+	got, fail = nil, true
+	write("a.warc", "changed")
+	now := next.Add(time.Second)
+	if _, err := w.scan(files, now, fn); err != nil || len(got) != 0 {
+		t.Fatalf("Unexpected scan of a changed file, got %v: %v", got, err)
+	}
+	now = now.Add(time.Minute)
+	if next, err = w.scan(files, now, fn); err != nil || len(got) != 1 || !next.Equal(now.Add(time.Hour)) {
+		t.Fatalf("Unexpected scan of a failing file, next %v, got %v: %v", next, got, err)
+	}
+	if _, err := w.scan(files, now.Add(time.Minute), fn); err != nil || len(got) != 1 {
+		t.Fatalf("Unexpected retry before the delay, got %v: %v", got, err)
+	}
+	fail = false
+	if _, err := w.scan(files, now.Add(time.Hour), fn); err != nil || len(got) != 2 {
+		t.Fatalf("Unexpected retry after the delay, got %v: %v", got, err)
+	}
+
+	// Removed files are forgotten.
+	os.Remove(filepath.Join(dir, "a.warc"))
+	if _, err := w.scan(files, now.Add(2*time.Hour), fn); err != nil || len(files) != 0 {
+		t.Fatalf("Unexpected files %v: %v", files, err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		dir := t.TempDir()
+		w := &Watcher{Dir: dir, Quiet: 50 * time.Millisecond, Interval: 10 * time.Millisecond, Poll: poll}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+		reported := make(chan string, 1)
+		done := make(chan error, 1)
+		go func() {
+			done <- w.Run(ctx, func(path string) error {
+				reported <- filepath.Base(path)
+				return nil
+			})
+		}()
+		if err := os.WriteFile(filepath.Join(dir, "a.warc"), []byte("a"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case name := <-reported:
+			if name != "a.warc" {
+				t.Errorf("Unexpected file %s reported", name)
+			}
+		case <-ctx.Done():
+			t.Errorf("File not reported, poll %v", poll)
+		}
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Unexpected run: %v", err)
+		}
+	}
+}